@@ -3,7 +3,10 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/mail"
 	"os/signal"
+	"regexp"
 	"strconv"
 	"syscall"
 	"time"
@@ -13,11 +16,34 @@ import (
 	"github.com/wb-go/wbf/zlog"
 
 	"github.com/aliskhannn/comment-tree/internal/api/handlers/comment"
+	"github.com/aliskhannn/comment-tree/internal/api/handlers/notification"
+	"github.com/aliskhannn/comment-tree/internal/api/handlers/reaction"
+	"github.com/aliskhannn/comment-tree/internal/api/handlers/stream"
+	"github.com/aliskhannn/comment-tree/internal/api/handlers/webhook"
 	"github.com/aliskhannn/comment-tree/internal/api/router"
 	"github.com/aliskhannn/comment-tree/internal/api/server"
+	"github.com/aliskhannn/comment-tree/internal/auth"
+	commentcache "github.com/aliskhannn/comment-tree/internal/cache/comment"
+	reactioncache "github.com/aliskhannn/comment-tree/internal/cache/reaction"
 	"github.com/aliskhannn/comment-tree/internal/config"
+	"github.com/aliskhannn/comment-tree/internal/email"
+	"github.com/aliskhannn/comment-tree/internal/idempotency"
+	"github.com/aliskhannn/comment-tree/internal/model"
+	"github.com/aliskhannn/comment-tree/internal/ratelimit"
+	"github.com/aliskhannn/comment-tree/internal/realtime"
+	"github.com/aliskhannn/comment-tree/internal/render"
 	commentrepo "github.com/aliskhannn/comment-tree/internal/repository/comment"
+	notificationrepo "github.com/aliskhannn/comment-tree/internal/repository/notification"
+	outboxrepo "github.com/aliskhannn/comment-tree/internal/repository/outbox"
+	reactionrepo "github.com/aliskhannn/comment-tree/internal/repository/reaction"
+	webhookrepo "github.com/aliskhannn/comment-tree/internal/repository/webhook"
 	commentsvc "github.com/aliskhannn/comment-tree/internal/service/comment"
+	"github.com/aliskhannn/comment-tree/internal/service/filter"
+	notificationsvc "github.com/aliskhannn/comment-tree/internal/service/notification"
+	outboxsvc "github.com/aliskhannn/comment-tree/internal/service/outbox"
+	reactionsvc "github.com/aliskhannn/comment-tree/internal/service/reaction"
+	webhooksvc "github.com/aliskhannn/comment-tree/internal/service/webhook"
+	"github.com/aliskhannn/comment-tree/internal/tenant"
 )
 
 func main() {
@@ -58,13 +84,138 @@ func main() {
 		zlog.Logger.Fatal().Err(err).Msg("failed to connect to redis")
 	}
 
+	// Initialize authentication.
+	jwtVerifier, err := auth.NewJWTVerifier(
+		cfg.Auth.JWT.HMACSecret, cfg.Auth.JWT.RSAPublicKey,
+		cfg.Auth.JWT.Issuer, cfg.Auth.JWT.Audience,
+	)
+	if err != nil {
+		zlog.Logger.Fatal().Err(err).Msg("failed to initialize jwt verifier")
+	}
+
+	apiKeys := make([]auth.APIKey, 0, len(cfg.Auth.APIKeys))
+	for _, k := range cfg.Auth.APIKeys {
+		role := k.Role
+		if role == "" {
+			role = model.RoleUser
+		}
+		apiKeys = append(apiKeys, auth.APIKey{
+			Key:  k.Key,
+			User: model.User{ID: k.UserID, Name: k.Name, Username: k.Username, Email: k.Email, Role: role, TenantID: k.Tenant},
+		})
+	}
+	authenticator := auth.NewAuthenticator(jwtVerifier, apiKeys)
+
+	// Initialize tenants.
+	tenants := make([]model.Tenant, 0, len(cfg.Tenancy.Tenants))
+	for _, t := range cfg.Tenancy.Tenants {
+		tenants = append(tenants, model.Tenant{
+			ID:               t.ID,
+			Subdomain:        t.Subdomain,
+			MaxContentLength: t.MaxContentLength,
+			CORSOrigins:      t.CORSOrigins,
+			ModerationMode:   t.ModerationMode,
+			ReportThreshold:  t.ReportThreshold,
+			Language:         t.Language,
+		})
+	}
+
+	tenantRegistry, err := tenant.NewRegistry(tenants, cfg.Tenancy.Header, cfg.Tenancy.BaseDomain, cfg.Tenancy.DefaultTenant)
+	if err != nil {
+		zlog.Logger.Fatal().Err(err).Msg("failed to initialize tenants")
+	}
+
+	// Start the event broker.
+	broker := realtime.NewBroker(rdb, cfg.Realtime.StreamMaxLen)
+	go broker.Run(ctx)
+
+	// Initialize webhooks and start the delivery worker.
+	webhookRepo := webhookrepo.NewRepository(db)
+	webhookService := webhooksvc.NewService(webhookRepo, cfg.Webhooks.AllowPrivate)
+	webhookHandler := webhook.NewHandler(webhookService)
+
+	webhookWorker := webhooksvc.NewWorker(webhookRepo, webhooksvc.WorkerConfig{
+		BatchSize:    cfg.Webhooks.BatchSize,
+		PollInterval: cfg.Webhooks.PollInterval,
+		Timeout:      cfg.Webhooks.Timeout,
+		MaxAttempts:  cfg.Webhooks.MaxAttempts,
+		BaseBackoff:  cfg.Webhooks.BaseBackoff,
+		MaxBackoff:   cfg.Webhooks.MaxBackoff,
+		AllowPrivate: cfg.Webhooks.AllowPrivate,
+		Retention:    cfg.Webhooks.Retention,
+	})
+	go webhookWorker.Run(ctx)
+
+	// Initialize mentions and notifications, fed by the outbox relay.
+	notificationRepo := notificationrepo.NewRepository(db)
+	notificationService := notificationsvc.NewService(notificationRepo, cfg.Notifications.Email.UnsubscribeSecret)
+	notificationHandler := notification.NewHandler(notificationService)
+
+	if cfg.Notifications.Email.Enabled {
+		digestWorker, err := newDigestWorker(cfg.Notifications, notificationRepo)
+		if err != nil {
+			zlog.Logger.Fatal().Err(err).Msg("failed to initialize notification emails")
+		}
+		go digestWorker.Run(ctx)
+	}
+
+	// Start the outbox relay publishing comment events.
+	sinks := []outboxsvc.NamedSink{
+		{Name: "realtime", Sink: broker},
+		{Name: "webhooks", Sink: webhookService},
+		{Name: "notifications", Sink: notificationService},
+	}
+	if cfg.Outbox.Stream != "" {
+		sinks = append(sinks, outboxsvc.NamedSink{
+			Name: "stream",
+			Sink: outboxsvc.NewStreamSink(rdb, cfg.Outbox.Stream, cfg.Outbox.StreamMaxLen),
+		})
+	}
+
+	relay := outboxsvc.NewRelay(outboxrepo.NewRepository(db), outboxsvc.RelayConfig{
+		BatchSize:    cfg.Outbox.BatchSize,
+		PollInterval: cfg.Outbox.PollInterval,
+		Lease:        cfg.Outbox.Lease,
+		MaxAttempts:  cfg.Outbox.MaxAttempts,
+		BaseBackoff:  cfg.Outbox.BaseBackoff,
+		MaxBackoff:   cfg.Outbox.MaxBackoff,
+	}, sinks...)
+	go relay.Run(ctx)
+
+	// Initialize reactions.
+	reactionRepo := reactioncache.NewCachedRepository(reactionrepo.NewRepository(db), rdb, cfg.Redis.ReactionTTL)
+	reactionService := reactionsvc.NewService(reactionRepo, cfg.Reactions.Allowed)
+	reactionHandler := reaction.NewHandler(reactionService)
+
 	// Initialize comment repository, service and handlers.
 	repo := commentrepo.NewRepository(db)
-	service := commentsvc.NewService(repo)
+	cachedRepo := commentcache.NewCachedRepository(repo, rdb, cfg.Redis.TreeTTL, cfg.Redis.ListTTL)
+	filters, err := newFilterChain(cfg.Filters, repo)
+	if err != nil {
+		zlog.Logger.Fatal().Err(err).Msg("failed to initialize content filters")
+	}
+	service := commentsvc.NewService(cachedRepo, reactionService, filters, render.NewMarkdown())
 	handler := comment.NewHandler(service)
+	streamHandler := stream.NewHandler(broker, cfg.Realtime.Heartbeat)
+
+	// Initialize rate limiting.
+	limiter := ratelimit.NewLimiter(rdb)
+	rateLimits := ratelimit.Budgets{
+		Read:  rateBudget(cfg.RateLimit.Read),
+		Write: rateBudget(cfg.RateLimit.Write),
+	}
+
+	idempotencyStore := idempotency.NewStore(rdb, cfg.Idempotency.TTL, cfg.Idempotency.LockTimeout)
 
 	// Start HTTP server
-	r := router.New(handler)
+	r, err := router.New(
+		handler, streamHandler, webhookHandler, reactionHandler, notificationHandler,
+		authenticator, tenantRegistry, limiter, rateLimits, repo, idempotencyStore,
+		cfg.Server.TrustedProxies,
+	)
+	if err != nil {
+		zlog.Logger.Fatal().Err(err).Msg("failed to initialize router")
+	}
 	s := server.New(cfg.Server.HTTPPort, r)
 	go func() {
 		if err := s.ListenAndServe(); err != nil {
@@ -97,4 +248,102 @@ func main() {
 			zlog.Logger.Printf("failed to close slave DB %d: %v", i, err)
 		}
 	}
+
+	// Close Redis.
+	if err := rdb.Close(); err != nil {
+		zlog.Logger.Printf("failed to close redis: %v", err)
+	}
+}
+
+// rateBudget converts a configured rate budget.
+func rateBudget(cfg config.RateBudget) ratelimit.Budget {
+	limit := func(r config.RateLimitRule) ratelimit.Limit {
+		return ratelimit.Limit{Requests: r.Requests, Window: r.Window}
+	}
+
+	return ratelimit.Budget{IP: limit(cfg.IP), User: limit(cfg.User), Thread: limit(cfg.Thread)}
+}
+
+// newFilterChain builds the content filter chain from its configuration.
+func newFilterChain(cfg config.Filters, recent filter.RecentComments) (*filter.Chain, error) {
+	var filters []filter.Filter
+
+	if len(cfg.Blocklist.Words) > 0 {
+		action, err := filter.ParseAction(cfg.Blocklist.Action)
+		if err != nil {
+			return nil, fmt.Errorf("blocklist: %w", err)
+		}
+		filters = append(filters, filter.NewBlocklist(cfg.Blocklist.Words, action))
+	}
+
+	if cfg.MaxLinks.Max > 0 {
+		action, err := filter.ParseAction(cfg.MaxLinks.Action)
+		if err != nil {
+			return nil, fmt.Errorf("max links: %w", err)
+		}
+		filters = append(filters, filter.NewMaxLinks(cfg.MaxLinks.Max, action))
+	}
+
+	if cfg.Duplicates.Window > 0 {
+		action, err := filter.ParseAction(cfg.Duplicates.Action)
+		if err != nil {
+			return nil, fmt.Errorf("duplicates: %w", err)
+		}
+		filters = append(filters, filter.NewDuplicate(recent, cfg.Duplicates.Window, action))
+	}
+
+	if len(cfg.Regex) > 0 {
+		rules := make([]filter.Rule, 0, len(cfg.Regex))
+		for i, r := range cfg.Regex {
+			pattern, err := regexp.Compile(r.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("regex rule %d: %w", i, err)
+			}
+			action, err := filter.ParseAction(r.Action)
+			if err != nil {
+				return nil, fmt.Errorf("regex rule %d: %w", i, err)
+			}
+			rules = append(rules, filter.Rule{Pattern: pattern, Action: action, Reason: r.Reason, Replacement: r.Replacement})
+		}
+		filters = append(filters, filter.NewRegex(rules...))
+	}
+
+	return filter.NewChain(filters...), nil
+}
+
+// newDigestWorker creates the worker emailing notifications through the
+// configured SMTP server.
+func newDigestWorker(cfg config.Notifications, repo notificationsvc.DigestRepository) (*notificationsvc.DigestWorker, error) {
+	if cfg.Email.UnsubscribeSecret == "" {
+		return nil, fmt.Errorf("notifications.email.unsubscribe_secret is required")
+	}
+
+	from, err := mail.ParseAddress(cfg.Email.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notifications.email.from: %w", err)
+	}
+
+	sender, err := email.NewSMTPSender(email.SMTPConfig{
+		Host:     cfg.SMTP.Host,
+		Port:     cfg.SMTP.Port,
+		Username: cfg.SMTP.Username,
+		Password: cfg.SMTP.Password,
+		TLS:      cfg.SMTP.TLS,
+		Timeout:  cfg.SMTP.Timeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return notificationsvc.NewDigestWorker(repo, sender, notificationsvc.DigestConfig{
+		From:              *from,
+		BaseURL:           cfg.Email.BaseURL,
+		CommentURL:        cfg.Email.CommentURL,
+		UnsubscribeSecret: cfg.Email.UnsubscribeSecret,
+		BatchSize:         cfg.Email.BatchSize,
+		PollInterval:      cfg.Email.PollInterval,
+		Timeout:           cfg.SMTP.Timeout,
+		MaxItems:          cfg.Email.MaxItems,
+		RetryInterval:     cfg.Email.RetryInterval,
+	}), nil
 }
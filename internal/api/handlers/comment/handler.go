@@ -6,22 +6,40 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/wb-go/wbf/ginext"
 	"github.com/wb-go/wbf/zlog"
 
 	"github.com/aliskhannn/comment-tree/internal/api/respond"
+	"github.com/aliskhannn/comment-tree/internal/cursor"
 	"github.com/aliskhannn/comment-tree/internal/model"
 	"github.com/aliskhannn/comment-tree/internal/repository/comment"
+	commentsvc "github.com/aliskhannn/comment-tree/internal/service/comment"
+	"github.com/aliskhannn/comment-tree/internal/service/filter"
 )
 
 // Service is the interface for the comment service.
 type Service interface {
 	CreateComment(ctx context.Context, comment *model.Comment) (model.Comment, error)
-	GetCommentsByParentID(ctx context.Context, parentID uuid.UUID) ([]model.Comment, error)
-	GetComments(ctx context.Context, parentID *uuid.UUID, search, sort string, limit, offset int) ([]model.Comment, error)
+	GetCommentsByParentID(ctx context.Context, parentID uuid.UUID, opts model.TreeOptions) ([]model.Comment, error)
+	GetCommentTree(ctx context.Context, id uuid.UUID, opts model.TreeOptions) (*model.CommentNode, error)
+	GetComments(ctx context.Context, q model.CommentQuery) (model.CommentPage, error)
+	Autocomplete(ctx context.Context, threadKey *string, text string, limit int) ([]string, error)
 	DeleteComment(ctx context.Context, id uuid.UUID) error
+	PurgeComment(ctx context.Context, id uuid.UUID) error
+	PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error)
+	UpdateComment(ctx context.Context, id uuid.UUID, content string) (model.Comment, error)
+	GetRevisions(ctx context.Context, id uuid.UUID) ([]model.Revision, error)
+	DiffRevisions(ctx context.Context, id uuid.UUID, from, to int) (model.RevisionDiff, error)
+	Vote(ctx context.Context, id uuid.UUID, value int) (model.Comment, error)
+	GetModerationQueue(ctx context.Context, q model.ModerationQuery) ([]model.Comment, error)
+	ModerateComments(ctx context.Context, d model.ModerationDecision) ([]model.Comment, error)
+	SetThreadModerationMode(ctx context.Context, threadKey, mode string) error
+	SetThreadLanguage(ctx context.Context, threadKey, language string) error
+	ReportComment(ctx context.Context, id uuid.UUID, reason, details string) (bool, error)
+	GetReportedComments(ctx context.Context, limit, offset int) ([]model.ReportedComment, error)
 }
 
 // Handler is the handler for the comment API.
@@ -36,10 +54,33 @@ func NewHandler(service Service) *Handler {
 	}
 }
 
+// Response formats of GetTree.
+const (
+	formatFlat   = "flat"
+	formatNested = "nested"
+)
+
+// maxContextChildren is the number of replies GetList may load per search result.
+const maxContextChildren = 10
+
+// Number of comments per page of GetList.
+const (
+	defaultListLimit = 10
+	maxListLimit     = 100
+)
+
+// Number of suggestions of Autocomplete.
+const (
+	defaultAutocompleteLimit = 10
+	maxAutocompleteLimit     = 20
+)
+
 // CreateRequest is the request for the create comment API.
 type CreateRequest struct {
 	ParentID *uuid.UUID `json:"parent_id"`
-	Content  string     `json:"content" binding:"required,min=1,max=1000"`
+	Thread   string     `json:"thread" binding:"max=2048"`        // ignored for replies, which inherit the parent's thread
+	Content  string     `json:"content" binding:"required,min=1"` // limited per tenant
+	Language string     `json:"language"`                         // e.g. "english" or "ru"; the thread's or tenant's if empty
 }
 
 // Create creates a new comment.
@@ -63,14 +104,29 @@ func (h *Handler) Create(c *ginext.Context) {
 
 	// Create the comment.
 	cm := &model.Comment{
-		ParentID: parentID,
-		Content:  req.Content,
+		ParentID:  parentID,
+		ThreadKey: req.Thread,
+		Content:   req.Content,
+		Language:  req.Language,
 	}
 
 	zlog.Logger.Printf("parent id in comment after: %v", parentID)
 
-	res, err := h.service.CreateComment(c, cm)
+	res, err := h.service.CreateComment(c.Request.Context(), cm)
 	if err != nil {
+		if failAuth(c, err) {
+			return
+		}
+		if errors.Is(err, commentsvc.ErrContentTooLong) || errors.Is(err, comment.ErrParentNotFound) ||
+			errors.Is(err, commentsvc.ErrInvalidLanguage) {
+			respond.Fail(c.Writer, http.StatusBadRequest, err)
+			return
+		}
+		if errors.Is(err, filter.ErrRejected) {
+			respond.Fail(c.Writer, http.StatusUnprocessableEntity, err)
+			return
+		}
+
 		respond.Fail(c.Writer, http.StatusInternalServerError, err)
 		return
 	}
@@ -78,34 +134,106 @@ func (h *Handler) Create(c *ginext.Context) {
 	respond.Created(c.Writer, res)
 }
 
-// GetTree retrieves the comment with the given ID and all nested descendants.
+// GetTree retrieves the comment with the given ID and its nested descendants.
+//
+// By default the whole subtree is returned as a flat list ordered by creation
+// time. With ?format=nested the assembled tree is returned instead. The query
+// param sort orders siblings by any mode of GetList, oldest first by default.
+// The query params max_depth, max_children_per_node and cursor limit the
+// loaded subtree and imply the nested format, whose truncated nodes carry a
+// next_cursor to load more of their replies.
 func (h *Handler) GetTree(c *ginext.Context) {
-	// Extract id from query params.
-	idStr := c.Param("id")
-	if idStr == "" {
-		zlog.Logger.Warn().Msg("parent id is required")
-		respond.Fail(c.Writer, http.StatusBadRequest, fmt.Errorf("parent id is required"))
+	id, ok := parseID(c)
+	if !ok {
 		return
 	}
-	id, err := uuid.Parse(idStr)
-	if err != nil {
-		zlog.Logger.Error().Err(err).Msg("failed to parse parent id")
-		respond.Fail(c.Writer, http.StatusBadRequest, fmt.Errorf("invalid parent id"))
+
+	var opts model.TreeOptions
+	var err error
+
+	if opts.MaxDepth, err = parseLimit(c, "max_depth"); err != nil {
+		respond.Fail(c.Writer, http.StatusBadRequest, err)
 		return
 	}
-
-	// Get comments.
-	comments, err := h.service.GetCommentsByParentID(c.Request.Context(), id)
-	if err != nil {
-		zlog.Logger.Error().Err(err).Msg("failed to get comments")
-		respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to get comments"))
+	if opts.MaxChildrenPerNode, err = parseLimit(c, "max_children_per_node"); err != nil {
+		respond.Fail(c.Writer, http.StatusBadRequest, err)
 		return
 	}
+	opts.Cursor = c.Query("cursor")
+	opts.Sort = c.Query("sort")
+	if thread, ok := c.GetQuery("thread"); ok {
+		opts.ThreadKey = &thread
+	}
 
-	respond.JSON(c.Writer, http.StatusOK, comments)
+	defaultFormat := formatFlat
+	if opts.Limited() {
+		defaultFormat = formatNested
+	}
+
+	switch format := c.DefaultQuery("format", defaultFormat); format {
+	case formatFlat:
+		if opts.Limited() {
+			respond.Fail(c.Writer, http.StatusBadRequest, fmt.Errorf("subtree limits require format=%s", formatNested))
+			return
+		}
+
+		// Get comments.
+		comments, err := h.service.GetCommentsByParentID(c.Request.Context(), id, opts)
+		if err != nil {
+			zlog.Logger.Error().Err(err).Msg("failed to get comments")
+			respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to get comments"))
+			return
+		}
+
+		respond.JSON(c.Writer, http.StatusOK, comments)
+	case formatNested:
+		tree, err := h.service.GetCommentTree(c.Request.Context(), id, opts)
+		if err != nil {
+			if errors.Is(err, cursor.ErrInvalid) {
+				respond.Fail(c.Writer, http.StatusBadRequest, err)
+				return
+			}
+
+			zlog.Logger.Error().Err(err).Msg("failed to get comment tree")
+			respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to get comments"))
+			return
+		}
+		if tree == nil {
+			respond.Fail(c.Writer, http.StatusNotFound, comment.ErrCommentNotFound)
+			return
+		}
+
+		respond.JSON(c.Writer, http.StatusOK, tree)
+	default:
+		respond.Fail(c.Writer, http.StatusBadRequest, fmt.Errorf("invalid format %q", format))
+	}
 }
 
-// GetList retrieves comments with pagination, sorting, and optional search.
+// parseLimit parses an optional positive integer query param.
+//
+// It returns 0 if the param is absent.
+func parseLimit(c *ginext.Context, name string) (int, error) {
+	str := c.Query(name)
+	if str == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(str)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid %s", name)
+	}
+
+	return n, nil
+}
+
+// GetList retrieves a page of comments with sorting and optional search.
+//
+// Pages are addressed by the opaque cursor from the next_cursor and
+// prev_cursor fields of the response; offset is kept as a legacy fallback
+// and ignored when a cursor is given. Query param mode picks how search
+// matches: fts (default) for full-text search, fuzzy for similar words and
+// prefix for words starting with the search terms. Search results carry
+// their ancestors and, with query param children, up to that many replies.
 func (h *Handler) GetList(c *ginext.Context) {
 	// Get query params.
 	parentIDStr := c.Query("parent")
@@ -120,50 +248,116 @@ func (h *Handler) GetList(c *ginext.Context) {
 		parentID = &id
 	}
 
-	search := c.Query("search")
-	sort := c.DefaultQuery("sort", "created_at_asc")
+	// Root listings are always scoped to a thread, the default one if none is given.
+	var threadKey *string
+	if thread, ok := c.GetQuery("thread"); ok || parentID == nil {
+		threadKey = &thread
+	}
 
-	limitStr := c.DefaultQuery("limit", "10")
-	offsetStr := c.DefaultQuery("offset", "0")
+	search := c.Query("search")
+	mode := c.Query("mode")
+	lang := c.Query("lang")
+	sort := c.Query("sort") // relevance for searches, newest first otherwise
 
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit <= 0 {
-		limit = 10
+	limit, err := parseLimit(c, "limit")
+	if err != nil {
+		respond.Fail(c.Writer, http.StatusBadRequest, err)
+		return
+	}
+	if limit == 0 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		respond.Fail(c.Writer, http.StatusBadRequest, fmt.Errorf("limit must be at most %d", maxListLimit))
+		return
 	}
 
+	offsetStr := c.DefaultQuery("offset", "0")
+
 	offset, err := strconv.Atoi(offsetStr)
 	if err != nil || offset < 0 {
 		offset = 0
 	}
 
-	comments, err := h.service.GetComments(c.Request.Context(), parentID, search, sort, limit, offset)
+	children, err := parseLimit(c, "children")
 	if err != nil {
+		respond.Fail(c.Writer, http.StatusBadRequest, err)
+		return
+	}
+	if children > maxContextChildren {
+		respond.Fail(c.Writer, http.StatusBadRequest, fmt.Errorf("children must be at most %d", maxContextChildren))
+		return
+	}
+
+	page, err := h.service.GetComments(c.Request.Context(), model.CommentQuery{
+		ParentID:   parentID,
+		ThreadKey:  threadKey,
+		Search:     search,
+		SearchMode: mode,
+		Language:   lang,
+		Children:   children,
+		Sort:       sort,
+		Limit:      limit,
+		Cursor:     c.Query("cursor"),
+		Offset:     offset,
+	})
+	if err != nil {
+		if errors.Is(err, cursor.ErrInvalid) || errors.Is(err, commentsvc.ErrInvalidLanguage) ||
+			errors.Is(err, commentsvc.ErrInvalidSearchMode) {
+			respond.Fail(c.Writer, http.StatusBadRequest, err)
+			return
+		}
+
 		zlog.Logger.Error().Err(err).Msg("failed to get comments")
 		respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to get comments"))
 		return
 	}
 
-	respond.JSON(c.Writer, http.StatusOK, comments)
+	respond.JSON(c.Writer, http.StatusOK, page)
 }
 
-// Delete deletes the comment with the given ID and all nested descendants.
-func (h *Handler) Delete(c *ginext.Context) {
-	// Extract id from query params.
-	idStr := c.Param("id")
-	if idStr == "" {
-		zlog.Logger.Warn().Msg("parent id is required")
-		respond.Fail(c.Writer, http.StatusBadRequest, fmt.Errorf("parent id is required"))
+// Autocomplete suggests searches completing the last word of query param q
+// with words used in comments, for search-as-you-type.
+//
+// Query param thread restricts the words to a thread; limit caps the number
+// of suggestions, 10 by default and at most 20.
+func (h *Handler) Autocomplete(c *ginext.Context) {
+	var threadKey *string
+	if thread, ok := c.GetQuery("thread"); ok {
+		threadKey = &thread
+	}
+
+	limit, err := parseLimit(c, "limit")
+	if err != nil {
+		respond.Fail(c.Writer, http.StatusBadRequest, err)
 		return
 	}
-	id, err := uuid.Parse(idStr)
+	if limit == 0 {
+		limit = defaultAutocompleteLimit
+	}
+	limit = min(limit, maxAutocompleteLimit)
+
+	suggestions, err := h.service.Autocomplete(c.Request.Context(), threadKey, c.Query("q"), limit)
 	if err != nil {
-		zlog.Logger.Error().Err(err).Msg("failed to parse parent id")
-		respond.Fail(c.Writer, http.StatusBadRequest, fmt.Errorf("invalid parent id"))
+		zlog.Logger.Error().Err(err).Msg("failed to autocomplete")
+		respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to autocomplete"))
+		return
+	}
+
+	respond.JSON(c.Writer, http.StatusOK, suggestions)
+}
+
+// Delete soft-deletes the comment with the given ID.
+//
+// The comment is replaced with a placeholder and its replies are kept.
+func (h *Handler) Delete(c *ginext.Context) {
+	id, ok := parseID(c)
+	if !ok {
 		return
 	}
 
 	// Delete comment.
-	err = h.service.DeleteComment(c.Request.Context(), id)
+	err := h.service.DeleteComment(c.Request.Context(), id)
 	if err != nil {
 		// If comment not found, return 404.
 		if errors.Is(err, comment.ErrCommentNotFound) {
@@ -171,6 +365,9 @@ func (h *Handler) Delete(c *ginext.Context) {
 			respond.Fail(c.Writer, http.StatusNotFound, err)
 			return
 		}
+		if failAuth(c, err) {
+			return
+		}
 
 		zlog.Logger.Error().Err(err).Msg("failed to delete comment")
 		respond.Fail(c.Writer, http.StatusInternalServerError, err)
@@ -179,3 +376,230 @@ func (h *Handler) Delete(c *ginext.Context) {
 
 	respond.OK(c.Writer, "comment deleted")
 }
+
+// Purge permanently deletes the comment with the given ID and all nested descendants.
+func (h *Handler) Purge(c *ginext.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	err := h.service.PurgeComment(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, comment.ErrCommentNotFound) {
+			respond.Fail(c.Writer, http.StatusNotFound, err)
+			return
+		}
+
+		zlog.Logger.Error().Err(err).Msg("failed to purge comment")
+		respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to purge comment"))
+		return
+	}
+
+	respond.OK(c.Writer, "comment purged")
+}
+
+// PurgeDeleted permanently deletes soft-deleted comments.
+//
+// The optional query param retention (e.g. 720h) keeps comments deleted more
+// recently than the given duration.
+func (h *Handler) PurgeDeleted(c *ginext.Context) {
+	retention, err := time.ParseDuration(c.DefaultQuery("retention", "0s"))
+	if err != nil || retention < 0 {
+		respond.Fail(c.Writer, http.StatusBadRequest, fmt.Errorf("invalid retention"))
+		return
+	}
+
+	n, err := h.service.PurgeDeleted(c.Request.Context(), retention)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Msg("failed to purge deleted comments")
+		respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to purge deleted comments"))
+		return
+	}
+
+	respond.OK(c.Writer, ginext.H{"purged": n})
+}
+
+// UpdateRequest is the request for the update comment API.
+type UpdateRequest struct {
+	Content string `json:"content" binding:"required,min=1"` // limited per tenant
+}
+
+// Update replaces the content of the comment with the given ID.
+//
+// The previous content is kept as a revision.
+func (h *Handler) Update(c *ginext.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	// Bind the request.
+	var req UpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Logger.Error().Err(err).Msg("failed to bind JSON")
+		respond.Fail(c.Writer, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := h.service.UpdateComment(c.Request.Context(), id, req.Content)
+	if err != nil {
+		if errors.Is(err, comment.ErrCommentNotFound) {
+			respond.Fail(c.Writer, http.StatusNotFound, err)
+			return
+		}
+		if errors.Is(err, commentsvc.ErrContentTooLong) {
+			respond.Fail(c.Writer, http.StatusBadRequest, err)
+			return
+		}
+		if errors.Is(err, filter.ErrRejected) {
+			respond.Fail(c.Writer, http.StatusUnprocessableEntity, err)
+			return
+		}
+		if failAuth(c, err) {
+			return
+		}
+
+		zlog.Logger.Error().Err(err).Msg("failed to update comment")
+		respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to update comment"))
+		return
+	}
+
+	respond.OK(c.Writer, res)
+}
+
+// Upvote sets the vote of the current user on the comment with the given ID to up.
+func (h *Handler) Upvote(c *ginext.Context) {
+	h.vote(c, model.VoteUp)
+}
+
+// Downvote sets the vote of the current user on the comment with the given ID to down.
+func (h *Handler) Downvote(c *ginext.Context) {
+	h.vote(c, model.VoteDown)
+}
+
+// Unvote withdraws the vote of the current user on the comment with the given ID.
+func (h *Handler) Unvote(c *ginext.Context) {
+	h.vote(c, model.VoteNone)
+}
+
+// vote sets the vote of the current user and responds with the updated comment.
+func (h *Handler) vote(c *ginext.Context, value int) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	res, err := h.service.Vote(c.Request.Context(), id, value)
+	if err != nil {
+		if errors.Is(err, comment.ErrCommentNotFound) {
+			respond.Fail(c.Writer, http.StatusNotFound, err)
+			return
+		}
+		if failAuth(c, err) {
+			return
+		}
+
+		zlog.Logger.Error().Err(err).Msg("failed to vote on comment")
+		respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to vote on comment"))
+		return
+	}
+
+	respond.OK(c.Writer, res)
+}
+
+// GetRevisions retrieves all versions of the comment with the given ID.
+func (h *Handler) GetRevisions(c *ginext.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	revisions, err := h.service.GetRevisions(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, comment.ErrCommentNotFound) {
+			respond.Fail(c.Writer, http.StatusNotFound, err)
+			return
+		}
+
+		zlog.Logger.Error().Err(err).Msg("failed to get revisions")
+		respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to get revisions"))
+		return
+	}
+
+	respond.OK(c.Writer, revisions)
+}
+
+// DiffRevisions returns the diff between two versions of the comment with the given ID.
+//
+// Query params from and to select the versions; they default to the previous
+// and the current version.
+func (h *Handler) DiffRevisions(c *ginext.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	from, err := strconv.Atoi(c.DefaultQuery("from", "0"))
+	if err != nil || from < 0 {
+		respond.Fail(c.Writer, http.StatusBadRequest, fmt.Errorf("invalid from version"))
+		return
+	}
+
+	to, err := strconv.Atoi(c.DefaultQuery("to", "0"))
+	if err != nil || to < 0 {
+		respond.Fail(c.Writer, http.StatusBadRequest, fmt.Errorf("invalid to version"))
+		return
+	}
+
+	diff, err := h.service.DiffRevisions(c.Request.Context(), id, from, to)
+	if err != nil {
+		if errors.Is(err, comment.ErrCommentNotFound) || errors.Is(err, commentsvc.ErrRevisionNotFound) {
+			respond.Fail(c.Writer, http.StatusNotFound, err)
+			return
+		}
+
+		zlog.Logger.Error().Err(err).Msg("failed to diff revisions")
+		respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to diff revisions"))
+		return
+	}
+
+	respond.OK(c.Writer, diff)
+}
+
+// failAuth writes a 401 or 403 response for authorization errors of the service.
+//
+// It reports whether err was such an error.
+func failAuth(c *ginext.Context, err error) bool {
+	switch {
+	case errors.Is(err, commentsvc.ErrUnauthenticated):
+		respond.Fail(c.Writer, http.StatusUnauthorized, err)
+	case errors.Is(err, commentsvc.ErrForbidden):
+		respond.Fail(c.Writer, http.StatusForbidden, err)
+	default:
+		return false
+	}
+
+	return true
+}
+
+// parseID extracts the comment ID from the path.
+//
+// It writes a 400 response and returns false if the ID is missing or invalid.
+func parseID(c *ginext.Context) (uuid.UUID, bool) {
+	idStr := c.Param("id")
+	if idStr == "" {
+		zlog.Logger.Warn().Msg("comment id is required")
+		respond.Fail(c.Writer, http.StatusBadRequest, fmt.Errorf("comment id is required"))
+		return uuid.Nil, false
+	}
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Msg("failed to parse comment id")
+		respond.Fail(c.Writer, http.StatusBadRequest, fmt.Errorf("invalid comment id"))
+		return uuid.Nil, false
+	}
+
+	return id, true
+}
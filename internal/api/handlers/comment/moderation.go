@@ -0,0 +1,148 @@
+package comment
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/wb-go/wbf/ginext"
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/aliskhannn/comment-tree/internal/api/respond"
+	"github.com/aliskhannn/comment-tree/internal/model"
+	commentsvc "github.com/aliskhannn/comment-tree/internal/service/comment"
+)
+
+// defaultQueueLimit is the number of comments of the moderation queue listed by default.
+const defaultQueueLimit = 50
+
+// ModerateRequest is the request for the bulk moderation API.
+type ModerateRequest struct {
+	IDs    []uuid.UUID `json:"ids" binding:"required,min=1,max=100"`
+	Status string      `json:"status" binding:"required"` // approved, rejected or spam
+	Reason string      `json:"reason" binding:"max=1000"`
+}
+
+// ThreadLanguageRequest is the request for the thread language API.
+type ThreadLanguageRequest struct {
+	Thread   string `json:"thread" binding:"max=2048"`
+	Language string `json:"language"` // e.g. "russian" or "ru", empty to use the tenant's language
+}
+
+// ThreadModerationRequest is the request for the thread moderation mode API.
+type ThreadModerationRequest struct {
+	Thread         string `json:"thread" binding:"max=2048"`
+	ModerationMode string `json:"moderation_mode"` // post, pre or empty to use the tenant's mode
+}
+
+// GetModerationQueue retrieves the comments awaiting a moderation decision, oldest first.
+//
+// Query params status (pending by default), thread, limit and offset filter
+// and page the queue.
+func (h *Handler) GetModerationQueue(c *ginext.Context) {
+	q := model.ModerationQuery{Status: c.Query("status")}
+	if thread, ok := c.GetQuery("thread"); ok {
+		q.ThreadKey = &thread
+	}
+
+	var err error
+	if q.Limit, err = strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultQueueLimit))); err != nil || q.Limit <= 0 {
+		respond.Fail(c.Writer, http.StatusBadRequest, fmt.Errorf("invalid limit"))
+		return
+	}
+	if q.Offset, err = strconv.Atoi(c.DefaultQuery("offset", "0")); err != nil || q.Offset < 0 {
+		respond.Fail(c.Writer, http.StatusBadRequest, fmt.Errorf("invalid offset"))
+		return
+	}
+
+	res, err := h.service.GetModerationQueue(c.Request.Context(), q)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Msg("failed to get moderation queue")
+		respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to get moderation queue"))
+		return
+	}
+
+	respond.OK(c.Writer, res)
+}
+
+// Moderate approves or rejects several comments at once, with an optional reason.
+//
+// It responds with the changed comments; unknown and deleted comments are skipped.
+func (h *Handler) Moderate(c *ginext.Context) {
+	var req ModerateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Logger.Error().Err(err).Msg("failed to bind JSON")
+		respond.Fail(c.Writer, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := h.service.ModerateComments(c.Request.Context(), model.ModerationDecision{
+		IDs:    req.IDs,
+		Status: req.Status,
+		Reason: req.Reason,
+	})
+	if err != nil {
+		if errors.Is(err, commentsvc.ErrInvalidStatus) {
+			respond.Fail(c.Writer, http.StatusBadRequest, err)
+			return
+		}
+		if failAuth(c, err) {
+			return
+		}
+
+		zlog.Logger.Error().Err(err).Msg("failed to moderate comments")
+		respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to moderate comments"))
+		return
+	}
+
+	respond.OK(c.Writer, res)
+}
+
+// SetThreadModeration overrides the moderation mode of the tenant for a thread.
+func (h *Handler) SetThreadModeration(c *ginext.Context) {
+	var req ThreadModerationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Logger.Error().Err(err).Msg("failed to bind JSON")
+		respond.Fail(c.Writer, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.service.SetThreadModerationMode(c.Request.Context(), req.Thread, req.ModerationMode); err != nil {
+		if errors.Is(err, commentsvc.ErrInvalidModerationMode) {
+			respond.Fail(c.Writer, http.StatusBadRequest, err)
+			return
+		}
+
+		zlog.Logger.Error().Err(err).Msg("failed to set thread moderation mode")
+		respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to set thread moderation mode"))
+		return
+	}
+
+	respond.OK(c.Writer, "thread moderation mode updated")
+}
+
+// SetThreadLanguage overrides the language of the tenant for new comments
+// and searches in a thread.
+func (h *Handler) SetThreadLanguage(c *ginext.Context) {
+	var req ThreadLanguageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Logger.Error().Err(err).Msg("failed to bind JSON")
+		respond.Fail(c.Writer, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.service.SetThreadLanguage(c.Request.Context(), req.Thread, req.Language); err != nil {
+		if errors.Is(err, commentsvc.ErrInvalidLanguage) {
+			respond.Fail(c.Writer, http.StatusBadRequest, err)
+			return
+		}
+
+		zlog.Logger.Error().Err(err).Msg("failed to set thread language")
+		respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to set thread language"))
+		return
+	}
+
+	respond.OK(c.Writer, "thread language updated")
+}
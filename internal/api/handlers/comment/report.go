@@ -0,0 +1,85 @@
+package comment
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/wb-go/wbf/ginext"
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/aliskhannn/comment-tree/internal/api/respond"
+	"github.com/aliskhannn/comment-tree/internal/repository/comment"
+	commentsvc "github.com/aliskhannn/comment-tree/internal/service/comment"
+)
+
+// defaultReportedLimit is the number of reported comments listed by default.
+const defaultReportedLimit = 50
+
+// ReportRequest is the request for the report comment API.
+type ReportRequest struct {
+	Reason  string `json:"reason" binding:"required"` // spam, harassment, hate, misinformation, off_topic or other
+	Details string `json:"details" binding:"max=1000"`
+}
+
+// Report reports the comment with the given ID on behalf of the current user.
+func (h *Handler) Report(c *ginext.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	var req ReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Logger.Error().Err(err).Msg("failed to bind JSON")
+		respond.Fail(c.Writer, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, err := h.service.ReportComment(c.Request.Context(), id, req.Reason, req.Details); err != nil {
+		switch {
+		case errors.Is(err, comment.ErrCommentNotFound):
+			respond.Fail(c.Writer, http.StatusNotFound, err)
+		case errors.Is(err, comment.ErrAlreadyReported):
+			respond.Fail(c.Writer, http.StatusConflict, err)
+		case errors.Is(err, commentsvc.ErrInvalidReportReason):
+			respond.Fail(c.Writer, http.StatusBadRequest, err)
+		default:
+			if failAuth(c, err) {
+				return
+			}
+
+			zlog.Logger.Error().Err(err).Msg("failed to report comment")
+			respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to report comment"))
+		}
+		return
+	}
+
+	respond.Created(c.Writer, "comment reported")
+}
+
+// GetReported retrieves the comments with open reports, most reported first.
+//
+// Query params limit and offset page the list.
+func (h *Handler) GetReported(c *ginext.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultReportedLimit)))
+	if err != nil || limit <= 0 {
+		respond.Fail(c.Writer, http.StatusBadRequest, fmt.Errorf("invalid limit"))
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		respond.Fail(c.Writer, http.StatusBadRequest, fmt.Errorf("invalid offset"))
+		return
+	}
+
+	res, err := h.service.GetReportedComments(c.Request.Context(), limit, offset)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Msg("failed to get reported comments")
+		respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to get reported comments"))
+		return
+	}
+
+	respond.OK(c.Writer, res)
+}
@@ -0,0 +1,242 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/wb-go/wbf/ginext"
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/aliskhannn/comment-tree/internal/api/respond"
+	"github.com/aliskhannn/comment-tree/internal/model"
+	notificationsvc "github.com/aliskhannn/comment-tree/internal/service/notification"
+)
+
+// defaultLimit is the number of notifications listed by default.
+const defaultLimit = 50
+
+// unsubscribeTemplate is the page of unsubscribe links. Links only unsubscribe
+// when the form is submitted, so that link scanners opening them do not.
+var unsubscribeTemplate = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Unsubscribe</title></head>
+<body style="font-family: sans-serif;">
+{{if .Done}}<p>You are unsubscribed and will get no more notification emails.</p>
+{{else if .Invalid}}<p>This unsubscribe link is invalid.</p>
+{{else}}<form method="post">
+<p>Stop getting notification emails?</p>
+<input type="hidden" name="token" value="{{.Token}}">
+<button type="submit">Unsubscribe</button>
+</form>
+{{end}}</body>
+</html>
+`))
+
+// Service manages the notifications of the current user.
+type Service interface {
+	GetNotifications(ctx context.Context, q model.NotificationQuery) (model.NotificationPage, error)
+	MarkRead(ctx context.Context, ids []uuid.UUID) (int, error)
+	GetPreferences(ctx context.Context) (model.NotificationPreferences, error)
+	SetDelivery(ctx context.Context, delivery string) (model.NotificationPreferences, error)
+	Unsubscribe(ctx context.Context, token string) error
+}
+
+// MarkReadRequest is the request for marking several notifications as read.
+type MarkReadRequest struct {
+	IDs []uuid.UUID `json:"ids" binding:"max=100"` // all notifications if omitted
+}
+
+// PreferencesRequest is the request for the notification preferences API.
+type PreferencesRequest struct {
+	Delivery string `json:"delivery" binding:"required"` // instant, hourly, daily or off
+}
+
+// UnreadResponse is the response of the mark-as-read API.
+type UnreadResponse struct {
+	Unread int `json:"unread"`
+}
+
+// Handler handles the notification API.
+type Handler struct {
+	service Service
+}
+
+// NewHandler creates a new Handler.
+func NewHandler(service Service) *Handler {
+	return &Handler{
+		service: service,
+	}
+}
+
+// List retrieves the notifications of the current user, newest first, with
+// the number of unread ones.
+//
+// Query param unread=true lists only unread notifications; limit and offset
+// page the list.
+func (h *Handler) List(c *ginext.Context) {
+	var (
+		q   model.NotificationQuery
+		err error
+	)
+	if q.UnreadOnly, err = strconv.ParseBool(c.DefaultQuery("unread", "false")); err != nil {
+		respond.Fail(c.Writer, http.StatusBadRequest, fmt.Errorf("invalid unread"))
+		return
+	}
+	if q.Limit, err = strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLimit))); err != nil || q.Limit <= 0 {
+		respond.Fail(c.Writer, http.StatusBadRequest, fmt.Errorf("invalid limit"))
+		return
+	}
+	if q.Offset, err = strconv.Atoi(c.DefaultQuery("offset", "0")); err != nil || q.Offset < 0 {
+		respond.Fail(c.Writer, http.StatusBadRequest, fmt.Errorf("invalid offset"))
+		return
+	}
+
+	res, err := h.service.GetNotifications(c.Request.Context(), q)
+	if err != nil {
+		if errors.Is(err, notificationsvc.ErrUnauthenticated) {
+			respond.Fail(c.Writer, http.StatusUnauthorized, err)
+			return
+		}
+
+		zlog.Logger.Error().Err(err).Msg("failed to get notifications")
+		respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to get notifications"))
+		return
+	}
+
+	respond.OK(c.Writer, res)
+}
+
+// MarkRead marks the notification with the given ID as read. It responds
+// with the number of unread notifications left.
+func (h *Handler) MarkRead(c *ginext.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		zlog.Logger.Error().Err(err).Msg("failed to parse id")
+		respond.Fail(c.Writer, http.StatusBadRequest, fmt.Errorf("invalid id"))
+		return
+	}
+
+	h.markRead(c, []uuid.UUID{id})
+}
+
+// MarkManyRead marks the notifications with the given IDs as read, or all
+// notifications of the current user if no IDs are given. It responds with
+// the number of unread notifications left.
+func (h *Handler) MarkManyRead(c *ginext.Context) {
+	var req MarkReadRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			zlog.Logger.Error().Err(err).Msg("failed to bind JSON")
+			respond.Fail(c.Writer, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	h.markRead(c, req.IDs)
+}
+
+// markRead marks notifications as read and writes the response.
+func (h *Handler) markRead(c *ginext.Context, ids []uuid.UUID) {
+	unread, err := h.service.MarkRead(c.Request.Context(), ids)
+	if err != nil {
+		if errors.Is(err, notificationsvc.ErrUnauthenticated) {
+			respond.Fail(c.Writer, http.StatusUnauthorized, err)
+			return
+		}
+
+		zlog.Logger.Error().Err(err).Msg("failed to mark notifications as read")
+		respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to mark notifications as read"))
+		return
+	}
+
+	respond.OK(c.Writer, UnreadResponse{Unread: unread})
+}
+
+// GetPreferences retrieves the email preferences of the current user.
+func (h *Handler) GetPreferences(c *ginext.Context) {
+	res, err := h.service.GetPreferences(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, notificationsvc.ErrUnauthenticated) {
+			respond.Fail(c.Writer, http.StatusUnauthorized, err)
+			return
+		}
+
+		zlog.Logger.Error().Err(err).Msg("failed to get notification preferences")
+		respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to get notification preferences"))
+		return
+	}
+
+	respond.OK(c.Writer, res)
+}
+
+// SetPreferences sets the email delivery mode of the current user.
+func (h *Handler) SetPreferences(c *ginext.Context) {
+	var req PreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Logger.Error().Err(err).Msg("failed to bind JSON")
+		respond.Fail(c.Writer, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := h.service.SetDelivery(c.Request.Context(), req.Delivery)
+	if err != nil {
+		switch {
+		case errors.Is(err, notificationsvc.ErrUnauthenticated):
+			respond.Fail(c.Writer, http.StatusUnauthorized, err)
+		case errors.Is(err, notificationsvc.ErrInvalidDelivery):
+			respond.Fail(c.Writer, http.StatusBadRequest, err)
+		case errors.Is(err, notificationsvc.ErrNoEmail):
+			respond.Fail(c.Writer, http.StatusUnprocessableEntity, err)
+		default:
+			zlog.Logger.Error().Err(err).Msg("failed to save notification preferences")
+			respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to save notification preferences"))
+		}
+		return
+	}
+
+	respond.OK(c.Writer, res)
+}
+
+// UnsubscribeForm shows the page of an unsubscribe link with the token in
+// the query, asking to confirm.
+func (h *Handler) UnsubscribeForm(c *ginext.Context) {
+	token := c.Query("token")
+	h.unsubscribePage(c, http.StatusOK, map[string]any{"Token": token, "Invalid": token == ""})
+}
+
+// Unsubscribe turns off the notification emails of the user named by the
+// token in the query or form. Mail clients post here for one-click
+// unsubscribes.
+func (h *Handler) Unsubscribe(c *ginext.Context) {
+	token := c.Query("token")
+	if token == "" {
+		token = c.PostForm("token")
+	}
+
+	if err := h.service.Unsubscribe(c.Request.Context(), token); err != nil {
+		if errors.Is(err, notificationsvc.ErrInvalidUnsubscribeToken) {
+			h.unsubscribePage(c, http.StatusBadRequest, map[string]any{"Invalid": true})
+			return
+		}
+
+		zlog.Logger.Error().Err(err).Msg("failed to unsubscribe")
+		respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to unsubscribe"))
+		return
+	}
+
+	h.unsubscribePage(c, http.StatusOK, map[string]any{"Done": true})
+}
+
+// unsubscribePage writes the unsubscribe page.
+func (h *Handler) unsubscribePage(c *ginext.Context, status int, data map[string]any) {
+	c.Writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	c.Writer.WriteHeader(status)
+	if err := unsubscribeTemplate.Execute(c.Writer, data); err != nil {
+		zlog.Logger.Error().Err(err).Msg("failed to write unsubscribe page")
+	}
+}
@@ -0,0 +1,75 @@
+package reaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/wb-go/wbf/ginext"
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/aliskhannn/comment-tree/internal/api/respond"
+	"github.com/aliskhannn/comment-tree/internal/model"
+	"github.com/aliskhannn/comment-tree/internal/repository/reaction"
+	reactionsvc "github.com/aliskhannn/comment-tree/internal/service/reaction"
+)
+
+// Service manages emoji reactions on comments.
+type Service interface {
+	React(ctx context.Context, commentID uuid.UUID, emoji string) ([]model.Reaction, error)
+	Unreact(ctx context.Context, commentID uuid.UUID, emoji string) ([]model.Reaction, error)
+}
+
+// Handler handles the reaction API.
+type Handler struct {
+	service Service
+}
+
+// NewHandler creates a new Handler.
+func NewHandler(service Service) *Handler {
+	return &Handler{
+		service: service,
+	}
+}
+
+// React adds the reaction of the current user with the emoji in the path to
+// the comment with the given ID. It responds with the reactions of the comment.
+func (h *Handler) React(c *ginext.Context) {
+	h.change(c, h.service.React)
+}
+
+// Unreact removes the reaction of the current user with the emoji in the path
+// from the comment with the given ID. It responds with the reactions of the comment.
+func (h *Handler) Unreact(c *ginext.Context) {
+	h.change(c, h.service.Unreact)
+}
+
+// change applies a reaction change of the service and writes the response.
+func (h *Handler) change(c *ginext.Context, apply func(context.Context, uuid.UUID, string) ([]model.Reaction, error)) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		zlog.Logger.Error().Err(err).Msg("failed to parse id")
+		respond.Fail(c.Writer, http.StatusBadRequest, fmt.Errorf("invalid id"))
+		return
+	}
+
+	res, err := apply(c.Request.Context(), id, c.Param("emoji"))
+	if err != nil {
+		switch {
+		case errors.Is(err, reaction.ErrCommentNotFound):
+			respond.Fail(c.Writer, http.StatusNotFound, err)
+		case errors.Is(err, reactionsvc.ErrUnknownEmoji):
+			respond.Fail(c.Writer, http.StatusBadRequest, err)
+		case errors.Is(err, reactionsvc.ErrUnauthenticated):
+			respond.Fail(c.Writer, http.StatusUnauthorized, err)
+		default:
+			zlog.Logger.Error().Err(err).Msg("failed to change reaction")
+			respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to change reaction"))
+		}
+		return
+	}
+
+	respond.OK(c.Writer, res)
+}
@@ -0,0 +1,177 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wb-go/wbf/ginext"
+	"github.com/wb-go/wbf/zlog"
+	"golang.org/x/net/websocket"
+
+	"github.com/aliskhannn/comment-tree/internal/api/respond"
+	"github.com/aliskhannn/comment-tree/internal/model"
+	"github.com/aliskhannn/comment-tree/internal/realtime"
+	"github.com/aliskhannn/comment-tree/internal/tenant"
+)
+
+// Subscriber provides the comment events of a tenant.
+type Subscriber interface {
+	Subscribe(ctx context.Context, tenantID, lastEventID string) (<-chan model.Event, error)
+}
+
+// Handler streams comment events to clients.
+type Handler struct {
+	subscriber Subscriber
+	heartbeat  time.Duration
+}
+
+// NewHandler creates a new Handler.
+//
+// SSE clients receive a comment line every heartbeat to keep idle
+// connections open; a non-positive heartbeat disables it.
+func NewHandler(subscriber Subscriber, heartbeat time.Duration) *Handler {
+	return &Handler{
+		subscriber: subscriber,
+		heartbeat:  heartbeat,
+	}
+}
+
+// Stream pushes the created, updated and deleted events of the subtree of the
+// comment with the given ID.
+//
+// WebSocket upgrade requests receive one JSON event per message; all other
+// requests receive Server-Sent Events. Clients resume after the event given
+// in the Last-Event-ID header or the last_event_id query param.
+func (h *Handler) Stream(c *ginext.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		zlog.Logger.Error().Err(err).Msg("failed to parse comment id")
+		respond.Fail(c.Writer, http.StatusBadRequest, fmt.Errorf("invalid comment id"))
+		return
+	}
+
+	tenantID, err := tenant.IDFromContext(c.Request.Context())
+	if err != nil {
+		respond.Fail(c.Writer, http.StatusInternalServerError, err)
+		return
+	}
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+
+	// Hijacked WebSocket connections outlive the request context, so the
+	// subscription is cancelled explicitly.
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	events, err := h.subscriber.Subscribe(ctx, tenantID, lastEventID)
+	if err != nil {
+		if errors.Is(err, realtime.ErrInvalidEventID) {
+			respond.Fail(c.Writer, http.StatusBadRequest, err)
+			return
+		}
+
+		zlog.Logger.Error().Err(err).Msg("failed to subscribe to comment events")
+		respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to subscribe to comment events"))
+		return
+	}
+
+	if strings.EqualFold(c.GetHeader("Upgrade"), "websocket") {
+		h.serveWebSocket(ctx, cancel, c, id, events)
+		return
+	}
+
+	h.serveSSE(ctx, c, id, events)
+}
+
+// serveSSE writes the events of the subtree of id as Server-Sent Events.
+func (h *Handler) serveSSE(ctx context.Context, c *ginext.Context, id uuid.UUID, events <-chan model.Event) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // disable proxy buffering
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	var heartbeat <-chan time.Time
+	if h.heartbeat > 0 {
+		ticker := time.NewTicker(h.heartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat:
+			if _, err := fmt.Fprint(c.Writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			if !e.InSubtree(id) {
+				continue
+			}
+
+			data, err := json.Marshal(e)
+			if err != nil {
+				zlog.Logger.Error().Err(err).Str("id", e.ID).Msg("failed to encode event")
+				continue
+			}
+			if _, err := fmt.Fprintf(c.Writer, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data); err != nil {
+				return
+			}
+		}
+
+		c.Writer.Flush()
+	}
+}
+
+// serveWebSocket upgrades the connection and sends the events of the subtree
+// of id as JSON messages.
+func (h *Handler) serveWebSocket(ctx context.Context, cancel context.CancelFunc, c *ginext.Context, id uuid.UUID, events <-chan model.Event) {
+	// Origins are checked by the CORS and tenant middlewares.
+	srv := websocket.Server{
+		Handler: func(ws *websocket.Conn) {
+			// Clients send nothing; reading only detects when they go away.
+			go func() {
+				defer cancel()
+
+				var msg []byte
+				for websocket.Message.Receive(ws, &msg) == nil {
+				}
+			}()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case e, ok := <-events:
+					if !ok {
+						return
+					}
+					if !e.InSubtree(id) {
+						continue
+					}
+
+					if err := websocket.JSON.Send(ws, e); err != nil {
+						return
+					}
+				}
+			}
+		},
+	}
+
+	srv.ServeHTTP(c.Writer, c.Request)
+}
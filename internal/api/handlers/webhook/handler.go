@@ -0,0 +1,245 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/wb-go/wbf/ginext"
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/aliskhannn/comment-tree/internal/api/respond"
+	"github.com/aliskhannn/comment-tree/internal/model"
+	"github.com/aliskhannn/comment-tree/internal/repository/webhook"
+	webhooksvc "github.com/aliskhannn/comment-tree/internal/service/webhook"
+)
+
+// defaultDeadLimit is the number of dead deliveries listed by default.
+const defaultDeadLimit = 50
+
+// Service manages webhook subscriptions and deliveries.
+type Service interface {
+	CreateWebhook(ctx context.Context, w *model.Webhook) (model.Webhook, error)
+	GetWebhooks(ctx context.Context) ([]model.Webhook, error)
+	GetWebhook(ctx context.Context, id uuid.UUID) (model.Webhook, error)
+	UpdateWebhook(ctx context.Context, w *model.Webhook) (model.Webhook, error)
+	DeleteWebhook(ctx context.Context, id uuid.UUID) error
+	GetDeadDeliveries(ctx context.Context, limit int) ([]model.WebhookDelivery, error)
+	RetryDelivery(ctx context.Context, id uuid.UUID) error
+}
+
+// Handler handles the webhook admin API.
+type Handler struct {
+	service Service
+}
+
+// NewHandler creates a new Handler.
+func NewHandler(service Service) *Handler {
+	return &Handler{
+		service: service,
+	}
+}
+
+// Request is the request for the create and update webhook APIs.
+type Request struct {
+	URL    string   `json:"url" binding:"required"`
+	Secret string   `json:"secret"` // create only; generated if empty
+	Events []string `json:"events"` // empty subscribes to all events
+	Active *bool    `json:"active"` // defaults to true
+}
+
+// webhook converts the request to a webhook.
+func (r Request) webhook() *model.Webhook {
+	w := &model.Webhook{URL: r.URL, Secret: r.Secret, Events: r.Events, Active: true}
+	if w.Events == nil {
+		w.Events = []string{}
+	}
+	if r.Active != nil {
+		w.Active = *r.Active
+	}
+	return w
+}
+
+// Create creates a new webhook subscription. The response holds the signing secret.
+func (h *Handler) Create(c *ginext.Context) {
+	var req Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Logger.Error().Err(err).Msg("failed to bind JSON")
+		respond.Fail(c.Writer, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := h.service.CreateWebhook(c.Request.Context(), req.webhook())
+	if err != nil {
+		if failValidation(c, err) {
+			return
+		}
+
+		zlog.Logger.Error().Err(err).Msg("failed to create webhook")
+		respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to create webhook"))
+		return
+	}
+
+	respond.Created(c.Writer, res)
+}
+
+// List retrieves all webhook subscriptions.
+func (h *Handler) List(c *ginext.Context) {
+	res, err := h.service.GetWebhooks(c.Request.Context())
+	if err != nil {
+		zlog.Logger.Error().Err(err).Msg("failed to get webhooks")
+		respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to get webhooks"))
+		return
+	}
+
+	respond.OK(c.Writer, res)
+}
+
+// Get retrieves the webhook subscription with the given ID.
+func (h *Handler) Get(c *ginext.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	res, err := h.service.GetWebhook(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, webhook.ErrWebhookNotFound) {
+			respond.Fail(c.Writer, http.StatusNotFound, err)
+			return
+		}
+
+		zlog.Logger.Error().Err(err).Msg("failed to get webhook")
+		respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to get webhook"))
+		return
+	}
+
+	respond.OK(c.Writer, res)
+}
+
+// Update replaces the URL, events and active flag of the webhook subscription with the given ID.
+func (h *Handler) Update(c *ginext.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	var req Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		zlog.Logger.Error().Err(err).Msg("failed to bind JSON")
+		respond.Fail(c.Writer, http.StatusBadRequest, err)
+		return
+	}
+
+	w := req.webhook()
+	w.ID = id
+
+	res, err := h.service.UpdateWebhook(c.Request.Context(), w)
+	if err != nil {
+		if errors.Is(err, webhook.ErrWebhookNotFound) {
+			respond.Fail(c.Writer, http.StatusNotFound, err)
+			return
+		}
+		if failValidation(c, err) {
+			return
+		}
+
+		zlog.Logger.Error().Err(err).Msg("failed to update webhook")
+		respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to update webhook"))
+		return
+	}
+
+	respond.OK(c.Writer, res)
+}
+
+// Delete deletes the webhook subscription with the given ID.
+func (h *Handler) Delete(c *ginext.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteWebhook(c.Request.Context(), id); err != nil {
+		if errors.Is(err, webhook.ErrWebhookNotFound) {
+			respond.Fail(c.Writer, http.StatusNotFound, err)
+			return
+		}
+
+		zlog.Logger.Error().Err(err).Msg("failed to delete webhook")
+		respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to delete webhook"))
+		return
+	}
+
+	respond.OK(c.Writer, "webhook deleted")
+}
+
+// ListDead retrieves the dead-letter list of deliveries that kept failing.
+//
+// Query param limit caps the number of deliveries, newest first.
+func (h *Handler) ListDead(c *ginext.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultDeadLimit)))
+	if err != nil || limit <= 0 {
+		respond.Fail(c.Writer, http.StatusBadRequest, fmt.Errorf("invalid limit"))
+		return
+	}
+
+	res, err := h.service.GetDeadDeliveries(c.Request.Context(), limit)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Msg("failed to get dead webhook deliveries")
+		respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to get dead webhook deliveries"))
+		return
+	}
+
+	respond.OK(c.Writer, res)
+}
+
+// Retry queues the dead delivery with the given ID again.
+func (h *Handler) Retry(c *ginext.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.RetryDelivery(c.Request.Context(), id); err != nil {
+		if errors.Is(err, webhook.ErrDeliveryNotFound) {
+			respond.Fail(c.Writer, http.StatusNotFound, err)
+			return
+		}
+
+		zlog.Logger.Error().Err(err).Msg("failed to retry webhook delivery")
+		respond.Fail(c.Writer, http.StatusInternalServerError, fmt.Errorf("failed to retry webhook delivery"))
+		return
+	}
+
+	respond.OK(c.Writer, "delivery queued")
+}
+
+// failValidation writes a 400 response for validation errors of the service.
+//
+// It reports whether err was such an error.
+func failValidation(c *ginext.Context, err error) bool {
+	if errors.Is(err, webhooksvc.ErrInvalidURL) || errors.Is(err, webhooksvc.ErrForbiddenDestination) ||
+		errors.Is(err, webhooksvc.ErrUnknownEvent) {
+		respond.Fail(c.Writer, http.StatusBadRequest, err)
+		return true
+	}
+
+	return false
+}
+
+// parseID extracts the ID from the path.
+//
+// It writes a 400 response and returns false if the ID is invalid.
+func parseID(c *ginext.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		zlog.Logger.Error().Err(err).Msg("failed to parse id")
+		respond.Fail(c.Writer, http.StatusBadRequest, fmt.Errorf("invalid id"))
+		return uuid.Nil, false
+	}
+
+	return id, true
+}
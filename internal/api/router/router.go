@@ -1,27 +1,106 @@
 package router
 
 import (
+	"fmt"
+
 	"github.com/wb-go/wbf/ginext"
 
 	"github.com/aliskhannn/comment-tree/internal/api/handlers/comment"
+	"github.com/aliskhannn/comment-tree/internal/api/handlers/notification"
+	"github.com/aliskhannn/comment-tree/internal/api/handlers/reaction"
+	"github.com/aliskhannn/comment-tree/internal/api/handlers/stream"
+	"github.com/aliskhannn/comment-tree/internal/api/handlers/webhook"
+	"github.com/aliskhannn/comment-tree/internal/auth"
+	"github.com/aliskhannn/comment-tree/internal/idempotency"
 	"github.com/aliskhannn/comment-tree/internal/middleware"
+	"github.com/aliskhannn/comment-tree/internal/ratelimit"
+	"github.com/aliskhannn/comment-tree/internal/tenant"
 )
 
 // New creates a new Gin engine with routes and middlewares for the comment API.
-func New(handler *comment.Handler) *ginext.Engine {
+//
+// Client IPs are only taken from X-Forwarded-For and X-Real-IP headers set by
+// the trusted proxies, given as IPs or CIDRs; without any the peer address is
+// used.
+func New(
+	handler *comment.Handler,
+	streamHandler *stream.Handler,
+	webhookHandler *webhook.Handler,
+	reactionHandler *reaction.Handler,
+	notificationHandler *notification.Handler,
+	authenticator *auth.Authenticator, tenants *tenant.Registry,
+	limiter *ratelimit.Limiter, rateLimits ratelimit.Budgets, comments middleware.CommentGetter,
+	idempotencyStore *idempotency.Store,
+	trustedProxies []string,
+) (*ginext.Engine, error) {
 	e := ginext.New()
+	if err := e.SetTrustedProxies(trustedProxies); err != nil {
+		return nil, fmt.Errorf("failed to set trusted proxies: %w", err)
+	}
 
-	e.Use(middleware.CORSMiddleware())
+	e.Use(middleware.CORSMiddleware(tenants))
 	e.Use(ginext.Logger())
 	e.Use(ginext.Recovery())
+	e.Use(middleware.AuthMiddleware(authenticator))
+	e.Use(middleware.TenantMiddleware(tenants))
+	e.Use(middleware.RateLimitMiddleware(limiter, rateLimits, comments))
 
 	{
 		api := e.Group("/api/comments")
-		api.POST("/", handler.Create)
+		api.POST("/", middleware.RequireAuth(), middleware.IdempotencyMiddleware(idempotencyStore), handler.Create)
 		api.GET("/:id", handler.GetTree)
-		api.GET("/", handler.GetList) // with query params ?parent=&search=&limit=&offset
-		api.DELETE("/:id", handler.Delete)
+		api.GET("/", handler.GetList)                  // with query params ?parent=&search=&mode=&lang=&sort=&limit=&offset
+		api.GET("/autocomplete", handler.Autocomplete) // with query params ?q=&thread=&limit=
+		api.PUT("/:id", middleware.RequireAuth(), handler.Update)
+		api.PATCH("/:id", middleware.RequireAuth(), handler.Update)
+		api.DELETE("/:id", middleware.RequireAuth(), handler.Delete)
+		api.POST("/:id/upvote", middleware.RequireAuth(), handler.Upvote)
+		api.POST("/:id/downvote", middleware.RequireAuth(), handler.Downvote)
+		api.DELETE("/:id/vote", middleware.RequireAuth(), handler.Unvote)
+		api.POST("/:id/reports", middleware.RequireAuth(), handler.Report)
+		api.POST("/:id/reactions/:emoji", middleware.RequireAuth(), reactionHandler.React)
+		api.DELETE("/:id/reactions/:emoji", middleware.RequireAuth(), reactionHandler.Unreact)
+		api.GET("/:id/revisions", handler.GetRevisions)
+		api.GET("/:id/revisions/diff", handler.DiffRevisions) // with query params ?from=&to=
+		api.GET("/:id/stream", streamHandler.Stream)          // SSE or WebSocket, with query param ?last_event_id=
+	}
+
+	{
+		notifications := e.Group("/api/notifications")
+		notifications.GET("/", middleware.RequireAuth(), notificationHandler.List) // with query params ?unread=&limit=&offset=
+		notifications.POST("/read", middleware.RequireAuth(), notificationHandler.MarkManyRead)
+		notifications.POST("/:id/read", middleware.RequireAuth(), notificationHandler.MarkRead)
+		notifications.GET("/preferences", middleware.RequireAuth(), notificationHandler.GetPreferences)
+		notifications.PUT("/preferences", middleware.RequireAuth(), notificationHandler.SetPreferences)
+		notifications.GET("/unsubscribe", notificationHandler.UnsubscribeForm) // with query param ?token=
+		notifications.POST("/unsubscribe", notificationHandler.Unsubscribe)
+	}
+
+	{
+		admin := e.Group("/api/admin/comments", middleware.RequireModerator())
+		admin.POST("/purge", handler.PurgeDeleted) // with query param ?retention=
+		admin.DELETE("/:id", handler.Purge)
+		admin.GET("/queue", handler.GetModerationQueue) // with query params ?status=&thread=&limit=&offset=
+		admin.POST("/moderate", handler.Moderate)
+		admin.GET("/reported", handler.GetReported) // with query params ?limit=&offset=
+
+		threads := e.Group("/api/admin/threads", middleware.RequireModerator())
+		threads.PUT("/moderation", handler.SetThreadModeration)
+		threads.PUT("/language", handler.SetThreadLanguage)
+	}
+
+	{
+		webhooks := e.Group("/api/admin/webhooks", middleware.RequireModerator())
+		webhooks.POST("/", webhookHandler.Create)
+		webhooks.GET("/", webhookHandler.List)
+		webhooks.GET("/:id", webhookHandler.Get)
+		webhooks.PUT("/:id", webhookHandler.Update)
+		webhooks.DELETE("/:id", webhookHandler.Delete)
+
+		deliveries := e.Group("/api/admin/webhook-deliveries", middleware.RequireModerator())
+		deliveries.GET("/dead", webhookHandler.ListDead) // with query param ?limit=
+		deliveries.POST("/:id/retry", webhookHandler.Retry)
 	}
 
-	return e
+	return e, nil
 }
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/aliskhannn/comment-tree/internal/model"
+)
+
+// ErrInvalidAPIKey is returned when an API key is not known.
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// APIKeyHeader is the header carrying a static API key.
+const APIKeyHeader = "X-API-Key"
+
+// APIKey is a static API key and the user it authenticates.
+type APIKey struct {
+	Key  string
+	User model.User
+}
+
+// Authenticator resolves the caller of a request from a bearer JWT or a static API key.
+type Authenticator struct {
+	jwt     *JWTVerifier
+	apiKeys []APIKey
+}
+
+// NewAuthenticator creates a new Authenticator.
+//
+// A nil verifier disables JWT authentication.
+func NewAuthenticator(jwt *JWTVerifier, apiKeys []APIKey) *Authenticator {
+	return &Authenticator{jwt: jwt, apiKeys: apiKeys}
+}
+
+// Authenticate returns the user identified by the request credentials.
+//
+// It reports false if the request carries no credentials, and an error if
+// the credentials are invalid.
+func (a *Authenticator) Authenticate(r *http.Request) (model.User, bool, error) {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		user, err := a.authenticateAPIKey(key)
+		return user, err == nil, err
+	}
+
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return model.User{}, false, nil
+	}
+
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || a.jwt == nil {
+		return model.User{}, false, ErrInvalidToken
+	}
+
+	user, err := a.jwt.Verify(strings.TrimSpace(token))
+	return user, err == nil, err
+}
+
+// authenticateAPIKey returns the user of a static API key.
+func (a *Authenticator) authenticateAPIKey(key string) (model.User, error) {
+	// Compare against every key in constant time so the timing does not
+	// reveal how much of a key matched.
+	var (
+		user  model.User
+		found bool
+	)
+	for _, k := range a.apiKeys {
+		if subtle.ConstantTimeCompare([]byte(k.Key), []byte(key)) == 1 {
+			user, found = k.User, true
+		}
+	}
+
+	if !found {
+		return model.User{}, ErrInvalidAPIKey
+	}
+
+	return user, nil
+}
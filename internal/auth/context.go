@@ -0,0 +1,21 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/aliskhannn/comment-tree/internal/model"
+)
+
+// userKey is the context key of the authenticated user.
+type userKey struct{}
+
+// WithUser returns a copy of ctx carrying the authenticated user.
+func WithUser(ctx context.Context, user model.User) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFromContext returns the authenticated user carried by ctx, if any.
+func UserFromContext(ctx context.Context) (model.User, bool) {
+	user, ok := ctx.Value(userKey{}).(model.User)
+	return user, ok
+}
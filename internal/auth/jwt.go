@@ -0,0 +1,244 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256" // registers SHA-256 for crypto.Hash
+	_ "crypto/sha512" // registers SHA-384 and SHA-512 for crypto.Hash
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aliskhannn/comment-tree/internal/model"
+)
+
+// ErrInvalidToken is returned when a token is malformed, badly signed or expired.
+var ErrInvalidToken = errors.New("invalid token")
+
+// JWTVerifier verifies HMAC (HS256/384/512) and RSA (RS256/384/512) signed JWTs.
+type JWTVerifier struct {
+	hmacSecret []byte
+	rsaKey     *rsa.PublicKey
+	issuer     string
+	audience   string
+	now        func() time.Time
+}
+
+// NewJWTVerifier creates a new JWTVerifier.
+//
+// Either key may be empty, which disables the corresponding algorithms.
+// rsaPublicKeyPEM holds a PKIX or PKCS #1 encoded public key. Empty issuer
+// and audience are not checked.
+func NewJWTVerifier(hmacSecret, rsaPublicKeyPEM, issuer, audience string) (*JWTVerifier, error) {
+	v := &JWTVerifier{
+		hmacSecret: []byte(hmacSecret),
+		issuer:     issuer,
+		audience:   audience,
+		now:        time.Now,
+	}
+
+	if rsaPublicKeyPEM != "" {
+		key, err := parseRSAPublicKey(rsaPublicKeyPEM)
+		if err != nil {
+			return nil, err
+		}
+		v.rsaKey = key
+	}
+
+	return v, nil
+}
+
+// claims are the JWT claims understood by the verifier.
+type claims struct {
+	Subject   string   `json:"sub"`
+	Name      string   `json:"name"`
+	Username  string   `json:"preferred_username"`
+	Email     string   `json:"email"`
+	Role      string   `json:"role"`
+	Tenant    string   `json:"tenant"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+}
+
+// audience is the aud claim, which may be a string or an array of strings.
+type audience []string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+
+	return nil
+}
+
+// Verify checks the token signature and claims and returns the user it identifies.
+//
+// The user is taken from the sub, name, preferred_username, email, role and
+// tenant claims; the role defaults to model.RoleUser.
+func (v *JWTVerifier) Verify(token string) (model.User, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return model.User{}, ErrInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return model.User{}, ErrInvalidToken
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return model.User{}, ErrInvalidToken
+	}
+
+	if err := v.verifySignature(header.Alg, parts[0]+"."+parts[1], sig); err != nil {
+		return model.User{}, err
+	}
+
+	var c claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return model.User{}, ErrInvalidToken
+	}
+
+	if err := v.validate(c); err != nil {
+		return model.User{}, err
+	}
+
+	role := c.Role
+	if role == "" {
+		role = model.RoleUser
+	}
+
+	return model.User{ID: c.Subject, Name: c.Name, Username: c.Username, Email: c.Email, Role: role, TenantID: c.Tenant}, nil
+}
+
+// algorithms maps the supported JWT algorithms to their hash functions.
+var algorithms = map[string]crypto.Hash{
+	"HS256": crypto.SHA256,
+	"HS384": crypto.SHA384,
+	"HS512": crypto.SHA512,
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+}
+
+// verifySignature checks sig over the signing input with the given algorithm.
+func (v *JWTVerifier) verifySignature(alg, input string, sig []byte) error {
+	hashType, ok := algorithms[alg]
+	if !ok {
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, alg)
+	}
+
+	if strings.HasPrefix(alg, "HS") {
+		if len(v.hmacSecret) == 0 {
+			return fmt.Errorf("%w: HMAC tokens are not accepted", ErrInvalidToken)
+		}
+
+		mac := hmac.New(hashType.New, v.hmacSecret)
+		mac.Write([]byte(input))
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return ErrInvalidToken
+		}
+
+		return nil
+	}
+
+	if v.rsaKey == nil {
+		return fmt.Errorf("%w: RSA tokens are not accepted", ErrInvalidToken)
+	}
+
+	h := hashType.New()
+	h.Write([]byte(input))
+	if err := rsa.VerifyPKCS1v15(v.rsaKey, hashType, h.Sum(nil), sig); err != nil {
+		return ErrInvalidToken
+	}
+
+	return nil
+}
+
+// validate checks the registered claims. Tokens must expire.
+func (v *JWTVerifier) validate(c claims) error {
+	now := float64(v.now().Unix())
+
+	if c.Subject == "" {
+		return fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	}
+	if c.ExpiresAt == nil {
+		return fmt.Errorf("%w: missing expiration", ErrInvalidToken)
+	}
+	if now >= *c.ExpiresAt {
+		return fmt.Errorf("%w: token expired", ErrInvalidToken)
+	}
+	if c.NotBefore != nil && now < *c.NotBefore {
+		return fmt.Errorf("%w: token not yet valid", ErrInvalidToken)
+	}
+	if v.issuer != "" && c.Issuer != v.issuer {
+		return fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+	}
+	if v.audience != "" {
+		found := false
+		for _, aud := range c.Audience {
+			if aud == v.audience {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+		}
+	}
+
+	return nil
+}
+
+// decodeSegment decodes a base64url-encoded JSON segment of a token into v.
+func decodeSegment(seg string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// parseRSAPublicKey parses a PEM-encoded PKIX or PKCS #1 RSA public key.
+func parseRSAPublicKey(data string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("failed to decode RSA public key PEM")
+	}
+
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse RSA public key: %w", err)
+	}
+
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not an RSA key")
+	}
+
+	return rsaKey, nil
+}
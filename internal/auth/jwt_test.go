@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+)
+
+const testSecret = "test-secret"
+
+// sign returns a token with the given header algorithm and claims, signed
+// with key: a []byte HMAC secret, an *rsa.PrivateKey or nil for no signature.
+func sign(t *testing.T, alg string, claims map[string]any, key any) string {
+	t.Helper()
+
+	header, err := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var sig []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(crypto.SHA256.New, key)
+		mac.Write([]byte(input))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		h := crypto.SHA256.New()
+		h.Write([]byte(input))
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, h.Sum(nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestJWTVerifier(t *testing.T) {
+	rsaKey := mustGenerateKey(t)
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	now := time.Date(2025, 10, 16, 12, 0, 0, 0, time.UTC)
+	newVerifier := func(t *testing.T, secret, rsaPEM string) *JWTVerifier {
+		t.Helper()
+
+		v, err := NewJWTVerifier(secret, rsaPEM, "issuer", "audience")
+		if err != nil {
+			t.Fatal(err)
+		}
+		v.now = func() time.Time { return now }
+
+		return v
+	}
+
+	// claims returns valid claims with the given ones changed; nil values
+	// remove a claim.
+	claims := func(changes map[string]any) map[string]any {
+		c := map[string]any{
+			"sub": "user-1",
+			"iss": "issuer",
+			"aud": "audience",
+			"exp": now.Add(time.Hour).Unix(),
+		}
+		for k, v := range changes {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		secret   string
+		rsaPEM   string
+		token    string
+		wantUser string
+	}{
+		{
+			name:     "valid HMAC token",
+			secret:   testSecret,
+			token:    sign(t, "HS256", claims(nil), []byte(testSecret)),
+			wantUser: "user-1",
+		},
+		{
+			name:     "valid RSA token",
+			rsaPEM:   publicPEM,
+			token:    sign(t, "RS256", claims(nil), rsaKey),
+			wantUser: "user-1",
+		},
+		{
+			name:     "audience in a list",
+			secret:   testSecret,
+			token:    sign(t, "HS256", claims(map[string]any{"aud": []string{"other", "audience"}}), []byte(testSecret)),
+			wantUser: "user-1",
+		},
+		{
+			// The RSA public key is known to anyone, so it must not work as an HMAC secret.
+			name:   "HMAC token signed with the RSA public key",
+			rsaPEM: publicPEM,
+			token:  sign(t, "HS256", claims(nil), []byte(publicPEM)),
+		},
+		{
+			name:   "RSA token without an RSA key",
+			secret: testSecret,
+			token:  sign(t, "RS256", claims(nil), rsaKey),
+		},
+		{
+			name:   "alg none",
+			secret: testSecret,
+			rsaPEM: publicPEM,
+			token:  sign(t, "none", claims(nil), nil),
+		},
+		{
+			name:   "HMAC token with a bad signature",
+			secret: testSecret,
+			token:  sign(t, "HS256", claims(nil), []byte("other-secret")),
+		},
+		{
+			name:   "RSA token with a bad signature",
+			rsaPEM: publicPEM,
+			token:  sign(t, "RS256", claims(nil), mustGenerateKey(t)),
+		},
+		{
+			name:   "expired",
+			secret: testSecret,
+			token:  sign(t, "HS256", claims(map[string]any{"exp": now.Unix()}), []byte(testSecret)),
+		},
+		{
+			name:   "not yet valid",
+			secret: testSecret,
+			token:  sign(t, "HS256", claims(map[string]any{"nbf": now.Add(time.Minute).Unix()}), []byte(testSecret)),
+		},
+		{
+			name:   "wrong issuer",
+			secret: testSecret,
+			token:  sign(t, "HS256", claims(map[string]any{"iss": "other"}), []byte(testSecret)),
+		},
+		{
+			name:   "wrong audience",
+			secret: testSecret,
+			token:  sign(t, "HS256", claims(map[string]any{"aud": "other"}), []byte(testSecret)),
+		},
+		{
+			name:   "missing expiration",
+			secret: testSecret,
+			token:  sign(t, "HS256", claims(map[string]any{"exp": nil}), []byte(testSecret)),
+		},
+		{
+			name:   "missing subject",
+			secret: testSecret,
+			token:  sign(t, "HS256", claims(map[string]any{"sub": nil}), []byte(testSecret)),
+		},
+		{
+			name:   "malformed",
+			secret: testSecret,
+			token:  "not.a-token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := newVerifier(t, tt.secret, tt.rsaPEM).Verify(tt.token)
+
+			if tt.wantUser == "" {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Fatalf("Verify: got user %q and error %v, want ErrInvalidToken", user.ID, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if user.ID != tt.wantUser {
+				t.Errorf("user ID: got %q, want %q", user.ID, tt.wantUser)
+			}
+		})
+	}
+}
+
+// mustGenerateKey returns a new RSA private key.
+func mustGenerateKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
@@ -0,0 +1,399 @@
+package comment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wb-go/wbf/redis"
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/aliskhannn/comment-tree/internal/auth"
+	"github.com/aliskhannn/comment-tree/internal/model"
+	commentsvc "github.com/aliskhannn/comment-tree/internal/service/comment"
+	"github.com/aliskhannn/comment-tree/internal/tenant"
+)
+
+const (
+	// treeKeyPrefix prefixes the hash holding the cached subtree variants of a comment.
+	treeKeyPrefix = "comments:tree:"
+	// listKeyPrefix prefixes the hash holding the cached list pages of a scope.
+	listKeyPrefix = "comments:list:"
+
+	// fullTreeField is the hash field of an unrestricted subtree.
+	fullTreeField = "full"
+	// globalScope is the list scope of queries without a parent.
+	globalScope = "all"
+)
+
+// Repository is the underlying comment repository.
+type Repository interface {
+	commentsvc.Repository
+	GetAncestorIDs(ctx context.Context, id uuid.UUID) ([]uuid.UUID, error)
+}
+
+// CachedRepository is a read-through Redis cache in front of a comment Repository.
+//
+// Subtrees are cached per comment and list pages per parent, both namespaced
+// by the tenant of the request and keyed by the viewer, since unapproved
+// comments are only visible to their authors and moderators. Writes invalidate
+// the subtrees of every ancestor of the affected comment and the list pages of
+// its parent, so unrelated threads stay cached. Methods that are not
+// overridden are passed through to the underlying Repository.
+type CachedRepository struct {
+	Repository
+
+	rdb     *redis.Client
+	treeTTL time.Duration
+	listTTL time.Duration
+}
+
+// NewCachedRepository creates a new CachedRepository.
+//
+// A non-positive TTL disables caching of the corresponding reads.
+func NewCachedRepository(repo Repository, rdb *redis.Client, treeTTL, listTTL time.Duration) *CachedRepository {
+	return &CachedRepository{
+		Repository: repo,
+		rdb:        rdb,
+		treeTTL:    treeTTL,
+		listTTL:    listTTL,
+	}
+}
+
+// CreateComment creates a new comment and invalidates the subtrees containing it.
+func (r *CachedRepository) CreateComment(ctx context.Context, comment *model.Comment) (model.Comment, error) {
+	c, err := r.Repository.CreateComment(ctx, comment)
+	if err != nil {
+		return c, err
+	}
+
+	r.invalidateAncestors(ctx, c.ID)
+
+	return c, nil
+}
+
+// GetCommentsByParentID returns the comment with the given ID and all nested descendants.
+func (r *CachedRepository) GetCommentsByParentID(ctx context.Context, parentID uuid.UUID, sort string) ([]model.Comment, error) {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key := treeKey(tenantID, parentID)
+	field := viewerScope(ctx) + "|" + fullTreeField + ":" + sort
+
+	var comments []model.Comment
+	if r.get(ctx, key, field, &comments) {
+		return comments, nil
+	}
+
+	comments, err = r.Repository.GetCommentsByParentID(ctx, parentID, sort)
+	if err != nil {
+		return nil, err
+	}
+
+	r.set(ctx, key, field, comments, r.treeTTL)
+
+	return comments, nil
+}
+
+// GetSubtree returns the limited subtree of the comment with the given ID.
+func (r *CachedRepository) GetSubtree(ctx context.Context, id uuid.UUID, opts model.TreeOptions, offset int) ([]*model.CommentNode, error) {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key := treeKey(tenantID, id)
+	field := fmt.Sprintf("%s|d%d:c%d:o%d:%s", viewerScope(ctx), opts.MaxDepth, opts.MaxChildrenPerNode, offset, opts.Sort)
+
+	var nodes []*model.CommentNode
+	if r.get(ctx, key, field, &nodes) {
+		return nodes, nil
+	}
+
+	nodes, err = r.Repository.GetSubtree(ctx, id, opts, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	r.set(ctx, key, field, nodes, r.treeTTL)
+
+	return nodes, nil
+}
+
+// GetComments retrieves a page of comments by parent ID with optional search and sorting.
+//
+// Search results are not cached: they carry the ancestors and replies of
+// every match, which invalidation of their own list pages does not reach.
+func (r *CachedRepository) GetComments(ctx context.Context, q model.CommentQuery) (model.CommentPage, error) {
+	if q.Search != "" {
+		return r.Repository.GetComments(ctx, q)
+	}
+
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return model.CommentPage{}, err
+	}
+	key := listKey(tenantID, q.ParentID)
+	thread := "*"
+	if q.ThreadKey != nil {
+		thread = strconv.Quote(*q.ThreadKey)
+	}
+	field := fmt.Sprintf("%s|%s|%s|%d|%d|%s", viewerScope(ctx), thread, q.Sort, q.Limit, q.Offset, q.Cursor)
+
+	var page model.CommentPage
+	if r.get(ctx, key, field, &page) {
+		return page, nil
+	}
+
+	page, err = r.Repository.GetComments(ctx, q)
+	if err != nil {
+		return model.CommentPage{}, err
+	}
+
+	r.set(ctx, key, field, page, r.listTTL)
+
+	return page, nil
+}
+
+// UpdateComment updates a comment and invalidates the subtrees containing it.
+func (r *CachedRepository) UpdateComment(ctx context.Context, id uuid.UUID, content, contentHTML, flagReason string) (model.Comment, error) {
+	c, err := r.Repository.UpdateComment(ctx, id, content, contentHTML, flagReason)
+	if err != nil {
+		return c, err
+	}
+
+	r.invalidateAncestors(ctx, id)
+
+	return c, nil
+}
+
+// Vote records the vote of a user and invalidates the subtrees containing the comment.
+func (r *CachedRepository) Vote(ctx context.Context, id uuid.UUID, userID string, value int) (model.Comment, error) {
+	c, err := r.Repository.Vote(ctx, id, userID, value)
+	if err != nil {
+		return c, err
+	}
+
+	r.invalidateAncestors(ctx, id)
+
+	return c, nil
+}
+
+// ModerateComments sets the status of comments and invalidates the subtrees
+// containing them.
+func (r *CachedRepository) ModerateComments(ctx context.Context, d model.ModerationDecision, moderatorID string) ([]model.Comment, error) {
+	comments, err := r.Repository.ModerateComments(ctx, d, moderatorID)
+	if err != nil {
+		return comments, err
+	}
+
+	for _, c := range comments {
+		r.invalidateAncestors(ctx, c.ID)
+	}
+
+	return comments, nil
+}
+
+// ReportComment records a report and invalidates the subtrees containing the
+// comment if the report hid it.
+func (r *CachedRepository) ReportComment(ctx context.Context, id uuid.UUID, reporterID, reason, details string, threshold int) (bool, error) {
+	hidden, err := r.Repository.ReportComment(ctx, id, reporterID, reason, details, threshold)
+	if err != nil || !hidden {
+		return hidden, err
+	}
+
+	r.invalidateAncestors(ctx, id)
+
+	return true, nil
+}
+
+// DeleteComment soft-deletes a comment and invalidates the subtrees containing it.
+func (r *CachedRepository) DeleteComment(ctx context.Context, id uuid.UUID, deletedBy string) error {
+	if err := r.Repository.DeleteComment(ctx, id, deletedBy); err != nil {
+		return err
+	}
+
+	r.invalidateAncestors(ctx, id)
+
+	return nil
+}
+
+// PurgeComment permanently deletes a comment with its descendants and
+// invalidates every cached entry that contained them.
+func (r *CachedRepository) PurgeComment(ctx context.Context, id uuid.UUID) error {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Resolve the affected comments before they are gone.
+	ancestors, err := r.Repository.GetAncestorIDs(ctx, id)
+	if err != nil {
+		return err
+	}
+	subtree, err := r.Repository.GetCommentsByParentID(ctx, id, "")
+	if err != nil {
+		return err
+	}
+
+	if err := r.Repository.PurgeComment(ctx, id); err != nil {
+		return err
+	}
+
+	keys := ancestorKeys(tenantID, ancestors)
+	for _, c := range subtree {
+		keys = append(keys, treeKey(tenantID, c.ID), listKey(tenantID, &c.ID))
+	}
+	r.del(ctx, keys...)
+
+	return nil
+}
+
+// PurgeDeleted permanently deletes old soft-deleted comments and drops the
+// whole cache of the tenant, since the purged comments may belong to any thread.
+func (r *CachedRepository) PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error) {
+	n, err := r.Repository.PurgeDeleted(ctx, retention)
+	if err != nil || n == 0 {
+		return n, err
+	}
+
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return n, nil
+	}
+
+	var keys []string
+	for _, pattern := range []string{treeKeyPrefix + tenantID + ":*", listKeyPrefix + tenantID + ":*"} {
+		var cursor uint64
+		for {
+			batch, next, err := r.rdb.Scan(ctx, cursor, pattern, 100).Result()
+			if err != nil {
+				zlog.Logger.Error().Err(err).Msg("failed to scan comment cache")
+				return n, nil
+			}
+			keys = append(keys, batch...)
+
+			if cursor = next; cursor == 0 {
+				break
+			}
+		}
+	}
+	r.del(ctx, keys...)
+
+	return n, nil
+}
+
+// invalidateAncestors drops the cached subtrees of the comment and all its
+// ancestors, and the list pages the comment appears in.
+func (r *CachedRepository) invalidateAncestors(ctx context.Context, id uuid.UUID) {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return
+	}
+
+	ancestors, err := r.Repository.GetAncestorIDs(ctx, id)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("id", id.String()).Msg("failed to resolve comment ancestors for cache invalidation")
+		return
+	}
+
+	r.del(ctx, ancestorKeys(tenantID, ancestors)...)
+}
+
+// ancestorKeys returns the cache keys affected by a change of ancestors[0].
+//
+// ancestors is ordered from the changed comment up to the root.
+func ancestorKeys(tenantID string, ancestors []uuid.UUID) []string {
+	keys := make([]string, 0, len(ancestors)+2)
+	for _, id := range ancestors {
+		keys = append(keys, treeKey(tenantID, id))
+	}
+
+	// Lists without a parent include every comment.
+	keys = append(keys, listKey(tenantID, nil))
+	if len(ancestors) > 1 {
+		keys = append(keys, listKey(tenantID, &ancestors[1]))
+	}
+
+	return keys
+}
+
+// get loads a cached value into dst. It reports whether the value was found.
+func (r *CachedRepository) get(ctx context.Context, key, field string, dst any) bool {
+	data, err := r.rdb.HGet(ctx, key, field).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.NoMatches) {
+			zlog.Logger.Error().Err(err).Str("key", key).Msg("failed to read comment cache")
+		}
+		return false
+	}
+
+	if err := json.Unmarshal(data, dst); err != nil {
+		zlog.Logger.Error().Err(err).Str("key", key).Msg("failed to decode cached comments")
+		return false
+	}
+
+	return true
+}
+
+// set caches value under the given hash field and refreshes the key TTL.
+func (r *CachedRepository) set(ctx context.Context, key, field string, value any, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Str("key", key).Msg("failed to encode comments for cache")
+		return
+	}
+
+	pipe := r.rdb.TxPipeline()
+	pipe.HSet(ctx, key, field, data)
+	pipe.Expire(ctx, key, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		zlog.Logger.Error().Err(err).Str("key", key).Msg("failed to write comment cache")
+	}
+}
+
+// del removes the given keys from the cache.
+func (r *CachedRepository) del(ctx context.Context, keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+
+	if err := r.rdb.Del(ctx, keys...).Err(); err != nil {
+		zlog.Logger.Error().Err(err).Strs("keys", keys).Msg("failed to invalidate comment cache")
+	}
+}
+
+// viewerScope returns the part of a cache field that depends on the comments
+// visible to the user in ctx.
+func viewerScope(ctx context.Context) string {
+	user, ok := auth.UserFromContext(ctx)
+	switch {
+	case !ok:
+		return "public"
+	case user.IsModerator():
+		return "moderator"
+	default:
+		return "user:" + user.ID
+	}
+}
+
+// treeKey returns the key of the cached subtrees of a comment.
+func treeKey(tenantID string, id uuid.UUID) string {
+	return treeKeyPrefix + tenantID + ":" + id.String()
+}
+
+// listKey returns the key of the cached list pages of a parent.
+func listKey(tenantID string, parentID *uuid.UUID) string {
+	if parentID == nil {
+		return listKeyPrefix + tenantID + ":" + globalScope
+	}
+	return listKeyPrefix + tenantID + ":" + parentID.String()
+}
@@ -0,0 +1,229 @@
+package reaction
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/wb-go/wbf/redis"
+	"github.com/wb-go/wbf/zlog"
+
+	reactionsvc "github.com/aliskhannn/comment-tree/internal/service/reaction"
+	"github.com/aliskhannn/comment-tree/internal/tenant"
+)
+
+const (
+	// countsKeyPrefix prefixes the hash holding the reaction counts of a comment.
+	countsKeyPrefix = "comments:reactions:"
+	// versionKeyPrefix prefixes the counter bumped whenever the reactions of
+	// a comment change.
+	versionKeyPrefix = "comments:reactions:version:"
+	// loadedField marks a counts hash as loaded, so comments without
+	// reactions are cached as well.
+	loadedField = "_"
+)
+
+// CachedRepository is a read-through Redis cache of reaction counts in front
+// of a reaction Repository.
+//
+// Counts are cached per comment as a hash of emoji to count and dropped
+// whenever a reaction on the comment changes. Every change also bumps a
+// version of the comment, and loaded counts are only cached if the version
+// is still the one read before loading, so counts loaded before a change
+// cannot overwrite its invalidation. Methods that are not overridden are
+// passed through to the underlying Repository.
+type CachedRepository struct {
+	reactionsvc.Repository
+
+	rdb *redis.Client
+	ttl time.Duration
+}
+
+// NewCachedRepository creates a new CachedRepository.
+//
+// A non-positive TTL disables caching.
+func NewCachedRepository(repo reactionsvc.Repository, rdb *redis.Client, ttl time.Duration) *CachedRepository {
+	return &CachedRepository{
+		Repository: repo,
+		rdb:        rdb,
+		ttl:        ttl,
+	}
+}
+
+// AddReaction records a reaction and invalidates the counts of the comment.
+func (r *CachedRepository) AddReaction(ctx context.Context, commentID uuid.UUID, userID, emoji string) error {
+	if err := r.Repository.AddReaction(ctx, commentID, userID, emoji); err != nil {
+		return err
+	}
+
+	r.invalidate(ctx, commentID)
+
+	return nil
+}
+
+// RemoveReaction removes a reaction and invalidates the counts of the comment.
+func (r *CachedRepository) RemoveReaction(ctx context.Context, commentID uuid.UUID, userID, emoji string) error {
+	if err := r.Repository.RemoveReaction(ctx, commentID, userID, emoji); err != nil {
+		return err
+	}
+
+	r.invalidate(ctx, commentID)
+
+	return nil
+}
+
+// GetReactionCounts returns the number of reactions per emoji of the given
+// comments, loading only the counts missing from the cache.
+func (r *CachedRepository) GetReactionCounts(ctx context.Context, commentIDs []uuid.UUID) (map[uuid.UUID]map[string]int, error) {
+	if r.ttl <= 0 || len(commentIDs) == 0 {
+		return r.Repository.GetReactionCounts(ctx, commentIDs)
+	}
+
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	counts, missing, versions := r.get(ctx, tenantID, commentIDs)
+	if len(missing) == 0 {
+		return counts, nil
+	}
+
+	loaded, err := r.Repository.GetReactionCounts(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	for id, c := range loaded {
+		counts[id] = c
+	}
+	r.set(ctx, tenantID, missing, versions, loaded)
+
+	return counts, nil
+}
+
+// get reads the cached counts of the given comments. It returns the found
+// counts, the IDs of the comments that are not cached and their versions.
+func (r *CachedRepository) get(ctx context.Context, tenantID string, ids []uuid.UUID) (map[uuid.UUID]map[string]int, []uuid.UUID, []string) {
+	counts := make(map[uuid.UUID]map[string]int, len(ids))
+
+	pipe := r.rdb.Pipeline()
+	cmds := make([]*goredis.StringStringMapCmd, len(ids))
+	versionCmds := make([]*goredis.StringCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.HGetAll(ctx, countsKey(tenantID, id))
+		versionCmds[i] = pipe.Get(ctx, versionKey(tenantID, id))
+	}
+	// Comments that never changed have no version, which fails the pipeline
+	// with redis.Nil.
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, goredis.Nil) {
+		zlog.Logger.Error().Err(err).Msg("failed to read reaction cache")
+		// Without versions the loaded counts must not be cached.
+		return counts, ids, nil
+	}
+
+	var (
+		missing  []uuid.UUID
+		versions []string
+	)
+	for i, id := range ids {
+		fields := cmds[i].Val()
+		if _, ok := fields[loadedField]; !ok {
+			missing = append(missing, id)
+			versions = append(versions, versionCmds[i].Val())
+			continue
+		}
+
+		for emoji, v := range fields {
+			if emoji == loadedField {
+				continue
+			}
+			if n, err := strconv.Atoi(v); err == nil && n > 0 {
+				if counts[id] == nil {
+					counts[id] = make(map[string]int)
+				}
+				counts[id][emoji] = n
+			}
+		}
+	}
+
+	return counts, missing, versions
+}
+
+// setScript caches the counts of every comment whose version is unchanged.
+//
+// KEYS are pairs of the counts hash and the version of a comment, ARGV[1] is
+// the TTL in milliseconds, followed for every comment by the version read
+// before loading its counts ("" for none), the number of hash arguments and
+// the field/value pairs of the hash.
+var setScript = goredis.NewScript(`
+local arg = 2
+for i = 1, #KEYS, 2 do
+	local n = tonumber(ARGV[arg + 1])
+	if (redis.call('GET', KEYS[i + 1]) or '') == ARGV[arg] then
+		redis.call('HSET', KEYS[i], unpack(ARGV, arg + 2, arg + 1 + n))
+		redis.call('PEXPIRE', KEYS[i], ARGV[1])
+	end
+	arg = arg + 2 + n
+end
+return 0
+`)
+
+// set caches the counts of the given comments, including ones without
+// reactions, unless their reactions changed since versions were read.
+func (r *CachedRepository) set(ctx context.Context, tenantID string, ids []uuid.UUID, versions []string, counts map[uuid.UUID]map[string]int) {
+	if len(versions) != len(ids) {
+		return
+	}
+
+	keys := make([]string, 0, 2*len(ids))
+	args := []any{r.ttl.Milliseconds()}
+	for i, id := range ids {
+		keys = append(keys, countsKey(tenantID, id), versionKey(tenantID, id))
+
+		values := []any{loadedField, 0}
+		for emoji, n := range counts[id] {
+			values = append(values, emoji, n)
+		}
+		args = append(args, versions[i], len(values))
+		args = append(args, values...)
+	}
+
+	if err := setScript.Run(ctx, r.rdb.Client, keys, args...).Err(); err != nil {
+		zlog.Logger.Error().Err(err).Msg("failed to write reaction cache")
+	}
+}
+
+// invalidate drops the cached counts of a comment and bumps its version.
+func (r *CachedRepository) invalidate(ctx context.Context, commentID uuid.UUID) {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return
+	}
+
+	key := countsKey(tenantID, commentID)
+	version := versionKey(tenantID, commentID)
+
+	pipe := r.rdb.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.Incr(ctx, version)
+	// The version only has to outlive counts being loaded, and the counts
+	// it guards expire after the same TTL.
+	pipe.PExpire(ctx, version, r.ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		zlog.Logger.Error().Err(err).Str("key", key).Msg("failed to invalidate reaction cache")
+	}
+}
+
+// countsKey returns the key of the cached reaction counts of a comment.
+func countsKey(tenantID string, id uuid.UUID) string {
+	return countsKeyPrefix + tenantID + ":" + id.String()
+}
+
+// versionKey returns the key of the version of the reactions of a comment.
+func versionKey(tenantID string, id uuid.UUID) string {
+	return versionKeyPrefix + tenantID + ":" + id.String()
+}
@@ -10,14 +10,25 @@ import (
 
 // Config holds the main configuration for the application.
 type Config struct {
-	Server   Server   `mapstructure:"server"`
-	Database Database `mapstructure:"database"`
-	Redis    Redis    `mapstructure:"redis"`
+	Server        Server        `mapstructure:"server"`
+	Database      Database      `mapstructure:"database"`
+	Redis         Redis         `mapstructure:"redis"`
+	Auth          Auth          `mapstructure:"auth"`
+	Tenancy       Tenancy       `mapstructure:"tenancy"`
+	Realtime      Realtime      `mapstructure:"realtime"`
+	Webhooks      Webhooks      `mapstructure:"webhooks"`
+	Outbox        Outbox        `mapstructure:"outbox"`
+	Reactions     Reactions     `mapstructure:"reactions"`
+	Filters       Filters       `mapstructure:"filters"`
+	RateLimit     RateLimit     `mapstructure:"rate_limit"`
+	Idempotency   Idempotency   `mapstructure:"idempotency"`
+	Notifications Notifications `mapstructure:"notifications"`
 }
 
 // Server holds HTTP server-related configuration.
 type Server struct {
-	HTTPPort string `mapstructure:"http_port"` // HTTP port to listen on
+	HTTPPort       string   `mapstructure:"http_port"`       // HTTP port to listen on
+	TrustedProxies []string `mapstructure:"trusted_proxies"` // IPs or CIDRs of proxies whose X-Forwarded-For is trusted
 }
 
 // Database holds database master and slave configuration.
@@ -40,11 +51,185 @@ type DatabaseNode struct {
 	SSLMode string `mapstructure:"ssl_mode"`
 }
 
-// Redis holds Redis connection parameters.
+// Redis holds Redis connection and caching parameters.
 type Redis struct {
 	Address  string `mapstructure:"address"`
 	Password string `mapstructure:"password"`
 	Database string `mapstructure:"database"`
+
+	TreeTTL     time.Duration `mapstructure:"tree_ttl"`     // TTL of cached comment subtrees, 0 disables caching
+	ListTTL     time.Duration `mapstructure:"list_ttl"`     // TTL of cached comment list pages, 0 disables caching
+	ReactionTTL time.Duration `mapstructure:"reaction_ttl"` // TTL of cached reaction counts, 0 disables caching
+}
+
+// Auth holds authentication configuration.
+type Auth struct {
+	JWT     JWT      `mapstructure:"jwt"`
+	APIKeys []APIKey `mapstructure:"api_keys"`
+}
+
+// JWT holds the keys and expected claims of accepted JSON Web Tokens.
+type JWT struct {
+	HMACSecret   string `mapstructure:"hmac_secret"`    // shared secret for HS256/384/512, empty disables them
+	RSAPublicKey string `mapstructure:"rsa_public_key"` // PEM public key for RS256/384/512, empty disables them
+	Issuer       string `mapstructure:"issuer"`         // expected iss claim, empty skips the check
+	Audience     string `mapstructure:"audience"`       // expected aud claim, empty skips the check
+}
+
+// APIKey holds a static API key and the identity it authenticates.
+type APIKey struct {
+	Key      string `mapstructure:"key"`
+	UserID   string `mapstructure:"user_id"`
+	Name     string `mapstructure:"name"`
+	Username string `mapstructure:"username"` // handle for mentions, empty for none
+	Email    string `mapstructure:"email"`    // address for notification emails, empty for none
+	Role     string `mapstructure:"role"`
+	Tenant   string `mapstructure:"tenant"` // tenant the key is bound to, empty for the default tenant
+}
+
+// Realtime holds comment event streaming settings.
+type Realtime struct {
+	StreamMaxLen int64         `mapstructure:"stream_max_len"` // approximate number of events kept per tenant for resume
+	Heartbeat    time.Duration `mapstructure:"heartbeat"`      // interval of SSE keep-alive comments, 0 disables them
+}
+
+// Outbox holds the settings of the relay publishing outbox events.
+type Outbox struct {
+	BatchSize    int           `mapstructure:"batch_size"`     // events claimed per poll
+	PollInterval time.Duration `mapstructure:"poll_interval"`  // pause between polls of an empty outbox
+	Lease        time.Duration `mapstructure:"lease"`          // time before events of a stalled relay are claimed again
+	MaxAttempts  int           `mapstructure:"max_attempts"`   // attempts before an event is moved to the dead-letter state
+	BaseBackoff  time.Duration `mapstructure:"base_backoff"`   // delay after the first failure, doubled after each further one
+	MaxBackoff   time.Duration `mapstructure:"max_backoff"`    // upper bound of the retry delay
+	Stream       string        `mapstructure:"stream"`         // Redis stream events are appended to, empty disables it
+	StreamMaxLen int64         `mapstructure:"stream_max_len"` // approximate number of entries kept in the stream
+}
+
+// Reactions holds emoji reaction settings.
+type Reactions struct {
+	Allowed []string `mapstructure:"allowed"` // emojis users may react with
+}
+
+// RateLimit holds the request budgets of reads (GET, HEAD, OPTIONS) and writes.
+type RateLimit struct {
+	Read  RateBudget `mapstructure:"read"`
+	Write RateBudget `mapstructure:"write"`
+}
+
+// RateBudget holds the limits of a class of requests per key.
+type RateBudget struct {
+	IP     RateLimitRule `mapstructure:"ip"`     // per client IP
+	User   RateLimitRule `mapstructure:"user"`   // per authenticated user
+	Thread RateLimitRule `mapstructure:"thread"` // per thread, or per parent for replies
+}
+
+// RateLimitRule allows a number of requests per sliding window.
+type RateLimitRule struct {
+	Requests int           `mapstructure:"requests"` // 0 disables the limit
+	Window   time.Duration `mapstructure:"window"`
+}
+
+// Idempotency holds the settings of Idempotency-Key handling.
+type Idempotency struct {
+	TTL         time.Duration `mapstructure:"ttl"`          // how long responses are kept for retries
+	LockTimeout time.Duration `mapstructure:"lock_timeout"` // how long a key stays locked by a request in progress
+}
+
+// Filters holds the content filters comments pass before they are stored.
+//
+// Actions are "rewrite", "flag" or "reject". Filters run in the order
+// blocklist, max links, duplicates, regex rules.
+type Filters struct {
+	Blocklist  BlocklistFilter  `mapstructure:"blocklist"`
+	MaxLinks   MaxLinksFilter   `mapstructure:"max_links"`
+	Duplicates DuplicatesFilter `mapstructure:"duplicates"`
+	Regex      []RegexRule      `mapstructure:"regex"`
+}
+
+// BlocklistFilter holds the blocked words filter settings.
+type BlocklistFilter struct {
+	Words  []string `mapstructure:"words"` // blocked words, empty disables the filter
+	Action string   `mapstructure:"action"`
+}
+
+// MaxLinksFilter holds the link limit filter settings.
+type MaxLinksFilter struct {
+	Max    int    `mapstructure:"max"` // links allowed per comment, 0 disables the filter
+	Action string `mapstructure:"action"`
+}
+
+// DuplicatesFilter holds the duplicate content filter settings.
+type DuplicatesFilter struct {
+	Window time.Duration `mapstructure:"window"` // how far back to look for the same content, 0 disables the filter
+	Action string        `mapstructure:"action"`
+}
+
+// RegexRule holds a single regular expression rule.
+type RegexRule struct {
+	Pattern     string `mapstructure:"pattern"` // RE2 syntax
+	Action      string `mapstructure:"action"`
+	Reason      string `mapstructure:"reason"`      // for "flag" and "reject"
+	Replacement string `mapstructure:"replacement"` // for "rewrite"
+}
+
+// Webhooks holds webhook delivery settings.
+type Webhooks struct {
+	BatchSize    int           `mapstructure:"batch_size"`    // deliveries claimed per poll
+	PollInterval time.Duration `mapstructure:"poll_interval"` // pause between polls of an empty queue
+	Timeout      time.Duration `mapstructure:"timeout"`       // timeout of a single delivery request
+	MaxAttempts  int           `mapstructure:"max_attempts"`  // attempts before a delivery is moved to the dead-letter list
+	BaseBackoff  time.Duration `mapstructure:"base_backoff"`  // delay after the first failure, doubled after each further one
+	MaxBackoff   time.Duration `mapstructure:"max_backoff"`   // upper bound of the retry delay
+	AllowPrivate bool          `mapstructure:"allow_private"` // whether webhooks may target private or reserved addresses, for development
+	Retention    time.Duration `mapstructure:"retention"`     // age after which delivered deliveries are deleted, 0 keeps them
+}
+
+// Notifications holds notification email settings.
+type Notifications struct {
+	Email NotificationEmail `mapstructure:"email"`
+	SMTP  SMTP              `mapstructure:"smtp"`
+}
+
+// NotificationEmail holds the settings of notification emails.
+type NotificationEmail struct {
+	Enabled           bool          `mapstructure:"enabled"`            // whether notification emails are sent
+	From              string        `mapstructure:"from"`               // sender address, e.g. "CommentTree <no-reply@example.com>"
+	BaseURL           string        `mapstructure:"base_url"`           // public URL of the API, for unsubscribe links
+	CommentURL        string        `mapstructure:"comment_url"`        // link to a comment with {id} and {thread} placeholders, empty for none
+	UnsubscribeSecret string        `mapstructure:"unsubscribe_secret"` // key unsubscribe links are signed with
+	BatchSize         int           `mapstructure:"batch_size"`         // recipients claimed per poll
+	PollInterval      time.Duration `mapstructure:"poll_interval"`      // pause between polls without due recipients
+	MaxItems          int           `mapstructure:"max_items"`          // notifications listed per email
+	RetryInterval     time.Duration `mapstructure:"retry_interval"`     // delay before retrying a failed email
+}
+
+// SMTP holds the SMTP server settings.
+type SMTP struct {
+	Host     string        `mapstructure:"host"`
+	Port     int           `mapstructure:"port"`
+	Username string        `mapstructure:"username"` // empty disables authentication
+	Password string        `mapstructure:"password"`
+	TLS      string        `mapstructure:"tls"`     // auto, starttls, tls or none
+	Timeout  time.Duration `mapstructure:"timeout"` // timeout of sending a single email
+}
+
+// Tenancy holds tenant resolution settings and the configured tenants.
+type Tenancy struct {
+	Header        string   `mapstructure:"header"`         // request header naming the tenant
+	BaseDomain    string   `mapstructure:"base_domain"`    // domain whose subdomains name tenants, empty disables
+	DefaultTenant string   `mapstructure:"default_tenant"` // tenant of requests that name none
+	Tenants       []Tenant `mapstructure:"tenants"`
+}
+
+// Tenant holds the settings of a single tenant.
+type Tenant struct {
+	ID               string   `mapstructure:"id"`
+	Subdomain        string   `mapstructure:"subdomain"`
+	MaxContentLength int      `mapstructure:"max_content_length"`
+	CORSOrigins      []string `mapstructure:"cors_origins"`
+	ModerationMode   string   `mapstructure:"moderation_mode"`  // "post" or "pre"
+	ReportThreshold  int      `mapstructure:"report_threshold"` // open reports that hide a comment, 0 for the default
+	Language         string   `mapstructure:"language"`         // language of comments, e.g. "english" or "ru"
 }
 
 // DSN returns the PostgreSQL DSN string for connecting to this database node.
@@ -69,6 +254,15 @@ func mustBindEnv() {
 		"redis.address":  "REDIS_ADDRESS",
 		"redis.password": "REDIS_PASSWORD",
 		"redis.database": "REDIS_DATABASE",
+
+		"auth.jwt.hmac_secret":    "JWT_HMAC_SECRET",
+		"auth.jwt.rsa_public_key": "JWT_RSA_PUBLIC_KEY",
+
+		"notifications.email.unsubscribe_secret": "UNSUBSCRIBE_SECRET",
+		"notifications.smtp.host":                "SMTP_HOST",
+		"notifications.smtp.port":                "SMTP_PORT",
+		"notifications.smtp.username":            "SMTP_USERNAME",
+		"notifications.smtp.password":            "SMTP_PASSWORD",
 	}
 
 	for key, env := range bindings {
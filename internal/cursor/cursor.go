@@ -0,0 +1,32 @@
+// Package cursor encodes the opaque continuation tokens of paged APIs.
+package cursor
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// ErrInvalid is returned when a cursor cannot be decoded or does not belong
+// to the requested resource.
+var ErrInvalid = errors.New("invalid cursor")
+
+// Encode encodes v as an opaque URL-safe token.
+func Encode(v any) string {
+	data, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decode decodes a token produced by Encode into v.
+func Decode(token string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return ErrInvalid
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return ErrInvalid
+	}
+
+	return nil
+}
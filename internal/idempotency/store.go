@@ -0,0 +1,101 @@
+// Package idempotency stores the responses of requests made with an
+// Idempotency-Key so that retries can be answered without repeating them.
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wb-go/wbf/redis"
+)
+
+// keyPrefix prefixes the records of idempotency keys.
+const keyPrefix = "idempotency:"
+
+// Record is what is stored for an idempotency key.
+type Record struct {
+	Fingerprint string `json:"fingerprint"`            // hash of the request the key was first used with
+	Status      int    `json:"status,omitempty"`       // response status, 0 while the request is in progress
+	ContentType string `json:"content_type,omitempty"` // response content type
+	Body        []byte `json:"body,omitempty"`         // response body
+}
+
+// Done reports whether the response of the request is recorded.
+func (r Record) Done() bool {
+	return r.Status != 0
+}
+
+// Store keeps idempotency records in Redis.
+type Store struct {
+	rdb         *redis.Client
+	ttl         time.Duration
+	lockTimeout time.Duration
+}
+
+// NewStore creates a new Store keeping responses for ttl. A key stays locked
+// by a request in progress for at most lockTimeout.
+func NewStore(rdb *redis.Client, ttl, lockTimeout time.Duration) *Store {
+	return &Store{rdb: rdb, ttl: ttl, lockTimeout: lockTimeout}
+}
+
+// Begin claims key for a request with the given fingerprint.
+//
+// It reports true if the key was free and is now locked by the request.
+// Otherwise it returns the record of the earlier request, which may still be
+// in progress.
+func (s *Store) Begin(ctx context.Context, key, fingerprint string) (Record, bool, error) {
+	data, err := json.Marshal(Record{Fingerprint: fingerprint})
+	if err != nil {
+		return Record{}, false, fmt.Errorf("failed to encode idempotency record: %w", err)
+	}
+
+	ok, err := s.rdb.SetNX(ctx, keyPrefix+key, data, s.lockTimeout).Result()
+	if err != nil {
+		return Record{}, false, fmt.Errorf("failed to lock idempotency key: %w", err)
+	}
+	if ok {
+		return Record{}, true, nil
+	}
+
+	data, err = s.rdb.Client.Get(ctx, keyPrefix+key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.NoMatches) {
+			// The lock expired between the two calls.
+			return Record{}, false, fmt.Errorf("idempotency key %q expired while locked", key)
+		}
+		return Record{}, false, fmt.Errorf("failed to get idempotency record: %w", err)
+	}
+
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return Record{}, false, fmt.Errorf("failed to decode idempotency record: %w", err)
+	}
+
+	return rec, false, nil
+}
+
+// Complete records the response of the request holding key.
+func (s *Store) Complete(ctx context.Context, key string, rec Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode idempotency record: %w", err)
+	}
+
+	if err := s.rdb.Client.Set(ctx, keyPrefix+key, data, s.ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save idempotency record: %w", err)
+	}
+
+	return nil
+}
+
+// Release frees key so that the request can be retried.
+func (s *Store) Release(ctx context.Context, key string) error {
+	if err := s.rdb.Del(ctx, keyPrefix+key).Err(); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+
+	return nil
+}
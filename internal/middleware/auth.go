@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/wb-go/wbf/ginext"
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/aliskhannn/comment-tree/internal/api/respond"
+	"github.com/aliskhannn/comment-tree/internal/auth"
+)
+
+// AuthMiddleware returns a Gin middleware that authenticates the caller.
+//
+// Requests with valid credentials carry the user in their context, requests
+// without credentials pass through anonymously, and requests with invalid
+// credentials are rejected with 401.
+func AuthMiddleware(authenticator *auth.Authenticator) ginext.HandlerFunc {
+	return func(c *ginext.Context) {
+		user, ok, err := authenticator.Authenticate(c.Request)
+		if err != nil {
+			zlog.Logger.Warn().Err(err).Msg("authentication failed")
+			respond.Fail(c.Writer, http.StatusUnauthorized, err)
+			c.Abort()
+			return
+		}
+
+		if ok {
+			c.Request = c.Request.WithContext(auth.WithUser(c.Request.Context(), user))
+		}
+
+		c.Next()
+	}
+}
+
+// RequireAuth returns a Gin middleware that rejects anonymous requests with 401.
+func RequireAuth() ginext.HandlerFunc {
+	return func(c *ginext.Context) {
+		if _, ok := auth.UserFromContext(c.Request.Context()); !ok {
+			respond.Fail(c.Writer, http.StatusUnauthorized, errors.New("authentication required"))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireModerator returns a Gin middleware that only lets moderators through.
+func RequireModerator() ginext.HandlerFunc {
+	return func(c *ginext.Context) {
+		user, ok := auth.UserFromContext(c.Request.Context())
+		if !ok {
+			respond.Fail(c.Writer, http.StatusUnauthorized, errors.New("authentication required"))
+			c.Abort()
+			return
+		}
+
+		if !user.IsModerator() {
+			respond.Fail(c.Writer, http.StatusForbidden, errors.New("moderator role required"))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
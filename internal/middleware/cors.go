@@ -4,18 +4,25 @@ import (
 	"net/http"
 
 	"github.com/wb-go/wbf/ginext"
+
+	"github.com/aliskhannn/comment-tree/internal/tenant"
 )
 
 // CORSMiddleware returns a Gin middleware that handles Cross-Origin Resource Sharing (CORS) settings.
 //
-// It sets the necessary headers to allow requests from the frontend (http://localhost:3000)
-// and supports credentials, custom headers, and standard HTTP methods.
-func CORSMiddleware() ginext.HandlerFunc {
+// It allows requests from origins configured for any tenant and supports
+// credentials, custom headers, and standard HTTP methods. Preflight requests
+// cannot name a tenant, so the per-tenant origin check happens in
+// TenantMiddleware.
+func CORSMiddleware(registry *tenant.Registry) ginext.HandlerFunc {
 	return func(c *ginext.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		if origin := c.GetHeader("Origin"); origin != "" && registry.AllowsOrigin(origin) {
+			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+			c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+			c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-API-Key, X-Tenant-ID, accept, origin, Cache-Control, X-Requested-With")
+			c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
+			c.Writer.Header().Add("Vary", "Origin")
+		}
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(http.StatusNoContent)
@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wb-go/wbf/ginext"
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/aliskhannn/comment-tree/internal/api/respond"
+	"github.com/aliskhannn/comment-tree/internal/auth"
+	"github.com/aliskhannn/comment-tree/internal/idempotency"
+	"github.com/aliskhannn/comment-tree/internal/tenant"
+)
+
+const (
+	// idempotencyHeader names the request header carrying the idempotency key.
+	idempotencyHeader = "Idempotency-Key"
+	// maxIdempotencyKey is the longest accepted idempotency key.
+	maxIdempotencyKey = 255
+	// maxEscapedRune is the most bytes a character of the content takes in
+	// a JSON body, as an escaped UTF-16 surrogate pair.
+	maxEscapedRune = 12
+	// maxBodyOverhead is the room left in a body for the fields besides the
+	// content, such as the thread.
+	maxBodyOverhead = 32 << 10
+	// idempotencySaveTimeout bounds saving the outcome of a request.
+	idempotencySaveTimeout = 5 * time.Second
+)
+
+// IdempotencyStore keeps the responses of requests made with an idempotency key.
+type IdempotencyStore interface {
+	Begin(ctx context.Context, key, fingerprint string) (idempotency.Record, bool, error)
+	Complete(ctx context.Context, key string, rec idempotency.Record) error
+	Release(ctx context.Context, key string) error
+}
+
+// IdempotencyMiddleware returns a Gin middleware that honors the
+// Idempotency-Key header.
+//
+// Keys are scoped to the tenant and user. The first request with a key is
+// handled and its successful response stored; retries with the same payload
+// get the stored response with an Idempotent-Replayed header, retries with a
+// different payload 422 and retries while the first request is in progress
+// 409. Failed responses are not stored, so the request can be retried with
+// the same key. Bodies too large for any comment of the tenant get 413.
+// If Redis fails, requests are handled as if they had no key.
+//
+// It must run after AuthMiddleware and TenantMiddleware.
+func IdempotencyMiddleware(store IdempotencyStore) ginext.HandlerFunc {
+	return func(c *ginext.Context) {
+		key := c.GetHeader(idempotencyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			respond.Fail(c.Writer, http.StatusBadRequest, errors.New("idempotency key is too long"))
+			c.Abort()
+			return
+		}
+
+		ctx := c.Request.Context()
+		t, ok := tenant.FromContext(ctx)
+		if !ok {
+			c.Next()
+			return
+		}
+		user, _ := auth.UserFromContext(ctx)
+		key = t.ID + ":" + user.ID + ":" + key
+
+		// The body is held in memory, so it is limited to what a comment of
+		// the tenant can take.
+		limit := int64(t.MaxContentLength)*maxEscapedRune + maxBodyOverhead
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, limit))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				respond.Fail(c.Writer, http.StatusRequestEntityTooLarge, errors.New("request body is too large"))
+			} else {
+				respond.Fail(c.Writer, http.StatusBadRequest, errors.New("failed to read request body"))
+			}
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		fingerprint := requestFingerprint(c.Request, body)
+
+		rec, locked, err := store.Begin(ctx, key, fingerprint)
+		if err != nil {
+			zlog.Logger.Error().Err(err).Msg("failed to check idempotency key")
+			c.Next()
+			return
+		}
+
+		if !locked {
+			switch {
+			case rec.Fingerprint != fingerprint:
+				respond.Fail(c.Writer, http.StatusUnprocessableEntity, errors.New("idempotency key was used with a different request"))
+			case !rec.Done():
+				respond.Fail(c.Writer, http.StatusConflict, errors.New("a request with this idempotency key is in progress"))
+			default:
+				c.Header("Content-Type", rec.ContentType)
+				c.Header("Idempotent-Replayed", "true")
+				c.Status(rec.Status)
+				_, _ = c.Writer.Write(rec.Body)
+			}
+			c.Abort()
+			return
+		}
+
+		w := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+
+		c.Next()
+
+		// The outcome is saved even if the client went away, since that is
+		// when it retries.
+		saveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), idempotencySaveTimeout)
+		defer cancel()
+
+		if status := w.Status(); status >= 200 && status < 300 {
+			err = store.Complete(saveCtx, key, idempotency.Record{
+				Fingerprint: fingerprint,
+				Status:      status,
+				ContentType: w.Header().Get("Content-Type"),
+				Body:        w.body.Bytes(),
+			})
+		} else {
+			err = store.Release(saveCtx, key)
+		}
+		if err != nil {
+			zlog.Logger.Error().Err(err).Msg("failed to save idempotency key")
+		}
+	}
+}
+
+// requestFingerprint hashes the method, path and body of a request. JSON
+// bodies are hashed in canonical form, so formatting and key order do not
+// matter.
+func requestFingerprint(r *http.Request, body []byte) string {
+	var v any
+	if err := json.Unmarshal(body, &v); err == nil {
+		if canonical, err := json.Marshal(v); err == nil {
+			body = canonical
+		}
+	}
+
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(body)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recordingWriter keeps a copy of the response body written through it.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// Write implements io.Writer.
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// WriteString implements io.StringWriter.
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
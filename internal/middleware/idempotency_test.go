@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wb-go/wbf/ginext"
+
+	"github.com/aliskhannn/comment-tree/internal/idempotency"
+	"github.com/aliskhannn/comment-tree/internal/model"
+	"github.com/aliskhannn/comment-tree/internal/tenant"
+)
+
+// memoryStore is an IdempotencyStore in memory. Like Redis, it fails
+// operations on cancelled contexts.
+type memoryStore struct {
+	mu      sync.Mutex
+	records map[string]idempotency.Record
+	saved   chan struct{} // receives after every Complete or Release
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{records: make(map[string]idempotency.Record), saved: make(chan struct{}, 1)}
+}
+
+func (s *memoryStore) Begin(ctx context.Context, key, fingerprint string) (idempotency.Record, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return idempotency.Record{}, false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rec, ok := s.records[key]; ok {
+		return rec, false, nil
+	}
+	s.records[key] = idempotency.Record{Fingerprint: fingerprint}
+
+	return idempotency.Record{}, true, nil
+}
+
+func (s *memoryStore) Complete(ctx context.Context, key string, rec idempotency.Record) error {
+	defer func() { s.saved <- struct{}{} }()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[key] = rec
+
+	return nil
+}
+
+func (s *memoryStore) Release(ctx context.Context, key string) error {
+	defer func() { s.saved <- struct{}{} }()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+
+	return nil
+}
+
+func TestIdempotencyMiddlewareClientDisconnect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := newMemoryStore()
+	handling := make(chan struct{})
+	created := 0
+
+	e := ginext.New()
+	e.Use(func(c *ginext.Context) {
+		ctx := tenant.WithTenant(c.Request.Context(), model.Tenant{ID: "t", MaxContentLength: tenant.DefaultMaxContentLength})
+		c.Request = c.Request.WithContext(ctx)
+	})
+	e.POST("/comments", IdempotencyMiddleware(store), func(c *ginext.Context) {
+		created++
+		if created == 1 {
+			// The client gives up before the response is written.
+			close(handling)
+			<-c.Request.Context().Done()
+		}
+		c.JSON(http.StatusCreated, gin.H{"id": created})
+	})
+
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	post := func(ctx context.Context) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+"/comments", strings.NewReader(`{"content":"hi"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(idempotencyHeader, "key")
+		return http.DefaultClient.Do(req)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-handling
+		cancel()
+	}()
+	if resp, err := post(ctx); err == nil {
+		resp.Body.Close()
+		t.Fatal("first request completed, want it cancelled by the client")
+	}
+
+	select {
+	case <-store.saved:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the outcome of the first request was not saved")
+	}
+
+	resp, err := post(context.Background())
+	if err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("retry status: got %d, want %d", resp.StatusCode, http.StatusCreated)
+	}
+	if resp.Header.Get("Idempotent-Replayed") != "true" {
+		t.Error("retry was not answered with the saved response")
+	}
+	if created != 1 {
+		t.Errorf("handler ran %d times, want 1", created)
+	}
+}
@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/wb-go/wbf/ginext"
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/aliskhannn/comment-tree/internal/api/respond"
+	"github.com/aliskhannn/comment-tree/internal/auth"
+	"github.com/aliskhannn/comment-tree/internal/model"
+	"github.com/aliskhannn/comment-tree/internal/ratelimit"
+	"github.com/aliskhannn/comment-tree/internal/tenant"
+)
+
+// maxPeekBody is the largest request body read to find the thread of a write.
+const maxPeekBody = 64 << 10
+
+// CommentGetter loads comments, to find the thread of replies.
+type CommentGetter interface {
+	GetComment(ctx context.Context, id uuid.UUID) (model.Comment, error)
+}
+
+// RateLimitMiddleware returns a Gin middleware that limits requests per
+// client IP, authenticated user and thread of the tenant.
+//
+// GET, HEAD and OPTIONS requests spend the read budget and all others the
+// write budget. The thread is taken from the thread query parameter or, for
+// JSON writes, the thread field of the body or the thread of the comment
+// named by its parent_id field. The client IP is the address of the peer
+// unless it is a trusted proxy, see gin's SetTrustedProxies. Responses carry
+// RateLimit-Policy, RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset
+// headers for the most restrictive limit, and rejected requests get 429 with
+// Retry-After. If Redis fails, requests are let through.
+//
+// It must run after AuthMiddleware and TenantMiddleware.
+func RateLimitMiddleware(limiter *ratelimit.Limiter, budgets ratelimit.Budgets, comments CommentGetter) ginext.HandlerFunc {
+	return func(c *ginext.Context) {
+		tenantID, err := tenant.IDFromContext(c.Request.Context())
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		class, budget := "write", budgets.Write
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			class, budget = "read", budgets.Read
+		}
+		prefix := tenantID + ":" + class + ":"
+
+		rules := []ratelimit.Rule{{Key: prefix + "ip:" + c.ClientIP(), Limit: budget.IP}}
+		if user, ok := auth.UserFromContext(c.Request.Context()); ok {
+			rules = append(rules, ratelimit.Rule{Key: prefix + "user:" + user.ID, Limit: budget.User})
+		}
+		if thread, ok := requestThread(c, comments); ok {
+			rules = append(rules, ratelimit.Rule{Key: prefix + "thread:" + thread, Limit: budget.Thread})
+		}
+
+		res, err := limiter.Allow(c.Request.Context(), rules...)
+		if err != nil {
+			zlog.Logger.Error().Err(err).Msg("failed to check rate limit")
+			c.Next()
+			return
+		}
+
+		if res.Limit.Enabled() {
+			reset := strconv.Itoa(int(math.Ceil(res.Reset.Seconds())))
+
+			h := c.Writer.Header()
+			h.Set("RateLimit-Policy", res.Limit.Policy())
+			h.Set("RateLimit-Limit", strconv.Itoa(res.Limit.Requests))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", reset)
+
+			if !res.Allowed {
+				h.Set("Retry-After", reset)
+				respond.Fail(c.Writer, http.StatusTooManyRequests, errors.New("rate limit exceeded"))
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// requestThread returns the thread a request targets, if any: the thread
+// query parameter, or the thread field of a JSON write body or else the
+// thread of the comment named by its parent_id field. New root comments
+// without a thread target the default thread, whose key is empty.
+func requestThread(c *ginext.Context, comments CommentGetter) (string, bool) {
+	if thread, ok := c.GetQuery("thread"); ok {
+		return thread, true
+	}
+
+	if c.Request.Body == nil || c.Request.Method == http.MethodGet ||
+		!strings.HasPrefix(c.ContentType(), "application/json") {
+		return "", false
+	}
+
+	// Read the body and put it back for the handler.
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPeekBody+1))
+	c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+	if err != nil || len(body) > maxPeekBody {
+		return "", false
+	}
+
+	var fields struct {
+		Thread   string  `json:"thread"`
+		ParentID string  `json:"parent_id"`
+		Content  *string `json:"content"`
+	}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return "", false
+	}
+
+	if fields.ParentID == "" {
+		// New root comments without a thread go to the default thread.
+		isComment := c.Request.Method == http.MethodPost && fields.Content != nil
+		return fields.Thread, fields.Thread != "" || isComment
+	}
+
+	// Replies inherit the thread of their parent. A missing parent fails the
+	// request anyway, so it is only limited per IP and user.
+	parentID, err := uuid.Parse(fields.ParentID)
+	if err != nil {
+		return "", false
+	}
+	parent, err := comments.GetComment(c.Request.Context(), parentID)
+	if err != nil {
+		return "", false
+	}
+
+	return parent.ThreadKey, true
+}
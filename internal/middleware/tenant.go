@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/wb-go/wbf/ginext"
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/aliskhannn/comment-tree/internal/api/respond"
+	"github.com/aliskhannn/comment-tree/internal/auth"
+	"github.com/aliskhannn/comment-tree/internal/tenant"
+)
+
+// TenantMiddleware returns a Gin middleware that scopes the request to its tenant.
+//
+// It must run after AuthMiddleware, since credentials bound to a tenant only
+// grant access to that tenant, and credentials bound to none only to the
+// default tenant. Requests from browser origins the tenant does not allow are
+// rejected with 403.
+func TenantMiddleware(registry *tenant.Registry) ginext.HandlerFunc {
+	return func(c *ginext.Context) {
+		user, authenticated := auth.UserFromContext(c.Request.Context())
+
+		bound := user.TenantID
+		if authenticated && bound == "" {
+			bound = registry.DefaultTenant()
+		}
+
+		t, err := registry.Resolve(c.Request, bound)
+		if err != nil {
+			zlog.Logger.Warn().Err(err).Msg("failed to resolve tenant")
+
+			status := http.StatusBadRequest
+			if errors.Is(err, tenant.ErrTenantMismatch) {
+				status = http.StatusForbidden
+			}
+			respond.Fail(c.Writer, status, err)
+			c.Abort()
+			return
+		}
+
+		if origin := c.GetHeader("Origin"); origin != "" && !t.AllowsOrigin(origin) {
+			respond.Fail(c.Writer, http.StatusForbidden, errors.New("origin not allowed for tenant"))
+			c.Abort()
+			return
+		}
+
+		c.Request = c.Request.WithContext(tenant.WithTenant(c.Request.Context(), t))
+
+		c.Next()
+	}
+}
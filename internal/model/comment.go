@@ -6,10 +6,42 @@ import (
 	"github.com/google/uuid"
 )
 
+// DeletedPlaceholder replaces the content of soft-deleted comments.
+const DeletedPlaceholder = "[deleted]"
+
+// DeletedPlaceholderHTML replaces the rendered content of soft-deleted comments.
+const DeletedPlaceholderHTML = "<p>" + DeletedPlaceholder + "</p>"
+
 type Comment struct {
-	ID        uuid.UUID  `json:"id"`
-	ParentID  *uuid.UUID `json:"parent_id"`
-	Content   string     `json:"content"`
-	CreatedAt time.Time  `json:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at"`
+	ID               uuid.UUID  `json:"id"`
+	ParentID         *uuid.UUID `json:"parent_id"`
+	ThreadKey        string     `json:"thread"`       // page or resource the comment belongs to, inherited from the root
+	Content          string     `json:"content"`      // Markdown source
+	ContentHTML      string     `json:"content_html"` // Content rendered to sanitized HTML
+	Author           *Author    `json:"author"`       // nil for anonymous legacy and deleted comments
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	DeletedAt        *time.Time `json:"deleted_at,omitempty"`
+	Upvotes          int        `json:"upvotes"`
+	Downvotes        int        `json:"downvotes"`
+	Score            int        `json:"score"`  // upvotes minus downvotes
+	Status           string     `json:"status"` // moderation status, see StatusApproved
+	ModerationReason *string    `json:"moderation_reason,omitempty"`
+	Language         string     `json:"language"`            // text search configuration the content is indexed with
+	Highlight        string     `json:"highlight,omitempty"` // HTML snippets of the content matching a search, with matches in <mark>
+	Context          *Context   `json:"context,omitempty"`   // where a search hit sits in its thread
+	Reactions        []Reaction `json:"reactions"`           // aggregated by the service on reads
+}
+
+// Context places a comment in its thread.
+type Context struct {
+	Ancestors []Comment `json:"ancestors"`          // from the root down to the parent; empty for root comments
+	Children  []Comment `json:"children,omitempty"` // oldest first, up to the number requested
 }
+
+// Vote values of a user on a comment.
+const (
+	VoteUp   = 1
+	VoteDown = -1
+	VoteNone = 0 // withdraws a previous vote
+)
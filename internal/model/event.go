@@ -0,0 +1,40 @@
+package model
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event types of comment changes.
+const (
+	EventCommentCreated = "comment.created"
+	EventCommentUpdated = "comment.updated"
+	EventCommentDeleted = "comment.deleted"
+)
+
+// Event is a change of a comment pushed to subscribers.
+//
+// Events are delivered at least once; consumers de-duplicate them by EventID.
+type Event struct {
+	ID        string      `json:"id"`       // assigned by the broker, ordered within a tenant
+	EventID   uuid.UUID   `json:"event_id"` // assigned by the outbox, stable across redeliveries
+	Type      string      `json:"type"`
+	TenantID  string      `json:"-"`
+	Path      []uuid.UUID `json:"path"` // IDs from the root comment down to the changed comment
+	Comment   Comment     `json:"comment"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// OutboxEvent is an event claimed from the outbox for relaying.
+type OutboxEvent struct {
+	Event
+	Attempts  int      // failed relay attempts so far
+	Delivered []string // names of the sinks that already accepted the event
+}
+
+// InSubtree reports whether the changed comment is in the subtree of the comment with the given ID.
+func (e Event) InSubtree(id uuid.UUID) bool {
+	return slices.Contains(e.Path, id)
+}
@@ -0,0 +1,66 @@
+package model
+
+import "strings"
+
+// DefaultLanguage is the language of tenants that set none.
+const DefaultLanguage = "english"
+
+// languages maps the languages comments can be written in, by name and by
+// ISO 639-1 code, to the built-in PostgreSQL text search configuration that
+// stems them. "simple" only lowercases words, for languages without one.
+// The configurations must be allowed by the search_language domain.
+var languages = map[string]string{
+	"simple":     "simple",
+	"arabic":     "arabic",
+	"ar":         "arabic",
+	"danish":     "danish",
+	"da":         "danish",
+	"dutch":      "dutch",
+	"nl":         "dutch",
+	"english":    "english",
+	"en":         "english",
+	"finnish":    "finnish",
+	"fi":         "finnish",
+	"french":     "french",
+	"fr":         "french",
+	"german":     "german",
+	"de":         "german",
+	"greek":      "greek",
+	"el":         "greek",
+	"hungarian":  "hungarian",
+	"hu":         "hungarian",
+	"indonesian": "indonesian",
+	"id":         "indonesian",
+	"irish":      "irish",
+	"ga":         "irish",
+	"italian":    "italian",
+	"it":         "italian",
+	"lithuanian": "lithuanian",
+	"lt":         "lithuanian",
+	"nepali":     "nepali",
+	"ne":         "nepali",
+	"norwegian":  "norwegian",
+	"no":         "norwegian",
+	"portuguese": "portuguese",
+	"pt":         "portuguese",
+	"romanian":   "romanian",
+	"ro":         "romanian",
+	"russian":    "russian",
+	"ru":         "russian",
+	"spanish":    "spanish",
+	"es":         "spanish",
+	"swedish":    "swedish",
+	"sv":         "swedish",
+	"tamil":      "tamil",
+	"ta":         "tamil",
+	"turkish":    "turkish",
+	"tr":         "turkish",
+}
+
+// ParseLanguage returns the text search configuration of a language given by
+// name ("russian") or ISO 639-1 code ("ru"), case-insensitively. It reports
+// false for unsupported languages.
+func ParseLanguage(s string) (string, bool) {
+	lang, ok := languages[strings.ToLower(strings.TrimSpace(s))]
+	return lang, ok
+}
@@ -0,0 +1,26 @@
+package model
+
+import "github.com/google/uuid"
+
+// Moderation statuses of a comment.
+const (
+	StatusPending  = "pending"  // awaiting review, visible only to its author and moderators
+	StatusApproved = "approved" // publicly visible
+	StatusRejected = "rejected" // hidden after review
+	StatusSpam     = "spam"     // hidden after review as spam
+)
+
+// ModerationQuery holds the filters and pagination of the moderation queue.
+type ModerationQuery struct {
+	Status    string  // StatusPending if empty
+	ThreadKey *string // nil matches any thread
+	Limit     int
+	Offset    int
+}
+
+// ModerationDecision sets the status of several comments at once.
+type ModerationDecision struct {
+	IDs    []uuid.UUID
+	Status string // StatusApproved, StatusRejected or StatusSpam
+	Reason string // optional, shown to the authors of the comments
+}
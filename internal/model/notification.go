@@ -0,0 +1,71 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Notification types.
+const (
+	// NotificationMention notifies a user mentioned as @username in a comment.
+	NotificationMention = "mention"
+	// NotificationReply notifies the author of a comment about a reply to it.
+	NotificationReply = "reply"
+)
+
+// Notification tells a user about a comment that concerns them.
+type Notification struct {
+	ID        uuid.UUID  `json:"id"`
+	Type      string     `json:"type"`
+	CommentID uuid.UUID  `json:"comment_id"`
+	ThreadKey string     `json:"thread"`
+	Actor     *Author    `json:"actor"`   // author of the comment
+	Excerpt   string     `json:"excerpt"` // start of the comment's content
+	CreatedAt time.Time  `json:"created_at"`
+	ReadAt    *time.Time `json:"read_at"` // nil while unread
+}
+
+// NotificationQuery selects a page of the notifications of a user, newest first.
+type NotificationQuery struct {
+	UnreadOnly bool
+	Limit      int
+	Offset     int
+}
+
+// NotificationPage is a page of notifications with the total number of unread ones.
+type NotificationPage struct {
+	Items  []Notification `json:"items"`
+	Unread int            `json:"unread"`
+}
+
+// Email delivery modes of notifications.
+const (
+	DeliveryInstant = "instant" // one email as soon as possible
+	DeliveryHourly  = "hourly"  // at most one digest per hour
+	DeliveryDaily   = "daily"   // at most one digest per day
+	DeliveryOff     = "off"     // no emails
+)
+
+// NotificationPreferences are the email delivery settings of a user.
+type NotificationPreferences struct {
+	Delivery string `json:"delivery"`
+	Email    string `json:"email"` // address emails are sent to, taken from the user's credentials
+}
+
+// DigestRecipient is a user with notifications due to be emailed.
+type DigestRecipient struct {
+	TenantID      string
+	UserID        string
+	Email         string
+	Name          string
+	Delivery      string
+	NotifiedUntil time.Time // notifications created up to this time were already emailed
+}
+
+// Digest is the notifications of one email, newest first.
+type Digest struct {
+	Items []Notification
+	Total int       // number of pending notifications, which may exceed len(Items)
+	Until time.Time // creation time of the newest pending notification
+}
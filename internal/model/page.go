@@ -0,0 +1,42 @@
+package model
+
+import "github.com/google/uuid"
+
+// Search modes of comment lists.
+const (
+	SearchFTS    = "fts"    // full-text search of stemmed words
+	SearchFuzzy  = "fuzzy"  // trigram similarity, tolerating typos
+	SearchPrefix = "prefix" // words starting with the search terms
+)
+
+// CommentQuery holds the filters, sorting and pagination of a comment list.
+type CommentQuery struct {
+	ParentID   *uuid.UUID
+	ThreadKey  *string // nil matches any thread
+	Search     string
+	SearchMode string // SearchFTS if empty
+	Language   string // text search configuration of Search, empty for the thread's or tenant's
+	Children   int    // replies loaded into the Context of every search hit
+	Sort       string
+	Limit      int
+
+	// Cursor is a token from CommentPage.NextCursor or CommentPage.PrevCursor.
+	// When set, Offset is ignored.
+	Cursor string
+	// Offset is the legacy pagination offset.
+	Offset int
+}
+
+// CommentPage is a page of a comment list.
+type CommentPage struct {
+	Items      []Comment `json:"items"`
+	NextCursor string    `json:"next_cursor,omitempty"` // loads the page after Items
+	PrevCursor string    `json:"prev_cursor,omitempty"` // loads the page before Items
+}
+
+// AutocompleteQuery selects completions of a partial word in comments.
+type AutocompleteQuery struct {
+	ThreadKey *string // nil matches any thread
+	Prefix    string  // start of the word to complete
+	Limit     int
+}
@@ -0,0 +1,8 @@
+package model
+
+// Reaction is the aggregated count of an emoji reaction on a comment.
+type Reaction struct {
+	Emoji   string `json:"emoji"`
+	Count   int    `json:"count"`
+	Reacted bool   `json:"reacted"` // whether the current user reacted with the emoji
+}
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// Report reasons.
+const (
+	ReportSpam           = "spam"
+	ReportHarassment     = "harassment"
+	ReportHate           = "hate"
+	ReportMisinformation = "misinformation"
+	ReportOffTopic       = "off_topic"
+	ReportOther          = "other"
+)
+
+// ReportReasons are the reasons a comment can be reported for.
+var ReportReasons = []string{
+	ReportSpam, ReportHarassment, ReportHate, ReportMisinformation, ReportOffTopic, ReportOther,
+}
+
+// ReportedComment is a comment with the aggregated open reports against it.
+type ReportedComment struct {
+	Comment        Comment        `json:"comment"`
+	Reports        int            `json:"reports"` // number of open reports
+	Reasons        map[string]int `json:"reasons"` // number of open reports per reason
+	LastReportedAt time.Time      `json:"last_reported_at"`
+}
@@ -0,0 +1,39 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Revision is a single version of a comment's content.
+//
+// Versions are numbered from 1 (the original content); the highest version
+// is always the current content of the comment.
+type Revision struct {
+	CommentID uuid.UUID `json:"comment_id"`
+	Version   int       `json:"version"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Diff operation kinds.
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// DiffOp is a single fragment of a diff between two revisions.
+type DiffOp struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// RevisionDiff describes the changes between two revisions of a comment.
+type RevisionDiff struct {
+	CommentID uuid.UUID `json:"comment_id"`
+	From      int       `json:"from"`
+	To        int       `json:"to"`
+	Ops       []DiffOp  `json:"ops"`
+}
@@ -0,0 +1,30 @@
+package model
+
+// Moderation modes.
+const (
+	// ModerationPost publishes comments immediately; moderators review them afterwards.
+	ModerationPost = "post"
+	// ModerationPre holds comments until a moderator approves them.
+	ModerationPre = "pre"
+)
+
+// Tenant is an isolated consumer of a shared deployment with its own settings.
+type Tenant struct {
+	ID               string
+	Subdomain        string   // host label resolving to the tenant, e.g. "acme" in acme.comments.example.com
+	MaxContentLength int      // maximum comment length in characters
+	CORSOrigins      []string // origins allowed to call the API for this tenant
+	ModerationMode   string   // ModerationPost or ModerationPre
+	ReportThreshold  int      // open reports that hide a comment pending review
+	Language         string   // text search configuration of comments in threads that set none
+}
+
+// AllowsOrigin reports whether browsers on origin may call the API for this tenant.
+func (t Tenant) AllowsOrigin(origin string) bool {
+	for _, o := range t.CORSOrigins {
+		if o == "*" || o == origin {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package model
+
+import "github.com/google/uuid"
+
+// CommentNode is a comment with its nested replies.
+type CommentNode struct {
+	Comment
+	Depth      int            `json:"depth"`       // distance from the root of the returned tree
+	ReplyCount int            `json:"reply_count"` // number of direct replies, including ones not loaded
+	Children   []*CommentNode `json:"children"`
+
+	// NextCursor is set when some replies of the node were not loaded. It
+	// continues loading the node's replies after the ones in Children.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// TreeOptions limits how much of a subtree is loaded.
+//
+// Zero values mean no limit. A non-nil ThreadKey only matches trees of that thread.
+type TreeOptions struct {
+	MaxDepth           int    // maximum depth of loaded replies relative to the root
+	MaxChildrenPerNode int    // maximum number of loaded replies per comment
+	Cursor             string // continuation token returned in CommentNode.NextCursor
+	ThreadKey          *string
+	Sort               string // sort mode of siblings, as in CommentQuery; oldest first if empty
+}
+
+// Limited reports whether the options restrict the loaded subtree.
+func (o TreeOptions) Limited() bool {
+	return o.MaxDepth > 0 || o.MaxChildrenPerNode > 0 || o.Cursor != ""
+}
+
+// BuildTree assembles a flat list of comments into a tree rooted at rootID.
+//
+// Siblings keep their relative order from comments. Comments whose parent is
+// not in the list are dropped. It returns nil if rootID is not in the list.
+func BuildTree(comments []Comment, rootID uuid.UUID) *CommentNode {
+	nodes := make([]*CommentNode, 0, len(comments))
+	for _, c := range comments {
+		nodes = append(nodes, &CommentNode{Comment: c})
+	}
+
+	root := LinkTree(nodes, rootID)
+	if root == nil {
+		return nil
+	}
+
+	setDepth(root, 0)
+
+	return root
+}
+
+// LinkTree links nodes into a tree rooted at rootID without touching their
+// Depth and ReplyCount.
+//
+// Siblings keep their relative order from nodes. Nodes whose parent is not in
+// the list are dropped. It returns nil if rootID is not in the list.
+func LinkTree(nodes []*CommentNode, rootID uuid.UUID) *CommentNode {
+	byID := make(map[uuid.UUID]*CommentNode, len(nodes))
+	for _, n := range nodes {
+		n.Children = []*CommentNode{}
+		byID[n.ID] = n
+	}
+
+	root, ok := byID[rootID]
+	if !ok {
+		return nil
+	}
+
+	for _, n := range nodes {
+		if n.ID == rootID || n.ParentID == nil {
+			continue
+		}
+		if parent, ok := byID[*n.ParentID]; ok {
+			parent.Children = append(parent.Children, n)
+		}
+	}
+
+	return root
+}
+
+// setDepth fills Depth and ReplyCount for the subtree rooted at n.
+func setDepth(n *CommentNode, depth int) {
+	n.Depth = depth
+	n.ReplyCount = len(n.Children)
+	for _, child := range n.Children {
+		setDepth(child, depth+1)
+	}
+}
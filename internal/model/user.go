@@ -0,0 +1,30 @@
+package model
+
+// User roles.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// User is an authenticated caller of the API.
+type User struct {
+	ID       string
+	Name     string
+	Username string // handle others mention the user by, empty if the user has none
+	Email    string // address notifications are emailed to, empty if unknown
+	Role     string
+	TenantID string // tenant the credentials are bound to, empty for the default tenant
+}
+
+// IsModerator reports whether the user may moderate other users' comments.
+func (u User) IsModerator() bool {
+	return u.Role == RoleModerator || u.Role == RoleAdmin
+}
+
+// Author identifies the author of a comment.
+type Author struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Username string `json:"username,omitempty"`
+}
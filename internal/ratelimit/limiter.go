@@ -0,0 +1,163 @@
+// Package ratelimit limits request rates with sliding windows kept in Redis.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/wb-go/wbf/redis"
+)
+
+// keyPrefix prefixes the sorted sets holding the requests of a window.
+const keyPrefix = "ratelimit:"
+
+// Limit allows Requests per sliding Window. A zero Limit is unlimited.
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// Enabled reports whether the limit restricts anything.
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Window > 0
+}
+
+// Policy formats the limit as a RateLimit-Policy header value, e.g. "10;w=60".
+func (l Limit) Policy() string {
+	return strconv.Itoa(l.Requests) + ";w=" + strconv.FormatInt(int64(l.Window.Seconds()), 10)
+}
+
+// Budget holds the limits of a class of requests per client IP, per
+// authenticated user and per thread.
+type Budget struct {
+	IP     Limit
+	User   Limit
+	Thread Limit
+}
+
+// Budgets holds the budgets of reads and writes.
+type Budgets struct {
+	Read  Budget
+	Write Budget
+}
+
+// Rule applies a Limit to the requests sharing a key.
+type Rule struct {
+	Key   string
+	Limit Limit
+}
+
+// Result is the outcome of a check.
+type Result struct {
+	Allowed   bool
+	Limit     Limit         // limit of the most restrictive rule
+	Remaining int           // requests left under that limit
+	Reset     time.Duration // time until that limit frees up a request
+}
+
+// allowScript checks every key against its limit and, if all allow the
+// request, records it under each key. It returns whether the request was
+// allowed and the index, remaining requests and reset in milliseconds of the
+// most restrictive key: the blocking key that resets last, or the allowing
+// key with the fewest requests left.
+//
+// KEYS are the window sets, ARGV[1] the current time in milliseconds,
+// ARGV[2] a unique member for the request, followed by the request limit
+// and window in milliseconds of every key.
+var allowScript = goredis.NewScript(`
+local now = tonumber(ARGV[1])
+local allowed = 1
+local pick, pick_remaining, pick_reset = 0, -1, 0
+
+for i, key in ipairs(KEYS) do
+	local limit = tonumber(ARGV[1 + 2 * i])
+	local window = tonumber(ARGV[2 + 2 * i])
+
+	redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+	local count = redis.call('ZCARD', key)
+
+	local reset = window
+	local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+	if oldest[2] then
+		reset = tonumber(oldest[2]) + window - now
+	end
+
+	if count >= limit then
+		if allowed == 1 or reset > pick_reset then
+			pick, pick_remaining, pick_reset = i, 0, reset
+		end
+		allowed = 0
+	elseif allowed == 1 then
+		local remaining = limit - count - 1
+		if pick_remaining < 0 or remaining < pick_remaining then
+			pick, pick_remaining, pick_reset = i, remaining, reset
+		end
+	end
+end
+
+if allowed == 1 then
+	for i, key in ipairs(KEYS) do
+		redis.call('ZADD', key, now, ARGV[2])
+		redis.call('PEXPIRE', key, ARGV[2 + 2 * i])
+	end
+end
+
+return {allowed, pick, pick_remaining, pick_reset}
+`)
+
+// Limiter checks requests against sliding window limits.
+//
+// Each key holds the timestamps of its requests within the window, so limits
+// are exact across instances sharing the Redis.
+type Limiter struct {
+	rdb *redis.Client
+}
+
+// NewLimiter creates a new Limiter.
+func NewLimiter(rdb *redis.Client) *Limiter {
+	return &Limiter{rdb: rdb}
+}
+
+// Allow records a request under every rule if none of them is exhausted.
+//
+// Rules with a disabled limit are ignored; without any rule the request is
+// allowed with a zero Limit.
+func (l *Limiter) Allow(ctx context.Context, rules ...Rule) (Result, error) {
+	var (
+		keys   []string
+		limits []Limit
+	)
+	args := []any{time.Now().UnixMilli(), uuid.NewString()}
+
+	for _, r := range rules {
+		if !r.Limit.Enabled() {
+			continue
+		}
+		keys = append(keys, keyPrefix+r.Key)
+		limits = append(limits, r.Limit)
+		args = append(args, r.Limit.Requests, r.Limit.Window.Milliseconds())
+	}
+
+	if len(keys) == 0 {
+		return Result{Allowed: true}, nil
+	}
+
+	res, err := allowScript.Run(ctx, l.rdb, keys, args...).Int64Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to check rate limit: %w", err)
+	}
+	if len(res) != 4 || res[1] < 1 || int(res[1]) > len(limits) {
+		return Result{}, fmt.Errorf("unexpected rate limit result %v", res)
+	}
+
+	return Result{
+		Allowed:   res[0] == 1,
+		Limit:     limits[res[1]-1],
+		Remaining: int(res[2]),
+		Reset:     time.Duration(res[3]) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,286 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/wb-go/wbf/redis"
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/aliskhannn/comment-tree/internal/model"
+)
+
+// ErrInvalidEventID is returned when a resume event ID is malformed.
+var ErrInvalidEventID = errors.New("invalid event id")
+
+const (
+	// keyPrefix prefixes the per-tenant stream and pub/sub channel of events.
+	keyPrefix = "comments:events:"
+
+	// subscriberBuffer is the number of live events buffered per subscriber.
+	// Subscribers that fall further behind are dropped and have to resume.
+	subscriberBuffer = 64
+)
+
+// Broker distributes comment events across instances through Redis.
+//
+// Every event is appended to a capped per-tenant stream, which assigns its ID
+// and keeps it for replay, and published on the tenant's channel. Each
+// instance holds one pattern subscription and fans events out to its local
+// subscribers.
+type Broker struct {
+	rdb    *redis.Client
+	maxLen int64
+
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
+}
+
+// subscriber is a local consumer of the live events of a tenant.
+type subscriber struct {
+	tenantID string
+	events   chan model.Event
+}
+
+// NewBroker creates a new Broker keeping about maxLen events per tenant for replay.
+func NewBroker(rdb *redis.Client, maxLen int64) *Broker {
+	return &Broker{
+		rdb:         rdb,
+		maxLen:      maxLen,
+		subscribers: make(map[*subscriber]struct{}),
+	}
+}
+
+// Publish appends the event to the stream of its tenant and fans it out to subscribers.
+func (b *Broker) Publish(ctx context.Context, e model.Event) error {
+	key := keyPrefix + e.TenantID
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	e.ID, err = b.rdb.XAdd(ctx, &goredis.XAddArgs{
+		Stream: key,
+		MaxLen: b.maxLen,
+		Approx: true,
+		Values: map[string]interface{}{"event": data},
+	}).Result()
+	if err != nil {
+		return fmt.Errorf("failed to append event: %w", err)
+	}
+
+	if data, err = json.Marshal(e); err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	if err := b.rdb.Publish(ctx, key, data).Err(); err != nil {
+		return fmt.Errorf("failed to publish event: %w", err)
+	}
+
+	return nil
+}
+
+// Run receives the events published by all instances and dispatches them to
+// local subscribers until ctx is done.
+func (b *Broker) Run(ctx context.Context) {
+	pubsub := b.rdb.PSubscribe(ctx, keyPrefix+"*")
+	defer func() {
+		if err := pubsub.Close(); err != nil {
+			zlog.Logger.Error().Err(err).Msg("failed to close event subscription")
+		}
+	}()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+
+			var e model.Event
+			if err := json.Unmarshal([]byte(msg.Payload), &e); err != nil {
+				zlog.Logger.Error().Err(err).Str("channel", msg.Channel).Msg("failed to decode event")
+				continue
+			}
+			e.TenantID = strings.TrimPrefix(msg.Channel, keyPrefix)
+
+			b.dispatch(e)
+		}
+	}
+}
+
+// Subscribe returns the events of a tenant until ctx is done.
+//
+// If lastEventID is set, the retained events after it are replayed first.
+// The channel is closed when ctx is done or the subscriber falls too far
+// behind; the caller can then resume from the last event it received.
+func (b *Broker) Subscribe(ctx context.Context, tenantID, lastEventID string) (<-chan model.Event, error) {
+	if lastEventID != "" {
+		if _, _, ok := parseEventID(lastEventID); !ok {
+			return nil, ErrInvalidEventID
+		}
+	}
+
+	// Register before replaying so no event falls between the two.
+	s := &subscriber{tenantID: tenantID, events: make(chan model.Event, subscriberBuffer)}
+	b.add(s)
+
+	var backlog []model.Event
+	if lastEventID != "" {
+		var err error
+		if backlog, err = b.replay(ctx, tenantID, lastEventID); err != nil {
+			b.remove(s)
+			return nil, err
+		}
+	}
+
+	out := make(chan model.Event)
+	go b.forward(ctx, s, backlog, lastEventID, out)
+
+	return out, nil
+}
+
+// forward sends the backlog and then the live events of s to out, skipping
+// live events that were already replayed.
+func (b *Broker) forward(ctx context.Context, s *subscriber, backlog []model.Event, lastID string, out chan<- model.Event) {
+	defer close(out)
+	defer b.remove(s)
+
+	send := func(e model.Event) bool {
+		select {
+		case out <- e:
+			lastID = e.ID
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	for _, e := range backlog {
+		if !send(e) {
+			return
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-s.events:
+			if !ok {
+				return
+			}
+			if lastID != "" && !eventIDAfter(e.ID, lastID) {
+				continue
+			}
+			if !send(e) {
+				return
+			}
+		}
+	}
+}
+
+// replay returns the retained events of a tenant after lastID.
+func (b *Broker) replay(ctx context.Context, tenantID, lastID string) ([]model.Event, error) {
+	msgs, err := b.rdb.XRangeN(ctx, keyPrefix+tenantID, lastID, "+", b.maxLen+1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to replay events: %w", err)
+	}
+
+	events := make([]model.Event, 0, len(msgs))
+	for _, msg := range msgs {
+		if msg.ID == lastID {
+			continue
+		}
+
+		data, _ := msg.Values["event"].(string)
+
+		var e model.Event
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			zlog.Logger.Error().Err(err).Str("id", msg.ID).Msg("failed to decode replayed event")
+			continue
+		}
+		e.ID = msg.ID
+		e.TenantID = tenantID
+
+		events = append(events, e)
+	}
+
+	return events, nil
+}
+
+// dispatch hands an event to the local subscribers of its tenant.
+func (b *Broker) dispatch(e model.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.subscribers {
+		if s.tenantID != e.TenantID {
+			continue
+		}
+
+		select {
+		case s.events <- e:
+		default:
+			zlog.Logger.Warn().Str("tenant", s.tenantID).Msg("dropping slow event subscriber")
+			delete(b.subscribers, s)
+			close(s.events)
+		}
+	}
+}
+
+// add registers a subscriber.
+func (b *Broker) add(s *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscribers[s] = struct{}{}
+}
+
+// remove unregisters a subscriber unless it was already dropped.
+func (b *Broker) remove(s *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[s]; ok {
+		delete(b.subscribers, s)
+		close(s.events)
+	}
+}
+
+// eventIDAfter reports whether stream ID a comes after stream ID b.
+func eventIDAfter(a, b string) bool {
+	aMs, aSeq, _ := parseEventID(a)
+	bMs, bSeq, _ := parseEventID(b)
+
+	return aMs > bMs || (aMs == bMs && aSeq > bSeq)
+}
+
+// parseEventID splits a Redis stream ID of the form <ms>-<seq>.
+func parseEventID(id string) (ms, seq uint64, ok bool) {
+	msPart, seqPart, found := strings.Cut(id, "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	seq, err = strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return ms, seq, true
+}
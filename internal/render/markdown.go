@@ -0,0 +1,81 @@
+// Package render turns comment content into safe HTML.
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+)
+
+// Markdown renders the Markdown dialect of comments to sanitized HTML.
+//
+// The dialect covers paragraphs with hard line breaks, emphasis,
+// strikethrough, inline and fenced code, links, bare URLs, block quotes and
+// lists. Headings, rules, images and raw HTML are not part of it: headings
+// and rules stay literal text, images are dropped and raw HTML is escaped.
+// The output is filtered through an allowlist of elements and attributes,
+// and links only keep http, https and mailto URLs and are marked as user
+// content that search engines should not follow.
+type Markdown struct {
+	md     goldmark.Markdown
+	policy *bluemonday.Policy
+}
+
+// NewMarkdown creates a new Markdown renderer.
+func NewMarkdown() *Markdown {
+	// Replace the default parsers rather than adding to them, so the
+	// constructs outside the dialect are never parsed.
+	p := parser.NewParser(
+		parser.WithBlockParsers(
+			util.Prioritized(parser.NewListParser(), 300),
+			util.Prioritized(parser.NewListItemParser(), 400),
+			util.Prioritized(parser.NewCodeBlockParser(), 500),
+			util.Prioritized(parser.NewFencedCodeBlockParser(), 700),
+			util.Prioritized(parser.NewBlockquoteParser(), 800),
+			util.Prioritized(parser.NewParagraphParser(), 1000),
+		),
+		parser.WithInlineParsers(
+			util.Prioritized(parser.NewCodeSpanParser(), 100),
+			util.Prioritized(parser.NewLinkParser(), 200),
+			util.Prioritized(parser.NewAutoLinkParser(), 300),
+			util.Prioritized(parser.NewEmphasisParser(), 500),
+		),
+		parser.WithParagraphTransformers(parser.DefaultParagraphTransformers()...),
+	)
+
+	md := goldmark.New(
+		goldmark.WithParser(p),
+		goldmark.WithExtensions(extension.Linkify, extension.Strikethrough),
+		goldmark.WithRendererOptions(html.WithHardWraps()),
+	)
+
+	policy := bluemonday.NewPolicy()
+	policy.AllowElements("p", "br", "em", "strong", "del", "code", "pre", "blockquote", "ul", "ol", "li")
+	policy.AllowAttrs("start").Matching(regexp.MustCompile(`^[0-9]{1,9}$`)).OnElements("ol")
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+-]{1,32}$`)).OnElements("code")
+	policy.AllowAttrs("href").OnElements("a")
+	policy.AllowURLSchemes("http", "https", "mailto")
+	policy.RequireParseableURLs(true)
+	policy.RequireNoFollowOnLinks(true)
+	policy.RequireNoReferrerOnLinks(true)
+	policy.AddTargetBlankToFullyQualifiedLinks(true)
+
+	return &Markdown{md: md, policy: policy}
+}
+
+// Render renders content to sanitized HTML.
+func (m *Markdown) Render(content string) (string, error) {
+	var buf bytes.Buffer
+	if err := m.md.Convert([]byte(content), &buf); err != nil {
+		return "", fmt.Errorf("failed to render markdown: %w", err)
+	}
+
+	return m.policy.Sanitize(buf.String()), nil
+}
@@ -0,0 +1,37 @@
+package comment
+
+import (
+	"github.com/google/uuid"
+
+	"github.com/aliskhannn/comment-tree/internal/cursor"
+)
+
+// pageCursor is the decoded form of a list page cursor.
+//
+// It points between two rows: the one with the given sort key and ID, and
+// its neighbour in the direction of travel.
+type pageCursor struct {
+	Sort   string    `json:"s"`           // sort mode the cursor was issued for
+	Key    string    `json:"k"`           // sort key of the boundary row, as Postgres text
+	ID     uuid.UUID `json:"id"`          // ID of the boundary row, the tie-breaker
+	Before bool      `json:"b,omitempty"` // whether the page lies before the boundary row
+}
+
+// encode returns the opaque URL-safe form of the cursor.
+func (c pageCursor) encode() string {
+	return cursor.Encode(c)
+}
+
+// decodePageCursor decodes a cursor issued for the given sort mode.
+func decodePageCursor(token, sort string) (pageCursor, error) {
+	var c pageCursor
+	if err := cursor.Decode(token, &c); err != nil {
+		return pageCursor{}, err
+	}
+
+	if c.Sort != sort {
+		return pageCursor{}, cursor.ErrInvalid
+	}
+
+	return c, nil
+}
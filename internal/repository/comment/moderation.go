@@ -0,0 +1,236 @@
+package comment
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/aliskhannn/comment-tree/internal/auth"
+	"github.com/aliskhannn/comment-tree/internal/model"
+	"github.com/aliskhannn/comment-tree/internal/tenant"
+)
+
+// viewer returns the ID of the user in ctx, empty for anonymous requests, and
+// whether the user may see unapproved comments of others.
+func viewer(ctx context.Context) (string, bool) {
+	user, ok := auth.UserFromContext(ctx)
+	if !ok {
+		return "", false
+	}
+
+	return user.ID, user.IsModerator()
+}
+
+// visibleTo returns a condition on the comments aliased as alias that holds
+// for the comments a viewer may see: approved ones, their own and, for
+// moderators, all. The viewer ID and moderator flag are the params with the
+// given indexes.
+func visibleTo(alias string, viewerArg, allArg int) string {
+	if alias != "" {
+		alias += "."
+	}
+
+	return fmt.Sprintf(
+		"(%sstatus = '%s' OR %sauthor_id = $%d OR $%d::bool)",
+		alias, model.StatusApproved, alias, viewerArg, allArg,
+	)
+}
+
+// masked returns c as it is shown once deleted, for events about comments
+// that were hidden.
+func masked(c model.Comment) model.Comment {
+	c.Content, c.ContentHTML, c.Author = model.DeletedPlaceholder, model.DeletedPlaceholderHTML, nil
+	return c
+}
+
+// GetModerationQueue returns the live comments of the tenant in ctx with the
+// status of q, oldest first.
+func (r *Repository) GetModerationQueue(ctx context.Context, q model.ModerationQuery) ([]model.Comment, error) {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + commentColumns + ` FROM comments WHERE tenant_id = $1 AND status = $2 AND deleted_at IS NULL`
+	args := []interface{}{tenantID, q.Status}
+
+	if q.ThreadKey != nil {
+		query += ` AND thread_key = $3`
+		args = append(args, *q.ThreadKey)
+	}
+
+	query += fmt.Sprintf(" ORDER BY created_at, id LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	args = append(args, q.Limit, q.Offset)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get moderation queue: %w", err)
+	}
+	defer rows.Close()
+
+	comments := []model.Comment{}
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan comment: %w", err)
+		}
+		comments = append(comments, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get moderation queue: %w", err)
+	}
+
+	return comments, nil
+}
+
+// ModerateComments sets the status and reason of the live comments with the
+// given IDs and returns the changed comments. IDs of missing or deleted
+// comments are skipped.
+//
+// Open reports against the comments are resolved. Comments that become
+// visible are recorded in the outbox as created and comments that become
+// hidden as deleted, in the same transaction.
+func (r *Repository) ModerateComments(ctx context.Context, d model.ModerationDecision, moderatorID string) ([]model.Comment, error) {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		WITH old AS (
+			SELECT id AS old_id, status AS old_status
+			FROM comments
+			WHERE id = ANY($1) AND tenant_id = $2 AND deleted_at IS NULL
+			FOR UPDATE
+		)
+		UPDATE comments
+		SET status = $3,
+		    moderation_reason = NULLIF($4, ''),
+		    moderated_by = $5,
+		    moderated_at = CURRENT_TIMESTAMP
+		FROM old
+		WHERE id = old.old_id
+		RETURNING ` + commentColumns + `, old.old_status
+	`
+
+	tx, err := r.db.Master.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.QueryContext(ctx, query, pq.Array(d.IDs), tenantID, d.Status, d.Reason, moderatorID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to moderate comments: %w", err)
+	}
+
+	comments := []model.Comment{}
+	var oldStatuses []string
+	for rows.Next() {
+		var oldStatus string
+		c, err := scanComment(rows, &oldStatus)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan comment: %w", err)
+		}
+		comments = append(comments, c)
+		oldStatuses = append(oldStatuses, oldStatus)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to moderate comments: %w", err)
+	}
+
+	ids := make([]uuid.UUID, len(comments))
+	for i, c := range comments {
+		ids[i] = c.ID
+	}
+	if err := resolveReports(ctx, tx, ids); err != nil {
+		return nil, err
+	}
+
+	for i, c := range comments {
+		wasVisible, isVisible := oldStatuses[i] == model.StatusApproved, c.Status == model.StatusApproved
+
+		switch {
+		case isVisible && !wasVisible:
+			err = insertEvent(ctx, tx, tenantID, model.EventCommentCreated, c)
+		case wasVisible && !isVisible:
+			err = insertEvent(ctx, tx, tenantID, model.EventCommentDeleted, masked(c))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return comments, nil
+}
+
+// threadSettings are the columns of thread_settings overriding tenant settings.
+const threadSettings = "moderation_mode, language"
+
+// SetThreadModerationMode overrides the moderation mode of the tenant in ctx
+// for a thread. An empty mode removes the override.
+func (r *Repository) SetThreadModerationMode(ctx context.Context, threadKey, mode string) error {
+	if err := r.setThreadSetting(ctx, threadKey, "moderation_mode", mode); err != nil {
+		return fmt.Errorf("failed to set thread moderation mode: %w", err)
+	}
+
+	return nil
+}
+
+// SetThreadLanguage overrides the language of the tenant in ctx for new
+// comments and searches in a thread. An empty language removes the override.
+func (r *Repository) SetThreadLanguage(ctx context.Context, threadKey, language string) error {
+	if err := r.setThreadSetting(ctx, threadKey, "language", language); err != nil {
+		return fmt.Errorf("failed to set thread language: %w", err)
+	}
+
+	return nil
+}
+
+// setThreadSetting sets one of the threadSettings columns for a thread of the
+// tenant in ctx, or clears it if value is empty. Threads without any setting
+// left lose their row.
+func (r *Repository) setThreadSetting(ctx context.Context, threadKey, column, value string) error {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	if value == "" {
+		query := `
+			DELETE FROM thread_settings
+			WHERE tenant_id = $1 AND thread_key = $2 AND num_nonnulls(` + threadSettings + `) = num_nonnulls(` + column + `)
+		`
+		if _, err := r.db.ExecContext(ctx, query, tenantID, threadKey); err != nil {
+			return err
+		}
+
+		query = `
+			UPDATE thread_settings
+			SET ` + column + ` = NULL, updated_at = CURRENT_TIMESTAMP
+			WHERE tenant_id = $1 AND thread_key = $2
+		`
+		_, err := r.db.ExecContext(ctx, query, tenantID, threadKey)
+		return err
+	}
+
+	query := `
+		INSERT INTO thread_settings (tenant_id, thread_key, ` + column + `)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (tenant_id, thread_key)
+		DO UPDATE SET ` + column + ` = EXCLUDED.` + column + `, updated_at = CURRENT_TIMESTAMP
+	`
+
+	_, err = r.db.ExecContext(ctx, query, tenantID, threadKey, value)
+	return err
+}
@@ -0,0 +1,50 @@
+package comment
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/aliskhannn/comment-tree/internal/model"
+)
+
+// insertEvent records a change of c in the outbox as part of tx, so the event
+// is published if and only if the change is committed.
+//
+// Unapproved comments are hidden from the public, so only their deletion is
+// recorded.
+func insertEvent(ctx context.Context, tx *sql.Tx, tenantID, eventType string, c model.Comment) error {
+	if c.Status != model.StatusApproved && eventType != model.EventCommentDeleted {
+		return nil
+	}
+
+	path, err := ancestorIDs(ctx, tx, c.ID, tenantID)
+	if err != nil {
+		return err
+	}
+	slices.Reverse(path)
+
+	payload, err := json.Marshal(model.Event{
+		Type:      eventType,
+		Path:      path,
+		Comment:   c,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	query := `
+		INSERT INTO outbox_events (tenant_id, event_type, payload)
+		VALUES ($1, $2, $3::jsonb)
+	`
+
+	if _, err := tx.ExecContext(ctx, query, tenantID, eventType, string(payload)); err != nil {
+		return fmt.Errorf("failed to record event: %w", err)
+	}
+
+	return nil
+}
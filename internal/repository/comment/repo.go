@@ -2,17 +2,88 @@ package comment
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/wb-go/wbf/dbpg"
 	"github.com/wb-go/wbf/zlog"
 
 	"github.com/aliskhannn/comment-tree/internal/model"
+	"github.com/aliskhannn/comment-tree/internal/tenant"
 )
 
-var ErrCommentNotFound = errors.New("comment not found")
+var (
+	ErrCommentNotFound = errors.New("comment not found")
+	ErrParentNotFound  = errors.New("parent comment not found")
+)
+
+// commentColumns is the select list shared by comment queries.
+//
+// Soft-deleted comments keep their place in the tree, but their content is
+// replaced with a placeholder and their author is hidden.
+const commentColumns = `
+	id,
+	parent_id,
+	thread_key,
+	CASE WHEN deleted_at IS NULL THEN content ELSE '` + model.DeletedPlaceholder + `' END,
+	CASE WHEN deleted_at IS NULL THEN content_html ELSE '` + model.DeletedPlaceholderHTML + `' END,
+	created_at,
+	updated_at,
+	deleted_at,
+	CASE WHEN deleted_at IS NULL THEN author_id END,
+	CASE WHEN deleted_at IS NULL THEN author_name END,
+	CASE WHEN deleted_at IS NULL THEN author_username END,
+	upvotes,
+	downvotes,
+	score,
+	status,
+	moderation_reason,
+	language
+`
+
+// scanner is implemented by *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanComment scans a row selected with commentColumns followed by the
+// columns scanned into extra.
+func scanComment(row scanner, extra ...any) (model.Comment, error) {
+	var (
+		c                                    model.Comment
+		authorID, authorName, authorUsername *string
+	)
+
+	dest := append([]any{
+		&c.ID, &c.ParentID, &c.ThreadKey, &c.Content, &c.ContentHTML, &c.CreatedAt, &c.UpdatedAt, &c.DeletedAt,
+		&authorID, &authorName, &authorUsername, &c.Upvotes, &c.Downvotes, &c.Score,
+		&c.Status, &c.ModerationReason, &c.Language,
+	}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return model.Comment{}, err
+	}
+
+	if authorID != nil {
+		c.Author = &model.Author{ID: *authorID}
+		if authorName != nil {
+			c.Author.Name = *authorName
+		}
+		if authorUsername != nil {
+			c.Author.Username = *authorUsername
+		}
+	}
+
+	return c, nil
+}
 
 // Repository provides methods for interacting with the comments table.
 type Repository struct {
@@ -24,52 +95,164 @@ func NewRepository(db *dbpg.DB) *Repository {
 	return &Repository{db: db}
 }
 
-// CreateComment creates a new comment.
+// CreateComment creates a new comment in the tenant of ctx.
+//
+// Replies inherit the thread key of their parent; comment.ThreadKey is only
+// used for root comments. The parent must belong to the same tenant and be
+// visible to the author. Unless comment.Status is set, the status follows the
+// moderation mode of the thread, or of the tenant if the thread has none;
+// comment.ModerationReason is stored as is. Likewise the content is indexed
+// for search in comment.Language, or in the language of the thread or the
+// tenant. The change is recorded in the outbox in the same transaction.
 func (r *Repository) CreateComment(ctx context.Context, comment *model.Comment) (model.Comment, error) {
+	t, ok := tenant.FromContext(ctx)
+	if !ok {
+		return model.Comment{}, tenant.ErrNoTenant
+	}
+	tenantID := t.ID
+	_, all := viewer(ctx)
+
 	query := `
-		INSERT INTO comments (parent_id, content)
-		VALUES ($1, $2)
-		RETURNING id, parent_id, content, created_at, updated_at
+		WITH target AS (
+			SELECT COALESCE((SELECT thread_key FROM comments WHERE id = $1 AND tenant_id = $6), $5) AS thread_key
+		)
+		INSERT INTO comments (
+			tenant_id, parent_id, content, content_html, author_id, author_name, author_username, thread_key, status,
+			moderation_reason, language
+		)
+		SELECT
+			$6, $1, $2, $11, $3, $4, NULLIF($12, ''), t.thread_key,
+			CASE
+				WHEN $7::text <> '' THEN $7::text
+				WHEN COALESCE(s.moderation_mode, $8::text) = '` + model.ModerationPre + `' THEN '` + model.StatusPending + `'
+				ELSE '` + model.StatusApproved + `'
+			END,
+			$10,
+			COALESCE(NULLIF($13, ''), s.language, $14)
+		FROM target t
+		LEFT JOIN thread_settings s ON s.tenant_id = $6 AND s.thread_key = t.thread_key
+		WHERE $1::uuid IS NULL
+		   OR EXISTS (SELECT 1 FROM comments WHERE id = $1 AND tenant_id = $6 AND ` + visibleTo("", 3, 9) + `)
+		RETURNING ` + commentColumns + `
 	`
 
 	zlog.Logger.Printf("repo: parent id: %v", comment.ParentID)
 
-	var c model.Comment
+	var (
+		authorID, authorName *string
+		authorUsername       string
+	)
+	if comment.Author != nil {
+		authorID, authorName, authorUsername = &comment.Author.ID, &comment.Author.Name, comment.Author.Username
+	}
+
+	tx, err := r.db.Master.BeginTx(ctx, nil)
+	if err != nil {
+		return model.Comment{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
 
-	err := r.db.QueryRowContext(
+	c, err := scanComment(tx.QueryRowContext(
 		ctx, query,
-		comment.ParentID, comment.Content,
-	).Scan(&c.ID, &c.ParentID, &c.Content, &c.CreatedAt, &c.UpdatedAt)
+		comment.ParentID, comment.Content, authorID, authorName, comment.ThreadKey, tenantID,
+		comment.Status, t.ModerationMode, all, comment.ModerationReason, comment.ContentHTML, authorUsername,
+		comment.Language, t.Language,
+	))
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.Comment{}, ErrParentNotFound
+		}
 		return model.Comment{}, fmt.Errorf("failed to create comment: %w", err)
 	}
 
+	if err := insertEvent(ctx, tx, tenantID, model.EventCommentCreated, c); err != nil {
+		return model.Comment{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.Comment{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
 	return c, nil
 }
 
-// GetCommentsByParentID returns the comment with the given ID and all nested descendants.
-func (r *Repository) GetCommentsByParentID(ctx context.Context, parentID uuid.UUID) ([]model.Comment, error) {
+// GetComment returns the comment with the given ID.
+func (r *Repository) GetComment(ctx context.Context, id uuid.UUID) (model.Comment, error) {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return model.Comment{}, err
+	}
+
+	query := `SELECT ` + commentColumns + ` FROM comments WHERE id = $1 AND tenant_id = $2`
+
+	c, err := scanComment(r.db.QueryRowContext(ctx, query, id, tenantID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.Comment{}, ErrCommentNotFound
+		}
+		return model.Comment{}, fmt.Errorf("failed to get comment: %w", err)
+	}
+
+	return c, nil
+}
+
+// HasRecentDuplicate reports whether the author has a live comment in the
+// tenant of ctx created since the given time with the same content, ignoring
+// case and runs of whitespace.
+func (r *Repository) HasRecentDuplicate(ctx context.Context, authorID, content string, since time.Time) (bool, error) {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM comments
+			WHERE tenant_id = $1 AND author_id = $2 AND created_at >= $3 AND deleted_at IS NULL
+			  AND lower(regexp_replace(btrim(content), '\s+', ' ', 'g')) = lower(regexp_replace(btrim($4), '\s+', ' ', 'g'))
+		)
+	`
+
+	var exists bool
+	if err := r.db.QueryRowContext(ctx, query, tenantID, authorID, since, content).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check for duplicate comments: %w", err)
+	}
+
+	return exists, nil
+}
+
+// GetCommentsByParentID returns the comment with the given ID and all nested
+// descendants, ordered by the given sort mode.
+//
+// Deleted comments are returned as placeholders so that their replies stay
+// reachable. Comments the viewer in ctx may not see are left out together
+// with their replies.
+func (r *Repository) GetCommentsByParentID(ctx context.Context, parentID uuid.UUID, sort string) ([]model.Comment, error) {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	viewerID, all := viewer(ctx)
+
+	// Replies always share the tenant of their parent, so scoping the root is enough.
 	query := `
 		WITH RECURSIVE comment_tree AS (
-			SELECT id, parent_id, content, created_at, updated_at
+			SELECT *
 			FROM comments
-			WHERE id = $1
+			WHERE id = $1 AND tenant_id = $2 AND ` + visibleTo("", 3, 4) + `
 			UNION ALL
-			SELECT c.id, c.parent_id, c.content, c.created_at, c.updated_at
+			SELECT c.*
 			FROM comments c
 			JOIN comment_tree ct ON c.parent_id = ct.id
+			WHERE ` + visibleTo("c", 3, 4) + `
 		)
-		SELECT 
-			id,
-			parent_id,
-			content,
-			created_at,
-			updated_at
+		SELECT ` + commentColumns + `
 		FROM comment_tree
-		ORDER BY created_at
+		ORDER BY ` + treeSort(sort).orderBy() + `
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, parentID)
+	rows, err := r.db.QueryContext(ctx, query, parentID, tenantID, viewerID, all)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get comments by parent ID: %w", err)
 	}
@@ -77,8 +260,7 @@ func (r *Repository) GetCommentsByParentID(ctx context.Context, parentID uuid.UU
 
 	var comments []model.Comment
 	for rows.Next() {
-		var comment model.Comment
-		err := rows.Scan(&comment.ID, &comment.ParentID, &comment.Content, &comment.CreatedAt, &comment.UpdatedAt)
+		comment, err := scanComment(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan comment: %w", err)
 		}
@@ -92,67 +274,635 @@ func (r *Repository) GetCommentsByParentID(ctx context.Context, parentID uuid.UU
 	return comments, nil
 }
 
-// GetComments retrieves comments by parent ID with optional search, sorting, and pagination.
-func (r *Repository) GetComments(ctx context.Context, parentID *uuid.UUID, search string, sort string, limit, offset int) ([]model.Comment, error) {
-	query := `SELECT id, parent_id, content, created_at, updated_at FROM comments WHERE 1=1`
-	args := []interface{}{}
-	argIdx := 1
+// GetSubtree returns the comment with the given ID and its descendants,
+// limited by the given options, ordered by depth and the sort mode of opts.
+//
+// The root's replies are loaded starting at offset. Every node carries its
+// depth relative to the root and the total number of its direct replies, so
+// callers can tell which branches were truncated. Comments the viewer in ctx
+// may not see are neither loaded nor counted.
+func (r *Repository) GetSubtree(ctx context.Context, id uuid.UUID, opts model.TreeOptions, offset int) ([]*model.CommentNode, error) {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	viewerID, all := viewer(ctx)
+
+	order := treeSort(opts.Sort).orderBy()
+	query := `
+		WITH RECURSIVE comment_tree AS (
+			SELECT comments.*, 0 AS depth
+			FROM comments
+			WHERE id = $1 AND tenant_id = $5 AND ` + visibleTo("", 6, 7) + `
+			UNION ALL
+			SELECT c.*, ct.depth + 1
+			FROM comment_tree ct
+			CROSS JOIN LATERAL (
+				SELECT *
+				FROM comments
+				WHERE parent_id = ct.id AND ` + visibleTo("", 6, 7) + `
+				ORDER BY ` + order + `
+				OFFSET CASE WHEN ct.depth = 0 THEN $4 ELSE 0 END
+				LIMIT $3
+			) c
+			WHERE $2::int IS NULL OR ct.depth < $2
+		)
+		SELECT ` + commentColumns + `,
+			depth,
+			(SELECT COUNT(*) FROM comments r WHERE r.parent_id = comment_tree.id AND ` + visibleTo("r", 6, 7) + `)
+		FROM comment_tree
+		ORDER BY depth, ` + order + `
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, id, nullIfZero(opts.MaxDepth), nullIfZero(opts.MaxChildrenPerNode), offset, tenantID, viewerID, all)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subtree: %w", err)
+	}
+	defer rows.Close()
+
+	var nodes []*model.CommentNode
+	for rows.Next() {
+		var n model.CommentNode
+		c, err := scanComment(rows, &n.Depth, &n.ReplyCount)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan comment: %w", err)
+		}
+		n.Comment = c
+		nodes = append(nodes, &n)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get subtree: %w", err)
+	}
+
+	return nodes, nil
+}
+
+// GetAncestorIDs returns the ID of the comment and the IDs of all its ancestors,
+// ordered from the comment up to the root.
+func (r *Repository) GetAncestorIDs(ctx context.Context, id uuid.UUID) ([]uuid.UUID, error) {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return ancestorIDs(ctx, r.db, id, tenantID)
+}
+
+// querier is implemented by *dbpg.DB and *sql.Tx.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// ancestorIDs returns the ID of the comment and the IDs of all its ancestors
+// in the tenant, ordered from the comment up to the root.
+func ancestorIDs(ctx context.Context, q querier, id uuid.UUID, tenantID string) ([]uuid.UUID, error) {
+	query := `
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id, 0 AS depth
+			FROM comments
+			WHERE id = $1 AND tenant_id = $2
+			UNION ALL
+			SELECT c.id, c.parent_id, a.depth + 1
+			FROM comments c
+			JOIN ancestors a ON c.id = a.parent_id
+		)
+		SELECT id FROM ancestors ORDER BY depth
+	`
+
+	rows, err := q.QueryContext(ctx, query, id, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ancestors: %w", err)
+	}
+	defer rows.Close()
 
-	if parentID != nil {
+	var ids []uuid.UUID
+	for rows.Next() {
+		var ancestorID uuid.UUID
+		if err := rows.Scan(&ancestorID); err != nil {
+			return nil, fmt.Errorf("failed to scan ancestor id: %w", err)
+		}
+		ids = append(ids, ancestorID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get ancestors: %w", err)
+	}
+
+	if len(ids) == 0 {
+		return nil, ErrCommentNotFound
+	}
+
+	return ids, nil
+}
+
+// sortSpec describes how a sort mode orders comments.
+type sortSpec struct {
+	column string // sort key column
+	cast   string // Postgres type the key is cast back to from its text form
+	desc   bool
+}
+
+// orderBy returns the ORDER BY list of the spec.
+func (s sortSpec) orderBy() string {
+	if s.desc {
+		return s.column + " DESC, id DESC"
+	}
+	return s.column + ", id"
+}
+
+// allowedSorts maps sort modes to their specs. Every mode is tie-broken by ID
+// in the same direction, which makes (key, id) a unique keyset position.
+//
+// The vote-based columns are derived from the vote counters in the table:
+// best is the Wilson lower bound of the upvote ratio, controversial favors
+// many evenly split votes and hot decays the score with age.
+var allowedSorts = map[string]sortSpec{
+	"created_asc":   {column: "created_at", cast: "timestamp"},
+	"created_desc":  {column: "created_at", cast: "timestamp", desc: true},
+	"updated_asc":   {column: "updated_at", cast: "timestamp"},
+	"updated_desc":  {column: "updated_at", cast: "timestamp", desc: true},
+	"top":           {column: "score", cast: "int", desc: true},
+	"best":          {column: "best", cast: "float8", desc: true},
+	"controversial": {column: "controversial", cast: "float8", desc: true},
+	"hot":           {column: "hot", cast: "float8", desc: true},
+}
+
+// relevanceSort orders search results best match first. It only applies to
+// searches.
+const relevanceSort = "relevance"
+
+// relevanceSpecs maps search modes to the spec of relevanceSort. Full-text
+// matches are ranked by ts_rank_cd against the search_query of the search,
+// normalized by document length; the others by the trigram similarity of
+// the search_text to the closest words of the content. Ranks are real, so
+// cursors are cast back to float4 to compare equal to the rank they hold.
+var relevanceSpecs = map[string]sortSpec{
+	model.SearchFTS:    {column: "ts_rank_cd(search_vector, search_query, 1)", cast: "float4", desc: true},
+	model.SearchFuzzy:  {column: "word_similarity(search_text, content)", cast: "float4", desc: true},
+	model.SearchPrefix: {column: "word_similarity(search_text, content)", cast: "float4", desc: true},
+}
+
+// autocompleteSample is the number of recent comments autocompletion takes
+// words from.
+const autocompleteSample = 500
+
+// maxPrefixTerms is the number of words of a prefix search that are matched.
+const maxPrefixTerms = 8
+
+// headlineOptions are the ts_headline options of search highlights.
+const headlineOptions = `StartSel=<mark>, StopSel=</mark>, MinWords=10, MaxWords=30, MaxFragments=3, FragmentDelimiter=" … "`
+
+// escapedContent is the content escaped for HTML, so that the highlights
+// built from it only contain the markup ts_headline adds.
+const escapedContent = `replace(replace(replace(content, '&', '&amp;'), '<', '&lt;'), '>', '&gt;')`
+
+const (
+	// defaultSort is used for unknown sort modes of comment lists.
+	defaultSort = "created_desc"
+	// defaultTreeSort is used for unknown sort modes of siblings in trees.
+	defaultTreeSort = "created_asc"
+)
+
+// treeSort returns the spec of a sort mode of siblings in trees.
+func treeSort(name string) sortSpec {
+	if spec, ok := allowedSorts[name]; ok {
+		return spec
+	}
+	return allowedSorts[defaultTreeSort]
+}
+
+// GetComments retrieves a page of comments by parent ID with optional search and sorting.
+//
+// Pages are addressed by keyset cursors, or by offset when no cursor is given.
+// Deleted comments are returned as placeholders and never match a search.
+// Comments the viewer in ctx may not see are left out.
+//
+// Searches match as of q.SearchMode:
+//   - model.SearchFTS takes web search syntax ("quoted phrases", or,
+//     -excluded), parsed in q.Language, or in the language of the thread or
+//     the tenant;
+//   - model.SearchFuzzy matches comments with words similar to the search,
+//     tolerating typos;
+//   - model.SearchPrefix matches comments with words starting with every
+//     word of the search.
+//
+// Full-text and prefix results carry highlighted snippets and every result
+// carries its Context: its ancestors and, if q.Children is set, that many of
+// its first replies. Results are ordered by relevance unless another sort
+// mode is given.
+func (r *Repository) GetComments(ctx context.Context, q model.CommentQuery) (model.CommentPage, error) {
+	t, ok := tenant.FromContext(ctx)
+	if !ok {
+		return model.CommentPage{}, tenant.ErrNoTenant
+	}
+	tenantID := t.ID
+	search := q.Search != ""
+	mode := q.SearchMode
+	if mode == "" {
+		mode = model.SearchFTS
+	}
+	relevanceSpec, ok := relevanceSpecs[mode]
+	if search && !ok {
+		return model.CommentPage{}, fmt.Errorf("unknown search mode %q", mode)
+	}
+
+	sortName := q.Sort
+	spec, ok := allowedSorts[sortName]
+	switch {
+	case search && (sortName == relevanceSort || !ok):
+		sortName = relevanceSort
+		spec = relevanceSpec
+	case !ok:
+		sortName = defaultSort
+		spec = allowedSorts[defaultSort]
+	}
+
+	var (
+		cursor    pageCursor
+		hasCursor = q.Cursor != ""
+	)
+	if hasCursor {
+		var err error
+		if cursor, err = decodePageCursor(q.Cursor, sortName); err != nil {
+			return model.CommentPage{}, err
+		}
+	}
+
+	viewerID, all := viewer(ctx)
+
+	query := `SELECT ` + commentColumns + `, ` + spec.column + `::text`
+	from := ` FROM comments`
+	where := ` WHERE tenant_id = $1 AND ` + visibleTo("", 2, 3)
+	args := []interface{}{tenantID, viewerID, all}
+	argIdx := 4
+
+	highlight := false
+	switch {
+	case search && mode == model.SearchFTS:
+		highlight = true
+		query += `, ts_headline(language::regconfig, ` + escapedContent + `, search_query, '` + headlineOptions + `')`
+		from += fmt.Sprintf(
+			", websearch_to_tsquery(COALESCE(NULLIF($%d, ''), "+
+				"(SELECT language FROM thread_settings WHERE tenant_id = $1 AND thread_key = $%d), $%d)::regconfig, $%d) AS search_query",
+			argIdx, argIdx+1, argIdx+2, argIdx+3,
+		)
+		where += " AND deleted_at IS NULL AND search_vector @@ search_query"
+		args = append(args, q.Language, q.ThreadKey, t.Language, q.Search)
+		argIdx += 4
+	case search:
+		// Both trigram modes rank by similarity to the whole search text.
+		from += fmt.Sprintf(", (SELECT $%d::text) AS search_input(search_text)", argIdx)
+		where += " AND deleted_at IS NULL"
+		args = append(args, q.Search)
+		argIdx++
+
+		if mode == model.SearchFuzzy {
+			where += " AND search_text <% content"
+			break
+		}
+
+		terms := strings.Fields(q.Search)
+		if len(terms) > maxPrefixTerms {
+			terms = terms[:maxPrefixTerms]
+		}
+		for _, term := range terms {
+			where += fmt.Sprintf(" AND content ~* $%d", argIdx)
+			args = append(args, `\m`+regexp.QuoteMeta(term))
+			argIdx++
+		}
+		if tsq := prefixTSQuery(terms); tsq != "" {
+			highlight = true
+			query += fmt.Sprintf(`, ts_headline('simple', %s, to_tsquery('simple', $%d), '%s')`, escapedContent, argIdx, headlineOptions)
+			args = append(args, tsq)
+			argIdx++
+		}
+	}
+	query += from + where
+
+	if q.ParentID != nil {
 		query += fmt.Sprintf(" AND parent_id = $%d", argIdx)
-		args = append(args, *parentID)
+		args = append(args, *q.ParentID)
 		argIdx++
 	}
 
-	if search != "" {
-		query += fmt.Sprintf(" AND to_tsvector('english', content) @@ plainto_tsquery('english', $%d)", argIdx)
-		args = append(args, search)
+	if q.ThreadKey != nil {
+		query += fmt.Sprintf(" AND thread_key = $%d", argIdx)
+		args = append(args, *q.ThreadKey)
 		argIdx++
 	}
 
-	allowedSorts := map[string]string{
-		"created_asc":  "created_at ASC",
-		"created_desc": "created_at DESC",
-		"updated_asc":  "updated_at ASC",
-		"updated_desc": "updated_at DESC",
+	// Walking backwards reverses the order; the rows are flipped back below.
+	desc := spec.desc != (hasCursor && cursor.Before)
+
+	if hasCursor {
+		op := ">"
+		if desc {
+			op = "<"
+		}
+		query += fmt.Sprintf(" AND (%s, id) %s ($%d::%s, $%d)", spec.column, op, argIdx, spec.cast, argIdx+1)
+		args = append(args, cursor.Key, cursor.ID)
+		argIdx += 2
 	}
 
-	if sortSQL, ok := allowedSorts[sort]; ok {
-		query += " ORDER BY " + sortSQL
-	} else {
-		query += " ORDER BY created_at DESC" // По умолчанию
+	dir := "ASC"
+	if desc {
+		dir = "DESC"
 	}
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s", spec.column, dir, dir)
+
+	// Fetch one extra row to learn whether there is more in the direction of travel.
+	query += fmt.Sprintf(" LIMIT $%d", argIdx)
+	args = append(args, q.Limit+1)
+	argIdx++
 
-	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", argIdx, argIdx+1)
-	args = append(args, limit, offset)
+	if !hasCursor {
+		query += fmt.Sprintf(" OFFSET $%d", argIdx)
+		args = append(args, q.Offset)
+	}
 
 	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get comments: %w", err)
+		return model.CommentPage{}, fmt.Errorf("failed to get comments: %w", err)
 	}
 	defer rows.Close()
 
-	var comments []model.Comment
+	// The limit comes from the client, so slices grow with the rows found.
+	comments := []model.Comment{}
+	var keys []string
 	for rows.Next() {
-		var c model.Comment
-		if err := rows.Scan(&c.ID, &c.ParentID, &c.Content, &c.CreatedAt, &c.UpdatedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan comment: %w", err)
+		var key string
+		extra := []any{&key}
+		var snippet string
+		if highlight {
+			extra = append(extra, &snippet)
+		}
+
+		c, err := scanComment(rows, extra...)
+		if err != nil {
+			return model.CommentPage{}, fmt.Errorf("failed to scan comment: %w", err)
 		}
+		c.Highlight = snippet
 		comments = append(comments, c)
+		keys = append(keys, key)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("failed to get comments: %w", err)
+		return model.CommentPage{}, fmt.Errorf("failed to get comments: %w", err)
 	}
 
-	return comments, nil
+	hasMore := len(comments) > q.Limit
+	if hasMore {
+		comments, keys = comments[:q.Limit], keys[:q.Limit]
+	}
+
+	backward := hasCursor && cursor.Before
+	if backward {
+		slices.Reverse(comments)
+		slices.Reverse(keys)
+	}
+
+	page := model.CommentPage{Items: comments}
+	if len(comments) == 0 {
+		return page, nil
+	}
+
+	if search {
+		if err := r.loadContext(ctx, tenantID, comments, q.Children); err != nil {
+			return model.CommentPage{}, err
+		}
+	}
+
+	first, last := 0, len(comments)-1
+	after := pageCursor{Sort: sortName, Key: keys[last], ID: comments[last].ID}
+	before := pageCursor{Sort: sortName, Key: keys[first], ID: comments[first].ID, Before: true}
+
+	// The side we came from always has more rows; the other side has more
+	// only if the extra row was found.
+	if backward {
+		page.NextCursor = after.encode()
+		if hasMore {
+			page.PrevCursor = before.encode()
+		}
+	} else {
+		if hasMore {
+			page.NextCursor = after.encode()
+		}
+		if hasCursor || q.Offset > 0 {
+			page.PrevCursor = before.encode()
+		}
+	}
+
+	return page, nil
+}
+
+// loadContext sets the Context of comments to their ancestors and up to
+// children of their replies, with a single query for all of them.
+//
+// Ancestors the viewer in ctx may not see are masked like deleted ones, so
+// that the chain up to the root stays whole; replies they may not see are
+// left out.
+func (r *Repository) loadContext(ctx context.Context, tenantID string, comments []model.Comment, children int) error {
+	viewerID, all := viewer(ctx)
+
+	ids := make([]uuid.UUID, len(comments))
+	for i, c := range comments {
+		ids[i] = c.ID
+	}
+
+	// Ancestors have a positive depth, replies depth 0. Rows come ordered
+	// from the root down, then replies oldest first.
+	query := `
+		WITH RECURSIVE ancestors AS (
+			SELECT h.hit_id, c.*, 1 AS depth
+			FROM unnest($2::uuid[]) AS h(hit_id)
+			JOIN comments hit ON hit.id = h.hit_id AND hit.tenant_id = $1
+			JOIN comments c ON c.id = hit.parent_id
+			UNION ALL
+			SELECT a.hit_id, c.*, a.depth + 1
+			FROM ancestors a
+			JOIN comments c ON c.id = a.parent_id
+		)
+		SELECT ` + commentColumns + `, hit_id, depth, ` + visibleTo("", 3, 4) + `
+		FROM ancestors
+		UNION ALL
+		SELECT ` + commentColumns + `, h.hit_id, 0, TRUE
+		FROM unnest($2::uuid[]) AS h(hit_id)
+		CROSS JOIN LATERAL (
+			SELECT *
+			FROM comments
+			WHERE parent_id = h.hit_id AND tenant_id = $1 AND ` + visibleTo("", 3, 4) + `
+			ORDER BY created_at, id
+			LIMIT $5
+		) c
+		ORDER BY depth DESC, created_at, id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, tenantID, pq.Array(ids), viewerID, all, children)
+	if err != nil {
+		return fmt.Errorf("failed to get comment context: %w", err)
+	}
+	defer rows.Close()
+
+	contexts := make(map[uuid.UUID]*model.Context, len(comments))
+	for i := range comments {
+		comments[i].Context = &model.Context{Ancestors: []model.Comment{}}
+		contexts[comments[i].ID] = comments[i].Context
+	}
+
+	for rows.Next() {
+		var (
+			hitID   uuid.UUID
+			depth   int
+			visible bool
+		)
+		c, err := scanComment(rows, &hitID, &depth, &visible)
+		if err != nil {
+			return fmt.Errorf("failed to scan comment: %w", err)
+		}
+		if !visible {
+			c = masked(c)
+		}
+
+		cc := contexts[hitID]
+		if depth > 0 {
+			cc.Ancestors = append(cc.Ancestors, c)
+		} else {
+			cc.Children = append(cc.Children, c)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to get comment context: %w", err)
+	}
+
+	return nil
+}
+
+// prefixTSQuery returns the text search query matching words that start
+// with the words of terms, for highlighting prefix search results. Only
+// letters and digits are kept, so the query needs no quoting.
+func prefixTSQuery(terms []string) string {
+	var prefixes []string
+	for _, term := range terms {
+		words := strings.FieldsFunc(term, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, w := range words {
+			prefixes = append(prefixes, w+":*")
+		}
+	}
+
+	return strings.Join(prefixes, " | ")
+}
+
+// Autocomplete returns up to q.Limit words of recent comments visible to the
+// viewer in ctx that start with q.Prefix, lowercased, most frequent first.
+func (r *Repository) Autocomplete(ctx context.Context, q model.AutocompleteQuery) ([]string, error) {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	viewerID, all := viewer(ctx)
+
+	// Words are only taken from the most recent matching comments, so that
+	// every keystroke stays cheap on large tenants.
+	query := `
+		WITH recent AS (
+			SELECT content
+			FROM comments
+			WHERE tenant_id = $1 AND ` + visibleTo("", 2, 3) + `
+			  AND deleted_at IS NULL AND content ~* $4
+			  AND ($5::text IS NULL OR thread_key = $5)
+			ORDER BY created_at DESC
+			LIMIT ` + strconv.Itoa(autocompleteSample) + `
+		)
+		SELECT lower(m[1]) AS word
+		FROM recent, regexp_matches(recent.content, $6, 'gi') AS m
+		GROUP BY word
+		ORDER BY COUNT(*) DESC, word
+		LIMIT $7
+	`
+
+	re := regexp.QuoteMeta(q.Prefix)
+	rows, err := r.db.QueryContext(ctx, query, tenantID, viewerID, all, `\m`+re, q.ThreadKey, `\m(`+re+`\w*)`, q.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to autocomplete: %w", err)
+	}
+	defer rows.Close()
+
+	words := make([]string, 0, q.Limit)
+	for rows.Next() {
+		var w string
+		if err := rows.Scan(&w); err != nil {
+			return nil, fmt.Errorf("failed to scan word: %w", err)
+		}
+		words = append(words, w)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return words, nil
+}
+
+// DeleteComment marks a comment as deleted without removing it or its replies,
+// resolves the open reports against it and records the change in the outbox
+// in the same transaction.
+func (r *Repository) DeleteComment(ctx context.Context, id uuid.UUID, deletedBy string) error {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE comments
+		SET deleted_at = CURRENT_TIMESTAMP, deleted_by = $2
+		WHERE id = $1 AND tenant_id = $3 AND deleted_at IS NULL
+		RETURNING ` + commentColumns + `
+	`
+
+	tx, err := r.db.Master.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	c, err := scanComment(tx.QueryRowContext(ctx, query, id, deletedBy, tenantID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrCommentNotFound
+		}
+		return fmt.Errorf("failed to delete comment: %w", err)
+	}
+
+	if err := insertEvent(ctx, tx, tenantID, model.EventCommentDeleted, c); err != nil {
+		return err
+	}
+
+	if err := resolveReports(ctx, tx, []uuid.UUID{id}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
 }
 
-// DeleteComment deletes a comment by ID and all nested descendants.
-func (r *Repository) DeleteComment(ctx context.Context, id uuid.UUID) error {
+// PurgeComment permanently deletes a comment by ID and all nested descendants.
+func (r *Repository) PurgeComment(ctx context.Context, id uuid.UUID) error {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
 	query := `
 		WITH RECURSIVE to_delete AS (
-    		SELECT id FROM comments WHERE id = $1
+    		SELECT id FROM comments WHERE id = $1 AND tenant_id = $2
     		UNION ALL
     		SELECT c.id
     		FROM comments c
@@ -162,9 +912,9 @@ func (r *Repository) DeleteComment(ctx context.Context, id uuid.UUID) error {
 		WHERE id IN (SELECT id FROM to_delete);
 	`
 
-	rows, err := r.db.ExecContext(ctx, query, id)
+	rows, err := r.db.ExecContext(ctx, query, id, tenantID)
 	if err != nil {
-		return fmt.Errorf("failed to delete comment: %w", err)
+		return fmt.Errorf("failed to purge comment: %w", err)
 	}
 
 	n, err := rows.RowsAffected()
@@ -178,3 +928,194 @@ func (r *Repository) DeleteComment(ctx context.Context, id uuid.UUID) error {
 
 	return nil
 }
+
+// PurgeDeleted permanently deletes comments that were soft-deleted more than
+// retention ago and have no remaining replies.
+//
+// Tombstones are removed bottom-up, so a chain of deleted comments is purged
+// entirely while a tombstone with live replies is kept. It returns the number
+// of purged comments.
+func (r *Repository) PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error) {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+		DELETE FROM comments c
+		WHERE c.tenant_id = $2
+		  AND c.deleted_at IS NOT NULL
+		  AND c.deleted_at <= CURRENT_TIMESTAMP - make_interval(secs => $1)
+		  AND NOT EXISTS (SELECT 1 FROM comments ch WHERE ch.parent_id = c.id)
+	`
+
+	var total int64
+	for {
+		res, err := r.db.ExecContext(ctx, query, retention.Seconds(), tenantID)
+		if err != nil {
+			return total, fmt.Errorf("failed to purge deleted comments: %w", err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, fmt.Errorf("failed to get rows affected: %w", err)
+		}
+
+		if n == 0 {
+			return total, nil
+		}
+		total += n
+	}
+}
+
+// UpdateComment replaces the content and rendered content of a comment and
+// records the previous content as a new revision and the change in the
+// outbox in the same transaction.
+//
+// A non-empty flagReason holds the comment for review: its status becomes
+// pending with flagReason as the moderation reason, and an approved comment
+// is recorded in the outbox as deleted instead.
+func (r *Repository) UpdateComment(ctx context.Context, id uuid.UUID, content, contentHTML, flagReason string) (model.Comment, error) {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return model.Comment{}, err
+	}
+
+	tx, err := r.db.Master.BeginTx(ctx, nil)
+	if err != nil {
+		return model.Comment{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var (
+		oldContent, oldStatus string
+		oldUpdated            time.Time
+	)
+
+	// Lock the comment so concurrent edits get consecutive revision numbers.
+	err = tx.QueryRowContext(
+		ctx, `SELECT content, status, updated_at FROM comments WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL FOR UPDATE`,
+		id, tenantID,
+	).Scan(&oldContent, &oldStatus, &oldUpdated)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.Comment{}, ErrCommentNotFound
+		}
+		return model.Comment{}, fmt.Errorf("failed to get comment: %w", err)
+	}
+
+	if oldContent != content {
+		query := `
+			INSERT INTO comment_revisions (comment_id, version, content, created_at)
+			SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3
+			FROM comment_revisions
+			WHERE comment_id = $1
+		`
+
+		if _, err := tx.ExecContext(ctx, query, id, oldContent, oldUpdated); err != nil {
+			return model.Comment{}, fmt.Errorf("failed to create revision: %w", err)
+		}
+	}
+
+	query := `
+		UPDATE comments
+		SET content = $2, content_html = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING ` + commentColumns + `
+	`
+	args := []any{id, content, contentHTML}
+
+	if flagReason != "" {
+		query = `
+			UPDATE comments
+			SET content = $2, content_html = $3, updated_at = CURRENT_TIMESTAMP,
+			    status = $4, moderation_reason = $5, moderated_by = NULL, moderated_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+			RETURNING ` + commentColumns + `
+		`
+		args = append(args, model.StatusPending, flagReason)
+	}
+
+	c, err := scanComment(tx.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		return model.Comment{}, fmt.Errorf("failed to update comment: %w", err)
+	}
+
+	if oldStatus == model.StatusApproved && c.Status != model.StatusApproved {
+		err = insertEvent(ctx, tx, tenantID, model.EventCommentDeleted, masked(c))
+	} else {
+		err = insertEvent(ctx, tx, tenantID, model.EventCommentUpdated, c)
+	}
+	if err != nil {
+		return model.Comment{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.Comment{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return c, nil
+}
+
+// GetRevisions returns all versions of a comment ordered from oldest to newest.
+//
+// The last element is the current content of the comment. The history of a
+// deleted comment or one the viewer in ctx may not see is not returned.
+func (r *Repository) GetRevisions(ctx context.Context, id uuid.UUID) ([]model.Revision, error) {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	viewerID, all := viewer(ctx)
+
+	query := `
+		WITH target AS (
+			SELECT id, content, updated_at FROM comments
+			WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL AND ` + visibleTo("", 3, 4) + `
+		)
+		SELECT rev.version, rev.content, rev.created_at
+		FROM comment_revisions rev
+		JOIN target t ON t.id = rev.comment_id
+		UNION ALL
+		SELECT
+			(SELECT COUNT(*) + 1 FROM comment_revisions WHERE comment_id = $1),
+			content,
+			updated_at
+		FROM target
+		ORDER BY version
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, id, tenantID, viewerID, all)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get revisions: %w", err)
+	}
+	defer rows.Close()
+
+	var revisions []model.Revision
+	for rows.Next() {
+		rev := model.Revision{CommentID: id}
+		if err := rows.Scan(&rev.Version, &rev.Content, &rev.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan revision: %w", err)
+		}
+		revisions = append(revisions, rev)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get revisions: %w", err)
+	}
+
+	if len(revisions) == 0 {
+		return nil, ErrCommentNotFound
+	}
+
+	return revisions, nil
+}
+
+// nullIfZero maps a zero limit to NULL, which Postgres treats as no limit.
+func nullIfZero(n int) any {
+	if n == 0 {
+		return nil
+	}
+	return n
+}
@@ -0,0 +1,177 @@
+package comment
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/aliskhannn/comment-tree/internal/model"
+	"github.com/aliskhannn/comment-tree/internal/tenant"
+)
+
+// ErrAlreadyReported is returned when the reporter has an open report against the comment.
+var ErrAlreadyReported = errors.New("comment already reported")
+
+// ReportComment records a report against a live comment in the tenant of ctx
+// that the user in ctx may see.
+//
+// Once the comment has threshold open reports, an approved comment is hidden
+// pending review, like a deletion: its status becomes pending and the change
+// is recorded in the outbox as a deletion in the same transaction. It reports
+// whether the comment was hidden.
+func (r *Repository) ReportComment(ctx context.Context, id uuid.UUID, reporterID, reason, details string, threshold int) (bool, error) {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := r.db.Master.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	viewerID, all := viewer(ctx)
+
+	// Lock the comment so concurrent reports see each other when counting.
+	// Comments the reporter may not see are reported as not found.
+	var status string
+	err = tx.QueryRowContext(
+		ctx, `SELECT status FROM comments
+		WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL AND `+visibleTo("", 3, 4)+`
+		FOR UPDATE`,
+		id, tenantID, viewerID, all,
+	).Scan(&status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, ErrCommentNotFound
+		}
+		return false, fmt.Errorf("failed to get comment: %w", err)
+	}
+
+	query := `
+		INSERT INTO comment_reports (tenant_id, comment_id, reporter_id, reason, details)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (comment_id, reporter_id) WHERE status = 'open' DO NOTHING
+	`
+
+	res, err := tx.ExecContext(ctx, query, tenantID, id, reporterID, reason, details)
+	if err != nil {
+		return false, fmt.Errorf("failed to create report: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	} else if n == 0 {
+		return false, ErrAlreadyReported
+	}
+
+	var reports int
+	err = tx.QueryRowContext(
+		ctx, `SELECT COUNT(*) FROM comment_reports WHERE comment_id = $1 AND status = 'open'`, id,
+	).Scan(&reports)
+	if err != nil {
+		return false, fmt.Errorf("failed to count reports: %w", err)
+	}
+
+	hidden := status == model.StatusApproved && reports >= threshold
+	if hidden {
+		query := `
+			UPDATE comments
+			SET status = $2, moderation_reason = $3, moderated_by = NULL, moderated_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+			RETURNING ` + commentColumns + `
+		`
+
+		note := fmt.Sprintf("hidden after %d reports", reports)
+		c, err := scanComment(tx.QueryRowContext(ctx, query, id, model.StatusPending, note))
+		if err != nil {
+			return false, fmt.Errorf("failed to hide comment: %w", err)
+		}
+
+		if err := insertEvent(ctx, tx, tenantID, model.EventCommentDeleted, masked(c)); err != nil {
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return hidden, nil
+}
+
+// GetReportedComments returns the live comments of the tenant in ctx with open
+// reports, most reported first.
+func (r *Repository) GetReportedComments(ctx context.Context, limit, offset int) ([]model.ReportedComment, error) {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		WITH by_reason AS (
+			SELECT comment_id, reason, COUNT(*) AS n, MAX(created_at) AS last_at
+			FROM comment_reports
+			WHERE tenant_id = $1 AND status = 'open'
+			GROUP BY comment_id, reason
+		), open_reports AS (
+			SELECT comment_id, SUM(n)::int AS reports, MAX(last_at) AS last_reported_at, jsonb_object_agg(reason, n) AS reasons
+			FROM by_reason
+			GROUP BY comment_id
+		)
+		SELECT ` + commentColumns + `, o.reports, o.last_reported_at, o.reasons::text
+		FROM comments
+		JOIN open_reports o ON o.comment_id = comments.id
+		WHERE comments.tenant_id = $1 AND comments.deleted_at IS NULL
+		ORDER BY o.reports DESC, o.last_reported_at DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, tenantID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reported comments: %w", err)
+	}
+	defer rows.Close()
+
+	reported := []model.ReportedComment{}
+	for rows.Next() {
+		var (
+			rc      model.ReportedComment
+			reasons string
+		)
+		rc.Comment, err = scanComment(rows, &rc.Reports, &rc.LastReportedAt, &reasons)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan reported comment: %w", err)
+		}
+		if err := json.Unmarshal([]byte(reasons), &rc.Reasons); err != nil {
+			return nil, fmt.Errorf("failed to decode report reasons: %w", err)
+		}
+		reported = append(reported, rc)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get reported comments: %w", err)
+	}
+
+	return reported, nil
+}
+
+// resolveReports closes the open reports against the given comments as part of tx.
+func resolveReports(ctx context.Context, tx *sql.Tx, ids []uuid.UUID) error {
+	query := `
+		UPDATE comment_reports
+		SET status = 'resolved', resolved_at = CURRENT_TIMESTAMP
+		WHERE comment_id = ANY($1) AND status = 'open'
+	`
+
+	if _, err := tx.ExecContext(ctx, query, pq.Array(ids)); err != nil {
+		return fmt.Errorf("failed to resolve reports: %w", err)
+	}
+
+	return nil
+}
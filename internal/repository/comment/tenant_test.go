@@ -0,0 +1,158 @@
+package comment
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/wb-go/wbf/dbpg"
+
+	"github.com/aliskhannn/comment-tree/internal/auth"
+	"github.com/aliskhannn/comment-tree/internal/model"
+	"github.com/aliskhannn/comment-tree/internal/tenant"
+)
+
+// testRepository connects to the migrated database named by TEST_DATABASE_DSN
+// and skips the test if it is not set.
+func testRepository(t *testing.T) *Repository {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	db, err := dbpg.New(dsn, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to connect to database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Master.Close() })
+
+	return NewRepository(db)
+}
+
+// tenantContext returns a context scoped to a tenant, authenticated as a
+// user bound to it.
+func tenantContext(id string) context.Context {
+	ctx := tenant.WithTenant(context.Background(), model.Tenant{
+		ID:               id,
+		MaxContentLength: tenant.DefaultMaxContentLength,
+		ModerationMode:   model.ModerationPost,
+		ReportThreshold:  tenant.DefaultReportThreshold,
+		Language:         model.DefaultLanguage,
+	})
+
+	return auth.WithUser(ctx, model.User{ID: "user-" + id, Name: "User", Role: model.RoleModerator, TenantID: id})
+}
+
+func TestTenantIsolation(t *testing.T) {
+	r := testRepository(t)
+
+	suffix := uuid.NewString()
+	tenantA, tenantB := "a-"+suffix, "b-"+suffix
+	ctxA, ctxB := tenantContext(tenantA), tenantContext(tenantB)
+	t.Cleanup(func() {
+		ctx := context.Background()
+		tenants := pq.Array([]string{tenantA, tenantB})
+		_, _ = r.db.Master.ExecContext(ctx, `DELETE FROM outbox_events WHERE tenant_id = ANY($1)`, tenants)
+		_, _ = r.db.Master.ExecContext(ctx, `DELETE FROM comments WHERE tenant_id = ANY($1)`, tenants)
+	})
+
+	thread := "thread-" + suffix
+	root, err := r.CreateComment(ctxA, &model.Comment{Content: "root of tenant A", ThreadKey: thread, ContentHTML: "<p>root</p>"})
+	if err != nil {
+		t.Fatalf("CreateComment: %v", err)
+	}
+	reply, err := r.CreateComment(ctxA, &model.Comment{Content: "reply of tenant A", ParentID: &root.ID, ContentHTML: "<p>reply</p>"})
+	if err != nil {
+		t.Fatalf("CreateComment reply: %v", err)
+	}
+
+	t.Run("list", func(t *testing.T) {
+		page, err := r.GetComments(ctxB, model.CommentQuery{ThreadKey: &thread, Limit: 10})
+		if err != nil {
+			t.Fatalf("GetComments: %v", err)
+		}
+		if len(page.Items) != 0 {
+			t.Errorf("tenant B listed %d comments of tenant A", len(page.Items))
+		}
+
+		page, err = r.GetComments(ctxB, model.CommentQuery{ParentID: &root.ID, Limit: 10})
+		if err != nil {
+			t.Fatalf("GetComments by parent: %v", err)
+		}
+		if len(page.Items) != 0 {
+			t.Errorf("tenant B listed %d replies of tenant A", len(page.Items))
+		}
+
+		page, err = r.GetComments(ctxA, model.CommentQuery{ThreadKey: &thread, Limit: 10})
+		if err != nil {
+			t.Fatalf("GetComments: %v", err)
+		}
+		if len(page.Items) != 2 {
+			t.Errorf("tenant A listed %d comments, want 2", len(page.Items))
+		}
+	})
+
+	t.Run("search", func(t *testing.T) {
+		page, err := r.GetComments(ctxB, model.CommentQuery{ThreadKey: &thread, Search: "tenant", Limit: 10})
+		if err != nil {
+			t.Fatalf("GetComments: %v", err)
+		}
+		if len(page.Items) != 0 {
+			t.Errorf("tenant B found %d comments of tenant A", len(page.Items))
+		}
+	})
+
+	t.Run("subtree", func(t *testing.T) {
+		nodes, err := r.GetSubtree(ctxB, root.ID, model.TreeOptions{}, 0)
+		if err != nil {
+			t.Fatalf("GetSubtree: %v", err)
+		}
+		if len(nodes) != 0 {
+			t.Errorf("tenant B loaded %d comments of tenant A", len(nodes))
+		}
+
+		children, err := r.GetCommentsByParentID(ctxB, root.ID, "")
+		if err != nil {
+			t.Fatalf("GetCommentsByParentID: %v", err)
+		}
+		if len(children) != 0 {
+			t.Errorf("tenant B loaded %d comments of tenant A", len(children))
+		}
+	})
+
+	t.Run("read", func(t *testing.T) {
+		if _, err := r.GetComment(ctxB, root.ID); !errors.Is(err, ErrCommentNotFound) {
+			t.Errorf("GetComment from tenant B: got %v, want ErrCommentNotFound", err)
+		}
+	})
+
+	// The handlers answer ErrCommentNotFound with 404.
+	t.Run("delete", func(t *testing.T) {
+		if err := r.DeleteComment(ctxB, reply.ID, "user-"+tenantB); !errors.Is(err, ErrCommentNotFound) {
+			t.Errorf("DeleteComment from tenant B: got %v, want ErrCommentNotFound", err)
+		}
+		if err := r.PurgeComment(ctxB, root.ID); !errors.Is(err, ErrCommentNotFound) {
+			t.Errorf("PurgeComment from tenant B: got %v, want ErrCommentNotFound", err)
+		}
+
+		c, err := r.GetComment(ctxA, reply.ID)
+		if err != nil {
+			t.Fatalf("GetComment: %v", err)
+		}
+		if c.DeletedAt != nil {
+			t.Error("tenant B deleted a comment of tenant A")
+		}
+	})
+
+	t.Run("reply", func(t *testing.T) {
+		_, err := r.CreateComment(ctxB, &model.Comment{Content: "reply of tenant B", ParentID: &root.ID, ContentHTML: "<p>reply</p>"})
+		if !errors.Is(err, ErrParentNotFound) {
+			t.Errorf("CreateComment under tenant A's comment: got %v, want ErrParentNotFound", err)
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package comment
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/aliskhannn/comment-tree/internal/model"
+	"github.com/aliskhannn/comment-tree/internal/tenant"
+)
+
+// Vote sets the vote of a user on a comment to value and returns the comment
+// with updated counters. A value of model.VoteNone withdraws the vote.
+//
+// The vote counters of the comment are adjusted by the difference to the
+// previous vote of the user, so repeated votes are not counted twice.
+// Voting on a comment the user in ctx may not see fails with
+// ErrCommentNotFound.
+func (r *Repository) Vote(ctx context.Context, id uuid.UUID, userID string, value int) (model.Comment, error) {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return model.Comment{}, err
+	}
+
+	tx, err := r.db.Master.BeginTx(ctx, nil)
+	if err != nil {
+		return model.Comment{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	viewerID, all := viewer(ctx)
+
+	// Lock the comment so concurrent votes of the same user are serialized.
+	// Comments the voter may not see are reported as not found.
+	var exists bool
+	err = tx.QueryRowContext(
+		ctx, `SELECT true FROM comments
+		WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL AND `+visibleTo("", 3, 4)+`
+		FOR UPDATE`,
+		id, tenantID, viewerID, all,
+	).Scan(&exists)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.Comment{}, ErrCommentNotFound
+		}
+		return model.Comment{}, fmt.Errorf("failed to get comment: %w", err)
+	}
+
+	old := model.VoteNone
+	err = tx.QueryRowContext(
+		ctx, `SELECT value FROM comment_votes WHERE comment_id = $1 AND user_id = $2`,
+		id, userID,
+	).Scan(&old)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return model.Comment{}, fmt.Errorf("failed to get vote: %w", err)
+	}
+
+	if value == model.VoteNone {
+		_, err = tx.ExecContext(ctx, `DELETE FROM comment_votes WHERE comment_id = $1 AND user_id = $2`, id, userID)
+	} else {
+		query := `
+			INSERT INTO comment_votes (comment_id, user_id, value)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (comment_id, user_id)
+			DO UPDATE SET value = EXCLUDED.value, updated_at = CURRENT_TIMESTAMP
+		`
+		_, err = tx.ExecContext(ctx, query, id, userID, value)
+	}
+	if err != nil {
+		return model.Comment{}, fmt.Errorf("failed to save vote: %w", err)
+	}
+
+	query := `
+		UPDATE comments
+		SET upvotes = upvotes + $2, downvotes = downvotes + $3
+		WHERE id = $1
+		RETURNING ` + commentColumns + `
+	`
+
+	up := count(value == model.VoteUp) - count(old == model.VoteUp)
+	down := count(value == model.VoteDown) - count(old == model.VoteDown)
+
+	c, err := scanComment(tx.QueryRowContext(ctx, query, id, up, down))
+	if err != nil {
+		return model.Comment{}, fmt.Errorf("failed to update vote counters: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.Comment{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return c, nil
+}
+
+// count returns 1 if b is true and 0 otherwise.
+func count(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,219 @@
+package notification
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aliskhannn/comment-tree/internal/model"
+	"github.com/aliskhannn/comment-tree/internal/tenant"
+)
+
+// pendingCondition selects the unread notifications of the user of the
+// preferences p created after its last email, about comments still shown.
+const pendingCondition = `
+	n.tenant_id = p.tenant_id AND n.user_id = p.user_id AND n.read_at IS NULL AND n.created_at > p.notified_until
+	AND c.deleted_at IS NULL AND c.status = '` + model.StatusApproved + `'`
+
+// GetPreferences returns the email preferences of a user in the tenant of ctx.
+//
+// It reports false if the user has not saved any.
+func (r *Repository) GetPreferences(ctx context.Context, userID string) (model.NotificationPreferences, bool, error) {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return model.NotificationPreferences{}, false, err
+	}
+
+	query := `
+		SELECT delivery, email
+		FROM notification_preferences
+		WHERE tenant_id = $1 AND user_id = $2
+	`
+
+	var p model.NotificationPreferences
+	if err := r.db.QueryRowContext(ctx, query, tenantID, userID).Scan(&p.Delivery, &p.Email); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.NotificationPreferences{}, false, nil
+		}
+		return model.NotificationPreferences{}, false, fmt.Errorf("failed to get notification preferences: %w", err)
+	}
+
+	return p, true, nil
+}
+
+// SavePreferences saves the email delivery mode of a user in the tenant of
+// ctx, along with the address and name emails are sent to.
+//
+// Turning delivery on only emails notifications created from then on.
+func (r *Repository) SavePreferences(ctx context.Context, user model.User, delivery string) (model.NotificationPreferences, error) {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return model.NotificationPreferences{}, err
+	}
+
+	query := `
+		INSERT INTO notification_preferences (tenant_id, user_id, email, name, delivery)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (tenant_id, user_id) DO UPDATE
+		SET email = EXCLUDED.email,
+		    name = EXCLUDED.name,
+		    delivery = EXCLUDED.delivery,
+		    notified_until = CASE
+		        WHEN notification_preferences.delivery = '` + model.DeliveryOff + `' THEN CURRENT_TIMESTAMP
+		        ELSE notification_preferences.notified_until
+		    END,
+		    updated_at = CURRENT_TIMESTAMP
+		RETURNING delivery, email
+	`
+
+	var p model.NotificationPreferences
+	err = r.db.QueryRowContext(ctx, query, tenantID, user.ID, user.Email, user.Name, delivery).Scan(&p.Delivery, &p.Email)
+	if err != nil {
+		return model.NotificationPreferences{}, fmt.Errorf("failed to save notification preferences: %w", err)
+	}
+
+	return p, nil
+}
+
+// Unsubscribe turns off notification emails to a user of a tenant.
+func (r *Repository) Unsubscribe(ctx context.Context, tenantID, userID string) error {
+	query := `
+		UPDATE notification_preferences
+		SET delivery = '` + model.DeliveryOff + `', updated_at = CURRENT_TIMESTAMP
+		WHERE tenant_id = $1 AND user_id = $2
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, tenantID, userID); err != nil {
+		return fmt.Errorf("failed to unsubscribe: %w", err)
+	}
+
+	return nil
+}
+
+// ClaimDigests leases up to limit users, across tenants, whose pending
+// notifications are due to be emailed: right away for instant delivery, and
+// an hour or a day after the last email for digests.
+//
+// Claimed users are not returned again until the lease ends, so several
+// senders can share the work.
+func (r *Repository) ClaimDigests(ctx context.Context, limit int, lease time.Duration) ([]model.DigestRecipient, error) {
+	query := `
+		WITH due AS (
+			SELECT p.tenant_id, p.user_id
+			FROM notification_preferences p
+			WHERE p.delivery <> '` + model.DeliveryOff + `' AND p.next_attempt_at <= CURRENT_TIMESTAMP
+			  AND p.last_sent_at <= CURRENT_TIMESTAMP - CASE p.delivery
+			      WHEN '` + model.DeliveryHourly + `' THEN INTERVAL '1 hour'
+			      WHEN '` + model.DeliveryDaily + `' THEN INTERVAL '1 day'
+			      ELSE INTERVAL '0'
+			  END
+			  AND EXISTS (
+			      SELECT 1
+			      FROM notifications n
+			      JOIN comments c ON c.id = n.comment_id
+			      WHERE ` + pendingCondition + `
+			  )
+			ORDER BY p.next_attempt_at
+			LIMIT $1
+			FOR UPDATE OF p SKIP LOCKED
+		)
+		UPDATE notification_preferences p
+		SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $2)
+		FROM due
+		WHERE p.tenant_id = due.tenant_id AND p.user_id = due.user_id
+		RETURNING p.tenant_id, p.user_id, p.email, p.name, p.delivery, p.notified_until
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim notification digests: %w", err)
+	}
+	defer rows.Close()
+
+	var recipients []model.DigestRecipient
+	for rows.Next() {
+		var d model.DigestRecipient
+		if err := rows.Scan(&d.TenantID, &d.UserID, &d.Email, &d.Name, &d.Delivery, &d.NotifiedUntil); err != nil {
+			return nil, fmt.Errorf("failed to scan digest recipient: %w", err)
+		}
+		recipients = append(recipients, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return recipients, nil
+}
+
+// GetDigest returns up to limit of the pending notifications of a claimed
+// recipient, newest first, with the number and the newest creation time of
+// all of them.
+func (r *Repository) GetDigest(ctx context.Context, d model.DigestRecipient, limit int) (model.Digest, error) {
+	query := `
+		SELECT ` + notificationColumns + `, COUNT(*) OVER (), MAX(n.created_at) OVER ()
+		FROM notifications n
+		JOIN comments c ON c.id = n.comment_id
+		JOIN (SELECT $1::text AS tenant_id, $2::text AS user_id, $3::timestamp AS notified_until) p ON TRUE
+		WHERE ` + pendingCondition + `
+		ORDER BY n.created_at DESC, n.id DESC
+		LIMIT $4
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, d.TenantID, d.UserID, d.NotifiedUntil, limit, excerptLength)
+	if err != nil {
+		return model.Digest{}, fmt.Errorf("failed to get notification digest: %w", err)
+	}
+	defer rows.Close()
+
+	var digest model.Digest
+	for rows.Next() {
+		n, err := scanNotification(rows, &digest.Total, &digest.Until)
+		if err != nil {
+			return model.Digest{}, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		digest.Items = append(digest.Items, n)
+	}
+
+	if err := rows.Err(); err != nil {
+		return model.Digest{}, fmt.Errorf("rows error: %w", err)
+	}
+
+	return digest, nil
+}
+
+// CompleteDigest records that the notifications of a recipient created up
+// to until were emailed and releases the recipient.
+func (r *Repository) CompleteDigest(ctx context.Context, d model.DigestRecipient, until time.Time) error {
+	query := `
+		UPDATE notification_preferences
+		SET notified_until = GREATEST(notified_until, $3),
+		    last_sent_at = CURRENT_TIMESTAMP,
+		    next_attempt_at = CURRENT_TIMESTAMP
+		WHERE tenant_id = $1 AND user_id = $2
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, d.TenantID, d.UserID, until); err != nil {
+		return fmt.Errorf("failed to complete notification digest: %w", err)
+	}
+
+	return nil
+}
+
+// RetryDigest releases a recipient without recording an email, so that it
+// can be claimed again after retryAfter.
+func (r *Repository) RetryDigest(ctx context.Context, d model.DigestRecipient, retryAfter time.Duration) error {
+	query := `
+		UPDATE notification_preferences
+		SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $3)
+		WHERE tenant_id = $1 AND user_id = $2
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, d.TenantID, d.UserID, retryAfter.Seconds()); err != nil {
+		return fmt.Errorf("failed to record notification digest failure: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,256 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/wb-go/wbf/dbpg"
+
+	"github.com/aliskhannn/comment-tree/internal/model"
+	"github.com/aliskhannn/comment-tree/internal/tenant"
+)
+
+// excerptLength is the number of characters of a comment shown in its notifications.
+const excerptLength = 200
+
+// notificationColumns are the columns scanned by scanNotification, selected
+// from notifications n joined with their comments c. The excerpt length is
+// the query argument $5.
+const notificationColumns = `n.id, n.type, n.comment_id, c.thread_key, n.actor_id, n.actor_name, c.author_username,
+	left(c.content, $5), n.created_at, n.read_at`
+
+// scanner is implemented by *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanNotification scans the notificationColumns of a row, followed by the
+// columns scanned into extra.
+func scanNotification(row scanner, extra ...any) (model.Notification, error) {
+	var (
+		n                               model.Notification
+		actorID, actorName, actorHandle *string
+	)
+
+	dest := []any{
+		&n.ID, &n.Type, &n.CommentID, &n.ThreadKey, &actorID, &actorName, &actorHandle,
+		&n.Excerpt, &n.CreatedAt, &n.ReadAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return model.Notification{}, err
+	}
+
+	if actorID != nil {
+		n.Actor = &model.Author{ID: *actorID}
+		if actorName != nil {
+			n.Actor.Name = *actorName
+		}
+		if actorHandle != nil {
+			n.Actor.Username = *actorHandle
+		}
+	}
+
+	return n, nil
+}
+
+// Repository provides methods for interacting with the mention and notification tables.
+type Repository struct {
+	db *dbpg.DB
+}
+
+// NewRepository creates a new Repository.
+func NewRepository(db *dbpg.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// SaveMentions replaces the mentions of a comment with the users behind the
+// given usernames and notifies the newly mentioned users, all in one
+// transaction.
+//
+// A username refers to the latest author in the tenant who commented with it;
+// unknown usernames and the comment's own author are skipped. Users are
+// notified of a comment at most once, so saving the mentions again after an
+// edit only notifies users who were not mentioned before. Nothing is saved
+// for a comment that was purged in the meantime.
+func (r *Repository) SaveMentions(ctx context.Context, tenantID string, c model.Comment, usernames []string) error {
+	var actorID, actorName *string
+	if c.Author != nil {
+		actorID, actorName = &c.Author.ID, &c.Author.Name
+	}
+
+	tx, err := r.db.Master.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM comment_mentions WHERE comment_id = $1`, c.ID); err != nil {
+		return fmt.Errorf("failed to clear mentions: %w", err)
+	}
+
+	query := `
+		INSERT INTO comment_mentions (comment_id, user_id, username)
+		SELECT DISTINCT ON (a.author_id) $1::uuid, a.author_id, a.author_username
+		FROM unnest($2::text[]) AS m(username)
+		CROSS JOIN LATERAL (
+			SELECT author_id, author_username
+			FROM comments
+			WHERE tenant_id = $3 AND lower(author_username) = lower(m.username)
+			ORDER BY created_at DESC
+			LIMIT 1
+		) a
+		WHERE a.author_id IS DISTINCT FROM $4
+		  AND EXISTS (SELECT 1 FROM comments c WHERE c.id = $1)
+	`
+
+	if _, err := tx.ExecContext(ctx, query, c.ID, pq.Array(usernames), tenantID, actorID); err != nil {
+		return fmt.Errorf("failed to save mentions: %w", err)
+	}
+
+	query = `
+		INSERT INTO notifications (tenant_id, user_id, type, comment_id, actor_id, actor_name)
+		SELECT $1, user_id, '` + model.NotificationMention + `', comment_id, $3, $4
+		FROM comment_mentions
+		WHERE comment_id = $2
+		ON CONFLICT (user_id, comment_id, type) DO NOTHING
+	`
+
+	if _, err := tx.ExecContext(ctx, query, tenantID, c.ID, actorID, actorName); err != nil {
+		return fmt.Errorf("failed to create mention notifications: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// NotifyReply notifies the author of the parent of a reply, unless they wrote
+// the reply themselves, the parent is deleted or the reply was purged.
+// Notifying again is a no-op.
+func (r *Repository) NotifyReply(ctx context.Context, tenantID string, c model.Comment) error {
+	if c.ParentID == nil {
+		return nil
+	}
+
+	var actorID, actorName *string
+	if c.Author != nil {
+		actorID, actorName = &c.Author.ID, &c.Author.Name
+	}
+
+	query := `
+		INSERT INTO notifications (tenant_id, user_id, type, comment_id, actor_id, actor_name)
+		SELECT $1, p.author_id, '` + model.NotificationReply + `', $3, $4, $5
+		FROM comments p
+		WHERE p.id = $2 AND p.tenant_id = $1 AND p.deleted_at IS NULL
+		  AND p.author_id IS NOT NULL AND p.author_id IS DISTINCT FROM $4
+		  AND EXISTS (SELECT 1 FROM comments c WHERE c.id = $3)
+		ON CONFLICT (user_id, comment_id, type) DO NOTHING
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, tenantID, *c.ParentID, c.ID, actorID, actorName); err != nil {
+		return fmt.Errorf("failed to create reply notification: %w", err)
+	}
+
+	return nil
+}
+
+// GetNotifications returns a page of the notifications of a user in the
+// tenant of ctx, newest first, with the number of unread ones.
+//
+// Notifications about comments that were deleted or are no longer approved
+// are left out.
+func (r *Repository) GetNotifications(ctx context.Context, userID string, q model.NotificationQuery) (model.NotificationPage, error) {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return model.NotificationPage{}, err
+	}
+
+	query := `
+		SELECT ` + notificationColumns + `
+		FROM notifications n
+		JOIN comments c ON c.id = n.comment_id
+		WHERE n.tenant_id = $1 AND n.user_id = $2 AND (NOT $3 OR n.read_at IS NULL)
+		  AND c.deleted_at IS NULL AND c.status = '` + model.StatusApproved + `'
+		ORDER BY n.created_at DESC, n.id DESC
+		LIMIT $4 OFFSET $6
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, tenantID, userID, q.UnreadOnly, q.Limit, excerptLength, q.Offset)
+	if err != nil {
+		return model.NotificationPage{}, fmt.Errorf("failed to get notifications: %w", err)
+	}
+	defer rows.Close()
+
+	page := model.NotificationPage{Items: []model.Notification{}}
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return model.NotificationPage{}, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		page.Items = append(page.Items, n)
+	}
+
+	if err := rows.Err(); err != nil {
+		return model.NotificationPage{}, fmt.Errorf("failed to get notifications: %w", err)
+	}
+
+	if page.Unread, err = r.CountUnread(ctx, userID); err != nil {
+		return model.NotificationPage{}, err
+	}
+
+	return page, nil
+}
+
+// CountUnread returns the number of unread notifications of a user in the tenant of ctx.
+func (r *Repository) CountUnread(ctx context.Context, userID string) (int, error) {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+		SELECT COUNT(*)
+		FROM notifications n
+		JOIN comments c ON c.id = n.comment_id
+		WHERE n.tenant_id = $1 AND n.user_id = $2 AND n.read_at IS NULL
+		  AND c.deleted_at IS NULL AND c.status = '` + model.StatusApproved + `'
+	`
+
+	var n int
+	if err := r.db.QueryRowContext(ctx, query, tenantID, userID).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+
+	return n, nil
+}
+
+// MarkRead marks notifications of a user in the tenant of ctx as read: the
+// ones with the given IDs, or all of them if ids is nil. IDs of other users'
+// notifications are skipped.
+func (r *Repository) MarkRead(ctx context.Context, userID string, ids []uuid.UUID) error {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE notifications
+		SET read_at = CURRENT_TIMESTAMP
+		WHERE tenant_id = $1 AND user_id = $2 AND read_at IS NULL AND ($3::uuid[] IS NULL OR id = ANY($3))
+	`
+
+	var arg any
+	if ids != nil {
+		arg = pq.Array(ids)
+	}
+
+	if _, err := r.db.ExecContext(ctx, query, tenantID, userID, arg); err != nil {
+		return fmt.Errorf("failed to mark notifications as read: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/wb-go/wbf/dbpg"
+
+	"github.com/aliskhannn/comment-tree/internal/model"
+)
+
+// Repository provides methods for interacting with the outbox_events table.
+type Repository struct {
+	db *dbpg.DB
+}
+
+// NewRepository creates a new Repository.
+func NewRepository(db *dbpg.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// ClaimEvents claims up to limit unpublished events of all tenants, oldest first.
+//
+// Claimed events are hidden from other relays for lease, after which they are
+// claimed again unless they were deleted as published. Dead events are never
+// claimed, and events whose payload cannot be decoded are moved to them.
+func (r *Repository) ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]model.OutboxEvent, error) {
+	query := `
+		WITH due AS (
+			SELECT id
+			FROM outbox_events
+			WHERE dead_at IS NULL AND (claimed_until IS NULL OR claimed_until <= CURRENT_TIMESTAMP)
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE outbox_events o
+		SET claimed_until = CURRENT_TIMESTAMP + make_interval(secs => $2)
+		FROM due
+		WHERE o.id = due.id
+		RETURNING o.id, o.event_id, o.tenant_id, o.event_type, o.payload, o.attempts, o.delivered_sinks
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	type claimed struct {
+		seq   int64
+		event model.OutboxEvent
+	}
+
+	var (
+		batch     []claimed
+		malformed = make(map[uuid.UUID]error)
+	)
+	for rows.Next() {
+		var (
+			c       claimed
+			payload []byte
+		)
+		err := rows.Scan(
+			&c.seq, &c.event.EventID, &c.event.TenantID, &c.event.Type, &payload,
+			&c.event.Attempts, pq.Array(&c.event.Delivered),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+
+		// The columns are authoritative over the copies in the payload.
+		e := c.event.Event
+		if err := json.Unmarshal(payload, &c.event.Event); err != nil {
+			malformed[e.EventID] = err
+			continue
+		}
+		c.event.EventID, c.event.TenantID, c.event.Type = e.EventID, e.TenantID, e.Type
+
+		batch = append(batch, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	// Decoding will not succeed on a later attempt either.
+	for id, decodeErr := range malformed {
+		if err := r.FailEvent(ctx, id, nil, "failed to decode payload: "+decodeErr.Error(), 0); err != nil {
+			return nil, err
+		}
+	}
+
+	// RETURNING does not preserve the claim order.
+	sort.Slice(batch, func(i, j int) bool { return batch[i].seq < batch[j].seq })
+
+	events := make([]model.OutboxEvent, 0, len(batch))
+	for _, c := range batch {
+		events = append(events, c.event)
+	}
+
+	return events, nil
+}
+
+// FailEvent records a failed attempt to relay an event, along with the sinks
+// that accepted it so far, and claims it until retryAfter has passed.
+//
+// A non-positive retryAfter moves the event to the dead-letter state.
+func (r *Repository) FailEvent(ctx context.Context, eventID uuid.UUID, delivered []string, lastErr string, retryAfter time.Duration) error {
+	query := `
+		UPDATE outbox_events
+		SET attempts = attempts + 1,
+		    delivered_sinks = $2,
+		    last_error = $3,
+		    claimed_until = CURRENT_TIMESTAMP + make_interval(secs => GREATEST($4::float8, 0)),
+		    dead_at = CASE WHEN $4::float8 > 0 THEN NULL ELSE CURRENT_TIMESTAMP END
+		WHERE event_id = $1
+	`
+
+	if delivered == nil {
+		delivered = []string{}
+	}
+	if _, err := r.db.ExecContext(ctx, query, eventID, pq.Array(delivered), lastErr, retryAfter.Seconds()); err != nil {
+		return fmt.Errorf("failed to record outbox event failure: %w", err)
+	}
+
+	return nil
+}
+
+// DeferEvents keeps claimed events from being claimed again until delay has
+// passed.
+func (r *Repository) DeferEvents(ctx context.Context, eventIDs []uuid.UUID, delay time.Duration) error {
+	if len(eventIDs) == 0 {
+		return nil
+	}
+
+	query := `
+		UPDATE outbox_events
+		SET claimed_until = CURRENT_TIMESTAMP + make_interval(secs => GREATEST($2::float8, 0))
+		WHERE event_id = ANY($1)
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, pq.Array(eventIDs), delay.Seconds()); err != nil {
+		return fmt.Errorf("failed to defer outbox events: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteEvents removes published events from the outbox.
+func (r *Repository) DeleteEvents(ctx context.Context, eventIDs []uuid.UUID) error {
+	if len(eventIDs) == 0 {
+		return nil
+	}
+
+	query := `DELETE FROM outbox_events WHERE event_id = ANY($1)`
+
+	if _, err := r.db.ExecContext(ctx, query, pq.Array(eventIDs)); err != nil {
+		return fmt.Errorf("failed to delete outbox events: %w", err)
+	}
+
+	return nil
+}
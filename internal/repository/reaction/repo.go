@@ -0,0 +1,174 @@
+package reaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/wb-go/wbf/dbpg"
+
+	"github.com/aliskhannn/comment-tree/internal/auth"
+	"github.com/aliskhannn/comment-tree/internal/model"
+	"github.com/aliskhannn/comment-tree/internal/tenant"
+)
+
+var ErrCommentNotFound = errors.New("comment not found")
+
+// Repository provides methods for interacting with the comment_reactions table.
+type Repository struct {
+	db *dbpg.DB
+}
+
+// NewRepository creates a new Repository.
+func NewRepository(db *dbpg.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// AddReaction records the reaction of a user with an emoji on a comment.
+//
+// Reacting again with the same emoji is a no-op. Comments the user may not
+// see, such as pending or rejected ones of other authors, are reported as
+// not found.
+func (r *Repository) AddReaction(ctx context.Context, commentID uuid.UUID, userID, emoji string) error {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	user, _ := auth.UserFromContext(ctx)
+
+	query := `
+		WITH target AS (
+			SELECT id FROM comments
+			WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
+			  AND (status = $5 OR author_id = $3 OR $6::bool)
+		), inserted AS (
+			INSERT INTO comment_reactions (comment_id, user_id, emoji)
+			SELECT id, $3, $4 FROM target
+			ON CONFLICT (comment_id, user_id, emoji) DO NOTHING
+		)
+		SELECT EXISTS (SELECT 1 FROM target)
+	`
+
+	var found bool
+	if err := r.db.Master.QueryRowContext(
+		ctx, query, commentID, tenantID, userID, emoji, model.StatusApproved, user.IsModerator(),
+	).Scan(&found); err != nil {
+		return fmt.Errorf("failed to add reaction: %w", err)
+	}
+	if !found {
+		return ErrCommentNotFound
+	}
+
+	return nil
+}
+
+// RemoveReaction removes the reaction of a user with an emoji from a comment.
+//
+// Removing a missing reaction is a no-op.
+func (r *Repository) RemoveReaction(ctx context.Context, commentID uuid.UUID, userID, emoji string) error {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		DELETE FROM comment_reactions
+		WHERE comment_id = $1 AND user_id = $3 AND emoji = $4
+		  AND EXISTS (SELECT 1 FROM comments WHERE id = $1 AND tenant_id = $2)
+	`
+
+	if _, err := r.db.Master.ExecContext(ctx, query, commentID, tenantID, userID, emoji); err != nil {
+		return fmt.Errorf("failed to remove reaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetReactionCounts returns the number of reactions per emoji of the given
+// comments. Comments without reactions are missing from the result.
+func (r *Repository) GetReactionCounts(ctx context.Context, commentIDs []uuid.UUID) (map[uuid.UUID]map[string]int, error) {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT r.comment_id, r.emoji, COUNT(*)
+		FROM comment_reactions r
+		JOIN comments c ON c.id = r.comment_id
+		WHERE r.comment_id = ANY($1) AND c.tenant_id = $2
+		GROUP BY r.comment_id, r.emoji
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(commentIDs), tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reaction counts: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[uuid.UUID]map[string]int)
+	for rows.Next() {
+		var (
+			id    uuid.UUID
+			emoji string
+			n     int
+		)
+		if err := rows.Scan(&id, &emoji, &n); err != nil {
+			return nil, fmt.Errorf("failed to scan reaction count: %w", err)
+		}
+
+		if counts[id] == nil {
+			counts[id] = make(map[string]int)
+		}
+		counts[id][emoji] = n
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return counts, nil
+}
+
+// GetUserReactions returns the emojis a user reacted with on the given
+// comments. Comments without reactions of the user are missing from the result.
+func (r *Repository) GetUserReactions(ctx context.Context, commentIDs []uuid.UUID, userID string) (map[uuid.UUID][]string, error) {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT r.comment_id, r.emoji
+		FROM comment_reactions r
+		JOIN comments c ON c.id = r.comment_id
+		WHERE r.comment_id = ANY($1) AND r.user_id = $2 AND c.tenant_id = $3
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(commentIDs), userID, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user reactions: %w", err)
+	}
+	defer rows.Close()
+
+	reactions := make(map[uuid.UUID][]string)
+	for rows.Next() {
+		var (
+			id    uuid.UUID
+			emoji string
+		)
+		if err := rows.Scan(&id, &emoji); err != nil {
+			return nil, fmt.Errorf("failed to scan user reaction: %w", err)
+		}
+		reactions[id] = append(reactions[id], emoji)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return reactions, nil
+}
@@ -0,0 +1,406 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/wb-go/wbf/dbpg"
+
+	"github.com/aliskhannn/comment-tree/internal/model"
+	"github.com/aliskhannn/comment-tree/internal/tenant"
+)
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("delivery not found")
+)
+
+// webhookColumns is the select list shared by webhook queries. Secrets are
+// never read back for the API.
+const webhookColumns = `id, url, events, active, created_at, updated_at`
+
+// pruneBatchSize is the number of deliveries deleted per statement when pruning.
+const pruneBatchSize = 1000
+
+// deliveryColumns is the select list shared by delivery queries.
+const deliveryColumns = `
+	d.id, d.subscription_id, d.event_type, d.payload, d.status, d.attempts,
+	d.next_attempt_at, d.last_status_code, d.last_error, d.created_at, d.delivered_at
+`
+
+// scanner is implemented by *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanWebhook scans a row selected with webhookColumns.
+func scanWebhook(row scanner) (model.Webhook, error) {
+	var w model.Webhook
+	err := row.Scan(&w.ID, &w.URL, pq.Array(&w.Events), &w.Active, &w.CreatedAt, &w.UpdatedAt)
+	return w, err
+}
+
+// scanDelivery scans a row selected with deliveryColumns followed by the
+// columns scanned into extra.
+func scanDelivery(row scanner, extra ...any) (model.WebhookDelivery, error) {
+	var d model.WebhookDelivery
+	dest := append([]any{
+		&d.ID, &d.WebhookID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+		&d.NextAttemptAt, &d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt,
+	}, extra...)
+	err := row.Scan(dest...)
+	return d, err
+}
+
+// Repository provides methods for interacting with the webhook tables.
+type Repository struct {
+	db *dbpg.DB
+}
+
+// NewRepository creates a new Repository.
+func NewRepository(db *dbpg.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// CreateWebhook creates a new webhook subscription in the tenant of ctx.
+func (r *Repository) CreateWebhook(ctx context.Context, w *model.Webhook) (model.Webhook, error) {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return model.Webhook{}, err
+	}
+
+	query := `
+		INSERT INTO webhook_subscriptions (tenant_id, url, secret, events, active)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING ` + webhookColumns + `
+	`
+
+	res, err := scanWebhook(r.db.QueryRowContext(
+		ctx, query, tenantID, w.URL, w.Secret, pq.Array(w.Events), w.Active,
+	))
+	if err != nil {
+		return model.Webhook{}, fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	return res, nil
+}
+
+// GetWebhooks returns the webhook subscriptions of the tenant of ctx.
+func (r *Repository) GetWebhooks(ctx context.Context) ([]model.Webhook, error) {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + webhookColumns + ` FROM webhook_subscriptions WHERE tenant_id = $1 ORDER BY created_at`
+
+	rows, err := r.db.QueryContext(ctx, query, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := []model.Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		webhooks = append(webhooks, w)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return webhooks, nil
+}
+
+// GetWebhook returns the webhook subscription with the given ID.
+func (r *Repository) GetWebhook(ctx context.Context, id uuid.UUID) (model.Webhook, error) {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return model.Webhook{}, err
+	}
+
+	query := `SELECT ` + webhookColumns + ` FROM webhook_subscriptions WHERE id = $1 AND tenant_id = $2`
+
+	w, err := scanWebhook(r.db.QueryRowContext(ctx, query, id, tenantID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.Webhook{}, ErrWebhookNotFound
+		}
+		return model.Webhook{}, fmt.Errorf("failed to get webhook: %w", err)
+	}
+
+	return w, nil
+}
+
+// UpdateWebhook replaces the URL, events and active flag of a webhook subscription.
+func (r *Repository) UpdateWebhook(ctx context.Context, w *model.Webhook) (model.Webhook, error) {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return model.Webhook{}, err
+	}
+
+	query := `
+		UPDATE webhook_subscriptions
+		SET url = $3, events = $4, active = $5, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND tenant_id = $2
+		RETURNING ` + webhookColumns + `
+	`
+
+	res, err := scanWebhook(r.db.QueryRowContext(
+		ctx, query, w.ID, tenantID, w.URL, pq.Array(w.Events), w.Active,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.Webhook{}, ErrWebhookNotFound
+		}
+		return model.Webhook{}, fmt.Errorf("failed to update webhook: %w", err)
+	}
+
+	return res, nil
+}
+
+// DeleteWebhook deletes a webhook subscription together with its deliveries.
+func (r *Repository) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `DELETE FROM webhook_subscriptions WHERE id = $1 AND tenant_id = $2`
+
+	res, err := r.db.ExecContext(ctx, query, id, tenantID)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if n == 0 {
+		return ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+// EnqueueDeliveries queues a delivery of the payload to every active webhook
+// of the tenant that subscribes to the event type.
+//
+// Webhooks that already have a delivery of the event are skipped.
+func (r *Repository) EnqueueDeliveries(ctx context.Context, tenantID string, eventID uuid.UUID, eventType string, payload []byte) (int64, error) {
+	query := `
+		INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload)
+		SELECT id, $2, $3::text, $4::jsonb
+		FROM webhook_subscriptions
+		WHERE tenant_id = $1
+		  AND active
+		  AND (cardinality(events) = 0 OR $3::text = ANY(events))
+		ON CONFLICT (subscription_id, event_id) DO NOTHING
+	`
+
+	res, err := r.db.ExecContext(ctx, query, tenantID, eventID, eventType, string(payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to enqueue webhook deliveries: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return n, nil
+}
+
+// ClaimDeliveries claims up to limit due deliveries of all tenants.
+//
+// Claimed deliveries count an attempt and are hidden from other workers for
+// lease, after which they are retried if the worker did not record a result.
+func (r *Repository) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookDelivery, error) {
+	query := `
+		WITH due AS (
+			SELECT id
+			FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d
+		SET attempts = d.attempts + 1,
+		    next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $2)
+		FROM due, webhook_subscriptions s
+		WHERE d.id = due.id AND s.id = d.subscription_id
+		RETURNING ` + deliveryColumns + `, s.url, s.secret
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []model.WebhookDelivery
+	for rows.Next() {
+		var url, secret string
+		d, err := scanDelivery(rows, &url, &secret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		d.URL, d.Secret = url, secret
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// CompleteDelivery marks a delivery as delivered.
+func (r *Repository) CompleteDelivery(ctx context.Context, id uuid.UUID, statusCode int) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = 'delivered', last_status_code = $2, last_error = NULL, delivered_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, id, statusCode); err != nil {
+		return fmt.Errorf("failed to complete webhook delivery: %w", err)
+	}
+
+	return nil
+}
+
+// FailDelivery records a failed attempt and schedules the next one after retryAfter.
+//
+// A non-positive retryAfter moves the delivery to the dead-letter list.
+func (r *Repository) FailDelivery(ctx context.Context, id uuid.UUID, statusCode *int, lastErr string, retryAfter time.Duration) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = CASE WHEN $4::float8 > 0 THEN 'pending' ELSE 'dead' END,
+		    next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => GREATEST($4::float8, 0)),
+		    last_status_code = $2,
+		    last_error = $3
+		WHERE id = $1
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, id, statusCode, lastErr, retryAfter.Seconds()); err != nil {
+		return fmt.Errorf("failed to record webhook delivery failure: %w", err)
+	}
+
+	return nil
+}
+
+// GetDeadDeliveries returns up to limit dead deliveries of the tenant of ctx, newest first.
+func (r *Repository) GetDeadDeliveries(ctx context.Context, limit int) ([]model.WebhookDelivery, error) {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT ` + deliveryColumns + `
+		FROM webhook_deliveries d
+		JOIN webhook_subscriptions s ON s.id = d.subscription_id
+		WHERE s.tenant_id = $1 AND d.status = 'dead'
+		ORDER BY d.created_at DESC, d.id DESC
+		LIMIT $2
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, tenantID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dead webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []model.WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// RetryDelivery moves a dead delivery back to the queue with a fresh set of attempts.
+func (r *Repository) RetryDelivery(ctx context.Context, id uuid.UUID) error {
+	tenantID, err := tenant.IDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE webhook_deliveries d
+		SET status = 'pending', attempts = 0, next_attempt_at = CURRENT_TIMESTAMP
+		FROM webhook_subscriptions s
+		WHERE d.id = $1 AND d.status = 'dead'
+		  AND s.id = d.subscription_id AND s.tenant_id = $2
+	`
+
+	res, err := r.db.ExecContext(ctx, query, id, tenantID)
+	if err != nil {
+		return fmt.Errorf("failed to retry webhook delivery: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if n == 0 {
+		return ErrDeliveryNotFound
+	}
+
+	return nil
+}
+
+// PruneDeliveries deletes the deliveries of all tenants that were delivered
+// more than retention ago. Dead deliveries are kept for manual retries. It
+// returns the number of deleted deliveries.
+func (r *Repository) PruneDeliveries(ctx context.Context, retention time.Duration) (int64, error) {
+	// Delete in batches to keep every statement short.
+	query := `
+		DELETE FROM webhook_deliveries
+		WHERE id IN (
+			SELECT id
+			FROM webhook_deliveries
+			WHERE status = 'delivered' AND delivered_at < CURRENT_TIMESTAMP - make_interval(secs => $1)
+			LIMIT $2
+		)
+	`
+
+	var total int64
+	for {
+		res, err := r.db.ExecContext(ctx, query, retention.Seconds(), pruneBatchSize)
+		if err != nil {
+			return total, fmt.Errorf("failed to prune webhook deliveries: %w", err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		total += n
+
+		if n < pruneBatchSize {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,9 @@
+package comment
+
+import "github.com/google/uuid"
+
+// treeCursor is the decoded form of a subtree continuation token.
+type treeCursor struct {
+	ID     uuid.UUID `json:"id"` // comment whose replies are continued
+	Offset int       `json:"o"`  // number of replies already loaded
+}
@@ -0,0 +1,131 @@
+package comment
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/aliskhannn/comment-tree/internal/model"
+)
+
+// maxDiffCells bounds the size of the LCS table of a diff. Changed regions
+// beyond it are diffed as a whole deletion followed by a whole insertion, so
+// that diffing large revisions stays cheap.
+const maxDiffCells = 1 << 20
+
+// diffWords computes a word-level diff between a and b.
+//
+// Whitespace runs are kept as separate tokens so that concatenating the
+// equal and insert fragments reproduces b exactly. The common prefix and
+// suffix are matched directly; the LCS table only covers the changed region
+// between them, up to maxDiffCells.
+func diffWords(a, b string) []model.DiffOp {
+	at, bt := tokenize(a), tokenize(b)
+
+	// Runs of tokens with the same operation are merged into one fragment.
+	ops := make([]model.DiffOp, 0)
+	var (
+		runOp string
+		run   strings.Builder
+	)
+	flush := func() {
+		if run.Len() > 0 {
+			ops = append(ops, model.DiffOp{Op: runOp, Text: run.String()})
+			run.Reset()
+		}
+	}
+	push := func(op, text string) {
+		if op != runOp {
+			flush()
+			runOp = op
+		}
+		run.WriteString(text)
+	}
+
+	prefix := 0
+	for prefix < len(at) && prefix < len(bt) && at[prefix] == bt[prefix] {
+		push(model.DiffEqual, at[prefix])
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(at)-prefix && suffix < len(bt)-prefix && at[len(at)-1-suffix] == bt[len(bt)-1-suffix] {
+		suffix++
+	}
+	am, bm := at[prefix:len(at)-suffix], bt[prefix:len(bt)-suffix]
+
+	if (len(am)+1)*(len(bm)+1) > maxDiffCells {
+		for _, t := range am {
+			push(model.DiffDelete, t)
+		}
+		for _, t := range bm {
+			push(model.DiffInsert, t)
+		}
+	} else {
+		diffLCS(am, bm, push)
+	}
+
+	for _, t := range at[len(at)-suffix:] {
+		push(model.DiffEqual, t)
+	}
+	flush()
+
+	return ops
+}
+
+// diffLCS diffs the tokens at and bt through their longest common
+// subsequence, passing the operations to push in order.
+func diffLCS(at, bt []string, push func(op, text string)) {
+	// lcs[i*w+j] holds the LCS length of at[i:] and bt[j:].
+	w := len(bt) + 1
+	lcs := make([]int32, (len(at)+1)*w)
+	for i := len(at) - 1; i >= 0; i-- {
+		for j := len(bt) - 1; j >= 0; j-- {
+			if at[i] == bt[j] {
+				lcs[i*w+j] = lcs[(i+1)*w+j+1] + 1
+			} else {
+				lcs[i*w+j] = max(lcs[(i+1)*w+j], lcs[i*w+j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(at) && j < len(bt) {
+		switch {
+		case at[i] == bt[j]:
+			push(model.DiffEqual, at[i])
+			i++
+			j++
+		case lcs[(i+1)*w+j] >= lcs[i*w+j+1]:
+			push(model.DiffDelete, at[i])
+			i++
+		default:
+			push(model.DiffInsert, bt[j])
+			j++
+		}
+	}
+	for ; i < len(at); i++ {
+		push(model.DiffDelete, at[i])
+	}
+	for ; j < len(bt); j++ {
+		push(model.DiffInsert, bt[j])
+	}
+}
+
+// tokenize splits s into alternating runs of whitespace and non-whitespace.
+func tokenize(s string) []string {
+	var tokens []string
+
+	start, prevSpace := 0, false
+	for i, r := range s {
+		space := unicode.IsSpace(r)
+		if i > 0 && space != prevSpace {
+			tokens = append(tokens, s[start:i])
+			start = i
+		}
+		prevSpace = space
+	}
+	if start < len(s) {
+		tokens = append(tokens, s[start:])
+	}
+
+	return tokens
+}
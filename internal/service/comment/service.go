@@ -2,46 +2,568 @@ package comment
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 
+	"github.com/aliskhannn/comment-tree/internal/auth"
+	"github.com/aliskhannn/comment-tree/internal/cursor"
 	"github.com/aliskhannn/comment-tree/internal/model"
+	"github.com/aliskhannn/comment-tree/internal/service/filter"
+	"github.com/aliskhannn/comment-tree/internal/tenant"
 )
 
 // Repository provides methods for interacting with the comments table.
 type Repository interface {
 	CreateComment(ctx context.Context, comment *model.Comment) (model.Comment, error)
-	GetCommentsByParentID(ctx context.Context, parentID uuid.UUID) ([]model.Comment, error)
-	GetComments(ctx context.Context, parentID *uuid.UUID, search string, sort string, limit, offset int) ([]model.Comment, error)
-	DeleteComment(ctx context.Context, id uuid.UUID) error
+	GetCommentsByParentID(ctx context.Context, parentID uuid.UUID, sort string) ([]model.Comment, error)
+	GetSubtree(ctx context.Context, id uuid.UUID, opts model.TreeOptions, offset int) ([]*model.CommentNode, error)
+	GetComments(ctx context.Context, q model.CommentQuery) (model.CommentPage, error)
+	Autocomplete(ctx context.Context, q model.AutocompleteQuery) ([]string, error)
+	GetComment(ctx context.Context, id uuid.UUID) (model.Comment, error)
+	DeleteComment(ctx context.Context, id uuid.UUID, deletedBy string) error
+	PurgeComment(ctx context.Context, id uuid.UUID) error
+	PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error)
+	UpdateComment(ctx context.Context, id uuid.UUID, content, contentHTML, flagReason string) (model.Comment, error)
+	GetRevisions(ctx context.Context, id uuid.UUID) ([]model.Revision, error)
+	Vote(ctx context.Context, id uuid.UUID, userID string, value int) (model.Comment, error)
+	GetModerationQueue(ctx context.Context, q model.ModerationQuery) ([]model.Comment, error)
+	ModerateComments(ctx context.Context, d model.ModerationDecision, moderatorID string) ([]model.Comment, error)
+	SetThreadModerationMode(ctx context.Context, threadKey, mode string) error
+	SetThreadLanguage(ctx context.Context, threadKey, language string) error
+	ReportComment(ctx context.Context, id uuid.UUID, reporterID, reason, details string, threshold int) (bool, error)
+	GetReportedComments(ctx context.Context, limit, offset int) ([]model.ReportedComment, error)
 }
 
+// Reactions attaches the aggregated reactions to comments.
+type Reactions interface {
+	Attach(ctx context.Context, comments ...*model.Comment) error
+}
+
+// ContentFilter checks comment content before it is persisted.
+type ContentFilter interface {
+	Run(ctx context.Context, in filter.Input) (filter.Result, error)
+}
+
+// Renderer renders comment content to sanitized HTML.
+type Renderer interface {
+	Render(content string) (string, error)
+}
+
+var (
+	// ErrUnauthenticated is returned when an operation requires an authenticated user.
+	ErrUnauthenticated = errors.New("authentication required")
+	// ErrForbidden is returned when the user may not modify the comment.
+	ErrForbidden = errors.New("only the author or a moderator may modify this comment")
+)
+
+// ErrRevisionNotFound is returned when a requested revision does not exist.
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// ErrContentTooLong is returned when the content exceeds the tenant's limit.
+var ErrContentTooLong = errors.New("content is too long")
+
+var (
+	// ErrInvalidStatus is returned when a moderation decision sets an unknown status.
+	ErrInvalidStatus = errors.New("status must be approved, rejected or spam")
+	// ErrInvalidModerationMode is returned when a thread is set to an unknown moderation mode.
+	ErrInvalidModerationMode = errors.New("moderation mode must be post, pre or empty")
+	// ErrInvalidReportReason is returned when a report has an unknown reason.
+	ErrInvalidReportReason = errors.New("unknown report reason")
+	// ErrInvalidLanguage is returned when a comment, search or thread names an unsupported language.
+	ErrInvalidLanguage = errors.New("unsupported language")
+	// ErrInvalidSearchMode is returned when a search names an unknown mode.
+	ErrInvalidSearchMode = errors.New("search mode must be fts, fuzzy or prefix")
+)
+
 // Service provides methods for interacting with the comments table.
 type Service struct {
-	repo Repository
+	repo      Repository
+	reactions Reactions
+	filters   ContentFilter
+	renderer  Renderer
 }
 
 // NewService creates a new Service.
-func NewService(repo Repository) *Service {
-	return &Service{repo: repo}
+func NewService(repo Repository, reactions Reactions, filters ContentFilter, renderer Renderer) *Service {
+	return &Service{repo: repo, reactions: reactions, filters: filters, renderer: renderer}
 }
 
-// CreateComment creates a new comment.
+// CreateComment creates a new comment authored by the user in ctx.
+//
+// The content passes the content filters first and is stored together with
+// its rendered HTML. Comments of moderators are approved right away; flagged
+// comments of others are held for review and the rest follow the moderation
+// mode of their thread.
 func (s *Service) CreateComment(ctx context.Context, comment *model.Comment) (model.Comment, error) {
-	return s.repo.CreateComment(ctx, comment)
+	user, ok := auth.UserFromContext(ctx)
+	if !ok {
+		return model.Comment{}, ErrUnauthenticated
+	}
+
+	res, err := s.filters.Run(ctx, filter.Input{Content: comment.Content, AuthorID: user.ID})
+	if err != nil {
+		return model.Comment{}, err
+	}
+	comment.Content = res.Content
+
+	if err := checkContentLength(ctx, comment.Content); err != nil {
+		return model.Comment{}, err
+	}
+
+	if comment.Language != "" {
+		lang, ok := model.ParseLanguage(comment.Language)
+		if !ok {
+			return model.Comment{}, ErrInvalidLanguage
+		}
+		comment.Language = lang
+	}
+
+	if comment.ContentHTML, err = s.renderer.Render(comment.Content); err != nil {
+		return model.Comment{}, err
+	}
+
+	comment.Author = &model.Author{ID: user.ID, Name: user.Name, Username: user.Username}
+	comment.Status, comment.ModerationReason = "", nil
+	switch {
+	case user.IsModerator():
+		comment.Status = model.StatusApproved
+	case res.Flagged():
+		reason := flagReason(res)
+		comment.Status, comment.ModerationReason = model.StatusPending, &reason
+	}
+
+	c, err := s.repo.CreateComment(ctx, comment)
+	if err != nil {
+		return model.Comment{}, err
+	}
+	c.Reactions = []model.Reaction{}
+
+	return c, nil
 }
 
-// GetCommentsByParentID returns the comment with the given ID and all nested descendants.
-func (s *Service) GetCommentsByParentID(ctx context.Context, parentID uuid.UUID) ([]model.Comment, error) {
-	return s.repo.GetCommentsByParentID(ctx, parentID)
+// GetCommentsByParentID returns the comment with the given ID and all nested
+// descendants, siblings ordered by opts.Sort.
+//
+// A non-nil opts.ThreadKey only matches comments of that thread; otherwise nothing is returned.
+func (s *Service) GetCommentsByParentID(ctx context.Context, parentID uuid.UUID, opts model.TreeOptions) ([]model.Comment, error) {
+	comments, err := s.repo.GetCommentsByParentID(ctx, parentID, opts.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.ThreadKey != nil {
+		for _, c := range comments {
+			if c.ID == parentID && c.ThreadKey != *opts.ThreadKey {
+				return nil, nil
+			}
+		}
+	}
+
+	if err := s.attachReactions(ctx, comments); err != nil {
+		return nil, err
+	}
+
+	return comments, nil
 }
 
-// GetComments returns comments by parent ID with optional search, sorting, and pagination.
-func (s *Service) GetComments(ctx context.Context, parentID *uuid.UUID, search, sort string, limit, offset int) ([]model.Comment, error) {
-	return s.repo.GetComments(ctx, parentID, search, sort, limit, offset)
+// GetCommentTree returns the comment with the given ID and its nested descendants as a tree.
+//
+// Unless opts are limited the whole subtree is loaded. Otherwise truncated
+// nodes carry a NextCursor; passing it back in opts.Cursor for the same ID
+// loads the next slice of that node's replies. It returns a nil tree if the
+// comment does not exist.
+func (s *Service) GetCommentTree(ctx context.Context, id uuid.UUID, opts model.TreeOptions) (*model.CommentNode, error) {
+	if !opts.Limited() {
+		comments, err := s.GetCommentsByParentID(ctx, id, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		return model.BuildTree(comments, id), nil
+	}
+
+	var offset int
+	if opts.Cursor != "" {
+		var cur treeCursor
+		if err := cursor.Decode(opts.Cursor, &cur); err != nil {
+			return nil, err
+		}
+		if cur.ID != id || cur.Offset < 0 {
+			return nil, cursor.ErrInvalid
+		}
+		offset = cur.Offset
+	}
+
+	nodes, err := s.repo.GetSubtree(ctx, id, opts, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := model.LinkTree(nodes, id)
+	if tree == nil || (opts.ThreadKey != nil && tree.ThreadKey != *opts.ThreadKey) {
+		return nil, nil
+	}
+
+	setNextCursors(tree, offset)
+
+	var comments []*model.Comment
+	walkTree(tree, func(n *model.CommentNode) { comments = append(comments, &n.Comment) })
+	if err := s.reactions.Attach(ctx, comments...); err != nil {
+		return nil, err
+	}
+
+	return tree, nil
+}
+
+// walkTree calls fn for every node of the subtree in pre-order.
+func walkTree(n *model.CommentNode, fn func(*model.CommentNode)) {
+	fn(n)
+	for _, child := range n.Children {
+		walkTree(child, fn)
+	}
+}
+
+// setNextCursors sets NextCursor on every node of the subtree whose replies
+// were not all loaded. offset is the number of the root's replies skipped.
+func setNextCursors(n *model.CommentNode, offset int) {
+	if loaded := offset + len(n.Children); loaded < n.ReplyCount {
+		n.NextCursor = cursor.Encode(treeCursor{ID: n.ID, Offset: loaded})
+	}
+
+	for _, child := range n.Children {
+		setNextCursors(child, 0)
+	}
+}
+
+// GetComments returns a page of comments by parent ID with optional search and sorting.
+//
+// q.Language may name the language of the search by name or ISO 639-1 code.
+func (s *Service) GetComments(ctx context.Context, q model.CommentQuery) (model.CommentPage, error) {
+	switch q.SearchMode {
+	case "", model.SearchFTS, model.SearchFuzzy, model.SearchPrefix:
+	default:
+		return model.CommentPage{}, ErrInvalidSearchMode
+	}
+
+	if q.Language != "" {
+		lang, ok := model.ParseLanguage(q.Language)
+		if !ok {
+			return model.CommentPage{}, ErrInvalidLanguage
+		}
+		q.Language = lang
+	}
+
+	page, err := s.repo.GetComments(ctx, q)
+	if err != nil {
+		return model.CommentPage{}, err
+	}
+
+	if err := s.attachReactions(ctx, page.Items); err != nil {
+		return model.CommentPage{}, err
+	}
+
+	return page, nil
 }
 
-// DeleteComment deletes a comment by ID and all nested descendants.
+// minAutocompletePrefix is the number of characters the last word of a
+// search needs before it is completed.
+const minAutocompletePrefix = 2
+
+// Autocomplete suggests searches completing the last word of text with words
+// of the comments in the tenant of ctx, or of the thread if threadKey is not
+// nil. It returns up to limit suggestions, nothing while the last word is
+// shorter than minAutocompletePrefix or already complete.
+func (s *Service) Autocomplete(ctx context.Context, threadKey *string, text string, limit int) ([]string, error) {
+	start := 0
+	if i := strings.LastIndexFunc(text, unicode.IsSpace); i >= 0 {
+		_, size := utf8.DecodeRuneInString(text[i:])
+		start = i + size
+	}
+	prefix := text[start:]
+	if utf8.RuneCountInString(prefix) < minAutocompletePrefix {
+		return []string{}, nil
+	}
+
+	words, err := s.repo.Autocomplete(ctx, model.AutocompleteQuery{ThreadKey: threadKey, Prefix: prefix, Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := make([]string, len(words))
+	for i, w := range words {
+		suggestions[i] = text[:start] + w
+	}
+
+	return suggestions, nil
+}
+
+// attachReactions attaches the aggregated reactions to every comment of a
+// list and of their contexts.
+func (s *Service) attachReactions(ctx context.Context, comments []model.Comment) error {
+	ptrs := make([]*model.Comment, 0, len(comments))
+	for i := range comments {
+		ptrs = append(ptrs, &comments[i])
+		if cc := comments[i].Context; cc != nil {
+			for j := range cc.Ancestors {
+				ptrs = append(ptrs, &cc.Ancestors[j])
+			}
+			for j := range cc.Children {
+				ptrs = append(ptrs, &cc.Children[j])
+			}
+		}
+	}
+
+	return s.reactions.Attach(ctx, ptrs...)
+}
+
+// DeleteComment soft-deletes a comment by ID, keeping its replies.
+//
+// Only the author or a moderator may delete a comment.
 func (s *Service) DeleteComment(ctx context.Context, id uuid.UUID) error {
-	return s.repo.DeleteComment(ctx, id)
+	user, err := s.authorize(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.DeleteComment(ctx, id, user.ID)
+}
+
+// PurgeComment permanently deletes a comment by ID and all nested descendants.
+func (s *Service) PurgeComment(ctx context.Context, id uuid.UUID) error {
+	return s.repo.PurgeComment(ctx, id)
+}
+
+// PurgeDeleted permanently deletes comments soft-deleted more than retention ago.
+//
+// A zero retention purges every deleted comment without live replies.
+func (s *Service) PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error) {
+	return s.repo.PurgeDeleted(ctx, retention)
+}
+
+// UpdateComment replaces the content of a comment, keeping the previous content as a revision.
+//
+// Only the author or a moderator may edit a comment. The new content passes
+// the content filters; flagged edits of others than moderators hold the
+// comment for review.
+func (s *Service) UpdateComment(ctx context.Context, id uuid.UUID, content string) (model.Comment, error) {
+	user, err := s.authorize(ctx, id)
+	if err != nil {
+		return model.Comment{}, err
+	}
+
+	res, err := s.filters.Run(ctx, filter.Input{Content: content, AuthorID: user.ID, CommentID: &id})
+	if err != nil {
+		return model.Comment{}, err
+	}
+
+	if err := checkContentLength(ctx, res.Content); err != nil {
+		return model.Comment{}, err
+	}
+
+	html, err := s.renderer.Render(res.Content)
+	if err != nil {
+		return model.Comment{}, err
+	}
+
+	var reason string
+	if res.Flagged() && !user.IsModerator() {
+		reason = flagReason(res)
+	}
+
+	c, err := s.repo.UpdateComment(ctx, id, res.Content, html, reason)
+	if err != nil {
+		return model.Comment{}, err
+	}
+
+	if err := s.reactions.Attach(ctx, &c); err != nil {
+		return model.Comment{}, err
+	}
+
+	return c, nil
+}
+
+// Vote sets the vote of the user in ctx on a comment to value, one of
+// model.VoteUp, model.VoteDown or model.VoteNone to withdraw it.
+//
+// Each user has at most one vote per comment; voting again replaces it.
+func (s *Service) Vote(ctx context.Context, id uuid.UUID, value int) (model.Comment, error) {
+	user, ok := auth.UserFromContext(ctx)
+	if !ok {
+		return model.Comment{}, ErrUnauthenticated
+	}
+
+	c, err := s.repo.Vote(ctx, id, user.ID, value)
+	if err != nil {
+		return model.Comment{}, err
+	}
+
+	if err := s.reactions.Attach(ctx, &c); err != nil {
+		return model.Comment{}, err
+	}
+
+	return c, nil
+}
+
+// GetModerationQueue returns the comments with the status of q, pending by
+// default, oldest first.
+func (s *Service) GetModerationQueue(ctx context.Context, q model.ModerationQuery) ([]model.Comment, error) {
+	if q.Status == "" {
+		q.Status = model.StatusPending
+	}
+
+	return s.repo.GetModerationQueue(ctx, q)
+}
+
+// ModerateComments applies a moderation decision of the moderator in ctx to
+// several comments and returns the changed ones.
+func (s *Service) ModerateComments(ctx context.Context, d model.ModerationDecision) ([]model.Comment, error) {
+	user, ok := auth.UserFromContext(ctx)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	if !user.IsModerator() {
+		return nil, ErrForbidden
+	}
+
+	switch d.Status {
+	case model.StatusApproved, model.StatusRejected, model.StatusSpam:
+	default:
+		return nil, ErrInvalidStatus
+	}
+
+	return s.repo.ModerateComments(ctx, d, user.ID)
+}
+
+// SetThreadModerationMode overrides the moderation mode of the tenant for a
+// thread. An empty mode restores the tenant's mode.
+func (s *Service) SetThreadModerationMode(ctx context.Context, threadKey, mode string) error {
+	switch mode {
+	case "", model.ModerationPost, model.ModerationPre:
+	default:
+		return ErrInvalidModerationMode
+	}
+
+	return s.repo.SetThreadModerationMode(ctx, threadKey, mode)
+}
+
+// SetThreadLanguage overrides the language of the tenant for new comments
+// and searches in a thread. An empty language restores the tenant's language.
+func (s *Service) SetThreadLanguage(ctx context.Context, threadKey, language string) error {
+	if language != "" {
+		lang, ok := model.ParseLanguage(language)
+		if !ok {
+			return ErrInvalidLanguage
+		}
+		language = lang
+	}
+
+	return s.repo.SetThreadLanguage(ctx, threadKey, language)
+}
+
+// ReportComment reports a comment on behalf of the user in ctx.
+//
+// Once the comment reaches the report threshold of the tenant, it is hidden
+// pending review. It reports whether the comment was hidden.
+func (s *Service) ReportComment(ctx context.Context, id uuid.UUID, reason, details string) (bool, error) {
+	user, ok := auth.UserFromContext(ctx)
+	if !ok {
+		return false, ErrUnauthenticated
+	}
+
+	t, ok := tenant.FromContext(ctx)
+	if !ok {
+		return false, tenant.ErrNoTenant
+	}
+
+	if !slices.Contains(model.ReportReasons, reason) {
+		return false, fmt.Errorf("%w: %s", ErrInvalidReportReason, reason)
+	}
+
+	return s.repo.ReportComment(ctx, id, user.ID, reason, details, t.ReportThreshold)
+}
+
+// GetReportedComments returns the comments with open reports, most reported first.
+func (s *Service) GetReportedComments(ctx context.Context, limit, offset int) ([]model.ReportedComment, error) {
+	return s.repo.GetReportedComments(ctx, limit, offset)
+}
+
+// flagReason returns the moderation reason of flagged content.
+func flagReason(res filter.Result) string {
+	return strings.Join(res.Flags, "; ")
+}
+
+// checkContentLength checks content against the maximum length of the tenant in ctx.
+func checkContentLength(ctx context.Context, content string) error {
+	t, ok := tenant.FromContext(ctx)
+	if !ok {
+		return tenant.ErrNoTenant
+	}
+
+	if utf8.RuneCountInString(content) > t.MaxContentLength {
+		return fmt.Errorf("%w: at most %d characters", ErrContentTooLong, t.MaxContentLength)
+	}
+
+	return nil
+}
+
+// authorize checks that the user in ctx may modify the comment with the given ID.
+//
+// Deleted comments pass the check; the repository reports them as not found.
+func (s *Service) authorize(ctx context.Context, id uuid.UUID) (model.User, error) {
+	user, ok := auth.UserFromContext(ctx)
+	if !ok {
+		return model.User{}, ErrUnauthenticated
+	}
+
+	c, err := s.repo.GetComment(ctx, id)
+	if err != nil {
+		return model.User{}, err
+	}
+
+	if c.DeletedAt == nil && !user.IsModerator() && (c.Author == nil || c.Author.ID != user.ID) {
+		return model.User{}, ErrForbidden
+	}
+
+	return user, nil
+}
+
+// GetRevisions returns all versions of a comment ordered from oldest to newest.
+func (s *Service) GetRevisions(ctx context.Context, id uuid.UUID) ([]model.Revision, error) {
+	return s.repo.GetRevisions(ctx, id)
+}
+
+// DiffRevisions returns a word-level diff between two versions of a comment.
+//
+// A zero from or to selects the previous and the current version respectively.
+func (s *Service) DiffRevisions(ctx context.Context, id uuid.UUID, from, to int) (model.RevisionDiff, error) {
+	revisions, err := s.repo.GetRevisions(ctx, id)
+	if err != nil {
+		return model.RevisionDiff{}, err
+	}
+
+	if to == 0 {
+		to = len(revisions)
+	}
+	if from == 0 {
+		from = max(to-1, 1)
+	}
+
+	if from < 1 || to < 1 || from > len(revisions) || to > len(revisions) {
+		return model.RevisionDiff{}, ErrRevisionNotFound
+	}
+
+	// Versions are dense and ordered, so version N is at index N-1.
+	return model.RevisionDiff{
+		CommentID: id,
+		From:      from,
+		To:        to,
+		Ops:       diffWords(revisions[from-1].Content, revisions[to-1].Content),
+	}, nil
 }
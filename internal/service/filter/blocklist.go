@@ -0,0 +1,192 @@
+package filter
+
+import (
+	"context"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// confusables maps letters that look like Latin ones to them.
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o',
+	'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'і': 'i', 'ј': 'j', 'ѕ': 's',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o',
+	'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x',
+}
+
+// leet maps digits and symbols used as letters to them.
+var leet = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b', '9': 'g',
+	'@': 'a', '$': 's', '!': 'i', '|': 'l', '+': 't',
+}
+
+// normalize folds a word to the form blocklist entries are compared in:
+// lower case, compatibility-decomposed without diacritics, with confusable
+// letters and leetspeak mapped to Latin letters and everything else dropped.
+func normalize(word string) string {
+	var b strings.Builder
+	for _, r := range norm.NFKD.String(strings.ToLower(word)) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if c, ok := confusables[r]; ok {
+			r = c
+		} else if c, ok := leet[r]; ok {
+			r = c
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// notLetter reports whether r is not a letter.
+func notLetter(r rune) bool {
+	return !unicode.IsLetter(r)
+}
+
+// forms returns the normalized forms a word is matched in: as a whole, and
+// without the digits and punctuation around it, which would otherwise be
+// mapped to letters as in "bad!" becoming "badi".
+func forms(word string) []string {
+	whole := normalize(word)
+	if trimmed := strings.TrimFunc(word, notLetter); trimmed != word {
+		if n := normalize(trimmed); n != whole {
+			return []string{whole, n}
+		}
+	}
+
+	return []string{whole}
+}
+
+// matches reports whether any form of word is blocked.
+func (b *Blocklist) matches(word string) bool {
+	for _, f := range forms(word) {
+		if _, ok := b.words[f]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Blocklist matches words of the content against a list of blocked words.
+//
+// Words are whole tokens: runs of letters and numbers between any other
+// characters, so "bad," and "(bad)" match "bad" but "badge" does not. They
+// are compared after normalization, so "B4D" and "bаd" with a Cyrillic a
+// match "bad" too. Words spelled out with symbols, like "b.a.d" or "$hit",
+// are found by also normalizing the whitespace-separated chunk they are part
+// of. Rewrites mask matched tokens or chunks with asterisks.
+type Blocklist struct {
+	words  map[string]struct{}
+	action Action
+}
+
+// NewBlocklist creates a new Blocklist taking action on content with any of the words.
+func NewBlocklist(words []string, action Action) *Blocklist {
+	b := &Blocklist{words: make(map[string]struct{}, len(words)), action: action}
+	for _, w := range words {
+		if n := normalize(w); n != "" {
+			b.words[n] = struct{}{}
+		}
+	}
+
+	return b
+}
+
+// Check implements Filter.
+func (b *Blocklist) Check(_ context.Context, in Input) (Verdict, error) {
+	var (
+		out     strings.Builder
+		matched bool
+	)
+
+	// Rebuild the content chunk by chunk so matches can be masked in place.
+	rest := in.Content
+	for rest != "" {
+		i := strings.IndexFunc(rest, unicode.IsSpace)
+		if i == 0 {
+			_, size := utf8.DecodeRuneInString(rest)
+			out.WriteString(rest[:size])
+			rest = rest[size:]
+			continue
+		}
+		if i < 0 {
+			i = len(rest)
+		}
+
+		chunk := rest[:i]
+		rest = rest[i:]
+
+		// Masking tokens keeps the punctuation around them; the chunk only
+		// matters if no token does.
+		masked, ok := b.maskTokens(chunk)
+		if !ok && b.matches(chunk) {
+			masked, ok = mask(chunk), true
+		}
+		matched = matched || ok
+		out.WriteString(masked)
+	}
+
+	switch {
+	case !matched:
+		return Verdict{Action: Allow}, nil
+	case b.action == Rewrite:
+		return Verdict{Action: Rewrite, Content: out.String()}, nil
+	default:
+		return Verdict{Action: b.action, Reason: "content contains blocked words"}, nil
+	}
+}
+
+// maskTokens masks the blocked tokens of a chunk. It reports whether any
+// token was blocked.
+func (b *Blocklist) maskTokens(chunk string) (string, bool) {
+	var (
+		out     strings.Builder
+		matched bool
+	)
+
+	rest := chunk
+	for rest != "" {
+		i := strings.IndexFunc(rest, isWordRune)
+		if i < 0 {
+			i = len(rest)
+		}
+		out.WriteString(rest[:i])
+		rest = rest[i:]
+
+		j := strings.IndexFunc(rest, func(r rune) bool { return !isWordRune(r) })
+		if j < 0 {
+			j = len(rest)
+		}
+		token := rest[:j]
+		rest = rest[j:]
+
+		if token != "" && b.matches(token) {
+			matched = true
+			token = mask(token)
+		}
+		out.WriteString(token)
+	}
+
+	return out.String(), matched
+}
+
+// isWordRune reports whether r is part of a token: a letter, a number or a
+// combining mark.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.Is(unicode.Mn, r)
+}
+
+// mask replaces every character of s with an asterisk.
+func mask(s string) string {
+	return strings.Repeat("*", utf8.RuneCountInString(s))
+}
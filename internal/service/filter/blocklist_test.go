@@ -0,0 +1,60 @@
+package filter
+
+import (
+	"context"
+	"testing"
+)
+
+func TestBlocklist(t *testing.T) {
+	b := NewBlocklist([]string{"bad", "badword"}, Rewrite)
+
+	tests := []struct {
+		content string
+		want    string // rewritten content, empty if allowed
+	}{
+		{content: "bad", want: "***"},
+		{content: "this is bad, really", want: "this is ***, really"},
+		{content: "so bad.", want: "so ***."},
+		{content: "(bad)", want: "(***)"},
+		{content: "\"bad\"", want: "\"***\""},
+		{content: "bad!", want: "***!"},
+		{content: "bad!!", want: "***!!"},
+		{content: "badword1", want: "********"},
+		{content: "bad…", want: "***…"},
+		{content: "bad-tempered", want: "***-tempered"},
+		{content: "well,bad", want: "well,***"},
+		{content: "BAD", want: "***"},
+		{content: "B4D", want: "***"},
+		{content: "bаd", want: "***"}, // Cyrillic a
+		{content: "bád", want: "***"},
+		{content: "b.a.d", want: "*****"},
+		{content: "b a d"},
+		{content: "badge"},
+		{content: "notbad"},
+		{content: "badwords"},
+		{content: "a good comment."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.content, func(t *testing.T) {
+			v, err := b.Check(context.Background(), Input{Content: tt.content})
+			if err != nil {
+				t.Fatalf("Check: %v", err)
+			}
+
+			if tt.want == "" {
+				if v.Action != Allow {
+					t.Errorf("got action %v with content %q, want Allow", v.Action, v.Content)
+				}
+				return
+			}
+
+			if v.Action != Rewrite {
+				t.Fatalf("got action %v, want Rewrite", v.Action)
+			}
+			if v.Content != tt.want {
+				t.Errorf("got %q, want %q", v.Content, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package filter
+
+import (
+	"context"
+	"time"
+)
+
+// RecentComments looks up recent comments of an author.
+type RecentComments interface {
+	HasRecentDuplicate(ctx context.Context, authorID, content string, since time.Time) (bool, error)
+}
+
+// Duplicate catches authors posting the same content again within a window.
+//
+// Content is compared ignoring case and runs of whitespace. Edits are not checked.
+type Duplicate struct {
+	comments RecentComments
+	window   time.Duration
+	action   Action
+}
+
+// NewDuplicate creates a new Duplicate taking action on content the author
+// already posted within window.
+func NewDuplicate(comments RecentComments, window time.Duration, action Action) *Duplicate {
+	return &Duplicate{comments: comments, window: window, action: action}
+}
+
+// Check implements Filter.
+func (d *Duplicate) Check(ctx context.Context, in Input) (Verdict, error) {
+	if in.CommentID != nil || in.AuthorID == "" {
+		return Verdict{Action: Allow}, nil
+	}
+
+	dup, err := d.comments.HasRecentDuplicate(ctx, in.AuthorID, in.Content, time.Now().Add(-d.window))
+	if err != nil {
+		return Verdict{}, err
+	}
+	if !dup {
+		return Verdict{Action: Allow}, nil
+	}
+
+	return Verdict{Action: d.action, Reason: "duplicate of a recent comment"}, nil
+}
@@ -0,0 +1,113 @@
+// Package filter checks comment content before it is persisted.
+//
+// A Chain runs Filters in order. Each filter allows the content, rewrites it
+// for the filters after it, flags it for moderation or rejects it.
+package filter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// ErrRejected is returned when a filter rejects the content.
+var ErrRejected = errors.New("content rejected")
+
+// Action is what a filter decided about the content.
+type Action int
+
+// Actions of a Verdict, from the mildest to the strictest.
+const (
+	Allow   Action = iota
+	Rewrite        // replace the content with Verdict.Content
+	Flag           // hold the comment for moderation
+	Reject         // refuse the comment
+)
+
+// ParseAction parses the configured name of an action: rewrite, flag or reject.
+func ParseAction(s string) (Action, error) {
+	switch strings.ToLower(s) {
+	case "rewrite":
+		return Rewrite, nil
+	case "flag":
+		return Flag, nil
+	case "reject":
+		return Reject, nil
+	default:
+		return Allow, fmt.Errorf("unknown filter action %q", s)
+	}
+}
+
+// Verdict is the decision of a filter.
+type Verdict struct {
+	Action  Action
+	Content string // rewritten content, for Rewrite and optionally Flag
+	Reason  string // shown to the author on Reject and to moderators on Flag
+}
+
+// Input is the content to check with its context.
+type Input struct {
+	Content   string
+	AuthorID  string
+	CommentID *uuid.UUID // set for edits
+}
+
+// Filter checks comment content.
+type Filter interface {
+	Check(ctx context.Context, in Input) (Verdict, error)
+}
+
+// Result is the outcome of a Chain.
+type Result struct {
+	Content string   // content after all rewrites
+	Flags   []string // reasons of the filters that flagged the content
+}
+
+// Flagged reports whether any filter flagged the content for moderation.
+func (r Result) Flagged() bool {
+	return len(r.Flags) > 0
+}
+
+// Chain runs filters in order.
+type Chain struct {
+	filters []Filter
+}
+
+// NewChain creates a new Chain of the given filters.
+func NewChain(filters ...Filter) *Chain {
+	return &Chain{filters: filters}
+}
+
+// Run checks the content with every filter.
+//
+// Rewrites are applied before the next filter runs. The first rejection stops
+// the chain with an error wrapping ErrRejected.
+func (c *Chain) Run(ctx context.Context, in Input) (Result, error) {
+	res := Result{Content: in.Content}
+
+	for _, f := range c.filters {
+		in.Content = res.Content
+
+		v, err := f.Check(ctx, in)
+		if err != nil {
+			return Result{}, err
+		}
+
+		switch v.Action {
+		case Rewrite:
+			res.Content = v.Content
+		case Flag:
+			res.Flags = append(res.Flags, v.Reason)
+			if v.Content != "" {
+				res.Content = v.Content
+			}
+		case Reject:
+			return Result{}, fmt.Errorf("%w: %s", ErrRejected, v.Reason)
+		}
+	}
+
+	return res, nil
+}
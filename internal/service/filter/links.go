@@ -0,0 +1,42 @@
+package filter
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// linkPattern matches URLs and bare www. hosts.
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>()]+`)
+
+// MaxLinks limits the number of links in the content.
+//
+// Rewrites drop the links past the limit.
+type MaxLinks struct {
+	max    int
+	action Action
+}
+
+// NewMaxLinks creates a new MaxLinks taking action on content with more than max links.
+func NewMaxLinks(max int, action Action) *MaxLinks {
+	return &MaxLinks{max: max, action: action}
+}
+
+// Check implements Filter.
+func (m *MaxLinks) Check(_ context.Context, in Input) (Verdict, error) {
+	links := linkPattern.FindAllStringIndex(in.Content, -1)
+	if len(links) <= m.max {
+		return Verdict{Action: Allow}, nil
+	}
+
+	if m.action == Rewrite {
+		// Cut the content at the first link past the limit and drop the rest of the links.
+		cut := links[m.max][0]
+		return Verdict{
+			Action:  Rewrite,
+			Content: in.Content[:cut] + linkPattern.ReplaceAllString(in.Content[cut:], ""),
+		}, nil
+	}
+
+	return Verdict{Action: m.action, Reason: fmt.Sprintf("content has more than %d links", m.max)}, nil
+}
@@ -0,0 +1,61 @@
+package filter
+
+import (
+	"context"
+	"regexp"
+)
+
+// Rule is a pattern and what to do with content matching it.
+type Rule struct {
+	Pattern     *regexp.Regexp
+	Action      Action
+	Reason      string
+	Replacement string // replaces every match, for Rewrite; may refer to groups as in regexp.Expand
+}
+
+// Regex checks the content against a set of rules in order.
+//
+// Rewrites are applied before the next rule is checked. The strictest
+// action of the other rules wins; flagged content keeps the rewrites.
+type Regex struct {
+	rules []Rule
+}
+
+// NewRegex creates a new Regex of the given rules.
+func NewRegex(rules ...Rule) *Regex {
+	return &Regex{rules: rules}
+}
+
+// Check implements Filter.
+func (r *Regex) Check(_ context.Context, in Input) (Verdict, error) {
+	content := in.Content
+	verdict := Verdict{Action: Allow}
+
+	for _, rule := range r.rules {
+		if !rule.Pattern.MatchString(content) {
+			continue
+		}
+
+		if rule.Action == Rewrite {
+			content = rule.Pattern.ReplaceAllString(content, rule.Replacement)
+			continue
+		}
+
+		if rule.Action > verdict.Action {
+			verdict = Verdict{Action: rule.Action, Reason: rule.Reason}
+		}
+	}
+
+	if content == in.Content {
+		return verdict, nil
+	}
+
+	switch verdict.Action {
+	case Allow:
+		return Verdict{Action: Rewrite, Content: content}, nil
+	case Flag:
+		verdict.Content = content
+	}
+
+	return verdict, nil
+}
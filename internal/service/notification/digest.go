@@ -0,0 +1,264 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/aliskhannn/comment-tree/internal/email"
+	"github.com/aliskhannn/comment-tree/internal/model"
+)
+
+//go:embed templates
+var templates embed.FS
+
+var (
+	textTemplate = texttemplate.Must(texttemplate.ParseFS(templates, "templates/digest.txt.tmpl"))
+	htmlTemplate = htmltemplate.Must(htmltemplate.ParseFS(templates, "templates/digest.html.tmpl"))
+)
+
+// UnsubscribePath is the path of the unsubscribe route, relative to the base URL.
+const UnsubscribePath = "/api/notifications/unsubscribe"
+
+// DigestRepository provides methods for emailing pending notifications.
+type DigestRepository interface {
+	ClaimDigests(ctx context.Context, limit int, lease time.Duration) ([]model.DigestRecipient, error)
+	GetDigest(ctx context.Context, d model.DigestRecipient, limit int) (model.Digest, error)
+	CompleteDigest(ctx context.Context, d model.DigestRecipient, until time.Time) error
+	RetryDigest(ctx context.Context, d model.DigestRecipient, retryAfter time.Duration) error
+}
+
+// Sender sends emails.
+type Sender interface {
+	Send(ctx context.Context, msg email.Message) error
+}
+
+// DigestConfig holds the email delivery settings.
+type DigestConfig struct {
+	From              mail.Address  // sender of the emails
+	BaseURL           string        // public URL of the API, for unsubscribe links
+	CommentURL        string        // link to a comment, with {id} and {thread} placeholders; empty for no links
+	UnsubscribeSecret string        // key unsubscribe links are signed with
+	BatchSize         int           // recipients claimed per poll
+	PollInterval      time.Duration // pause between polls without due recipients
+	Timeout           time.Duration // timeout of sending a single email
+	MaxItems          int           // notifications listed per email
+	RetryInterval     time.Duration // delay before retrying a failed email
+}
+
+// DigestWorker emails pending notifications to the users who turned emails
+// on, one email per user at a time: right away for instant delivery, or as
+// an hourly or daily digest.
+//
+// Several workers, also on different instances, can share the work.
+type DigestWorker struct {
+	repo   DigestRepository
+	sender Sender
+	cfg    DigestConfig
+}
+
+// NewDigestWorker creates a new DigestWorker.
+func NewDigestWorker(repo DigestRepository, sender Sender, cfg DigestConfig) *DigestWorker {
+	return &DigestWorker{repo: repo, sender: sender, cfg: cfg}
+}
+
+// Run emails pending notifications until ctx is done.
+func (w *DigestWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Keep draining without waiting while full batches are claimed.
+		n, err := w.processBatch(ctx)
+		if err != nil {
+			zlog.Logger.Error().Err(err).Msg("failed to process notification emails")
+		}
+		if err == nil && n == w.cfg.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// processBatch claims and emails a batch of due recipients. It returns the
+// number of claimed recipients.
+func (w *DigestWorker) processBatch(ctx context.Context) (int, error) {
+	// Leave enough time to email the whole batch before another worker may
+	// claim the same recipients again.
+	lease := time.Duration(w.cfg.BatchSize)*w.cfg.Timeout + time.Minute
+
+	recipients, err := w.repo.ClaimDigests(ctx, w.cfg.BatchSize, lease)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, d := range recipients {
+		w.deliver(ctx, d)
+	}
+
+	return len(recipients), nil
+}
+
+// deliver emails the pending notifications of a recipient and records the result.
+func (w *DigestWorker) deliver(ctx context.Context, d model.DigestRecipient) {
+	log := zlog.Logger.With().Str("tenant", d.TenantID).Str("user", d.UserID).Logger()
+
+	digest, err := w.repo.GetDigest(ctx, d, w.cfg.MaxItems)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get notification digest")
+		w.retry(ctx, d, w.cfg.RetryInterval)
+		return
+	}
+	if len(digest.Items) == 0 {
+		// The notifications were read or hidden since the recipient was claimed.
+		w.retry(ctx, d, 0)
+		return
+	}
+
+	msg, err := w.compose(d, digest)
+	if err == nil {
+		sendCtx, cancel := context.WithTimeout(ctx, w.cfg.Timeout)
+		err = w.sender.Send(sendCtx, msg)
+		cancel()
+	}
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to send notification email")
+		w.retry(ctx, d, w.cfg.RetryInterval)
+		return
+	}
+
+	if err := w.repo.CompleteDigest(ctx, d, digest.Until); err != nil {
+		log.Error().Err(err).Msg("failed to complete notification digest")
+	}
+}
+
+// retry releases a recipient to be claimed again after retryAfter.
+func (w *DigestWorker) retry(ctx context.Context, d model.DigestRecipient, retryAfter time.Duration) {
+	if err := w.repo.RetryDigest(ctx, d, retryAfter); err != nil {
+		zlog.Logger.Error().Err(err).Str("tenant", d.TenantID).Str("user", d.UserID).Msg("failed to release notification digest")
+	}
+}
+
+// digestData is the data of the email templates.
+type digestData struct {
+	Subject        string
+	Name           string
+	Intro          string
+	Items          []digestItem
+	More           int // pending notifications not listed
+	Reason         string
+	UnsubscribeURL string
+}
+
+// digestItem is a notification listed in an email.
+type digestItem struct {
+	Summary string
+	Excerpt string
+	URL     string
+}
+
+// compose renders the email of a digest.
+func (w *DigestWorker) compose(d model.DigestRecipient, digest model.Digest) (email.Message, error) {
+	data := digestData{
+		Name:           d.Name,
+		More:           digest.Total - len(digest.Items),
+		UnsubscribeURL: strings.TrimRight(w.cfg.BaseURL, "/") + UnsubscribePath + "?token=" + SignUnsubscribe(w.cfg.UnsubscribeSecret, d.TenantID, d.UserID),
+	}
+	if data.Name == "" {
+		data.Name = "there"
+	}
+
+	for _, n := range digest.Items {
+		data.Items = append(data.Items, digestItem{
+			Summary: summary(n),
+			Excerpt: n.Excerpt,
+			URL:     w.commentURL(n),
+		})
+	}
+
+	switch {
+	case d.Delivery == model.DeliveryInstant && digest.Total == 1:
+		data.Subject = data.Items[0].Summary
+		data.Intro = "You have a new notification:"
+	case d.Delivery == model.DeliveryInstant:
+		data.Subject = strconv.Itoa(digest.Total) + " new notifications"
+		data.Intro = "You have " + data.Subject + ":"
+	default:
+		data.Subject = fmt.Sprintf("Your %s digest: %d new notification", d.Delivery, digest.Total)
+		if digest.Total > 1 {
+			data.Subject += "s"
+		}
+		data.Intro = "Here is what happened since your last digest:"
+	}
+
+	switch d.Delivery {
+	case model.DeliveryInstant:
+		data.Reason = "you turned on instant notification emails"
+	default:
+		data.Reason = "you turned on " + d.Delivery + " notification digests"
+	}
+
+	var text, html bytes.Buffer
+	if err := textTemplate.Execute(&text, data); err != nil {
+		return email.Message{}, fmt.Errorf("failed to render text email: %w", err)
+	}
+	if err := htmlTemplate.Execute(&html, data); err != nil {
+		return email.Message{}, fmt.Errorf("failed to render html email: %w", err)
+	}
+
+	return email.Message{
+		From:    w.cfg.From,
+		To:      mail.Address{Name: d.Name, Address: d.Email},
+		Subject: data.Subject,
+		Text:    text.String(),
+		HTML:    html.String(),
+		Headers: map[string]string{
+			// One-click unsubscribe as of RFC 8058.
+			"List-Unsubscribe":      "<" + data.UnsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	}, nil
+}
+
+// summary describes a notification in one line.
+func summary(n model.Notification) string {
+	actor := "Someone"
+	if n.Actor != nil && n.Actor.Name != "" {
+		actor = n.Actor.Name
+	} else if n.Actor != nil && n.Actor.Username != "" {
+		actor = "@" + n.Actor.Username
+	}
+
+	if n.Type == model.NotificationReply {
+		return actor + " replied to your comment"
+	}
+
+	return actor + " mentioned you"
+}
+
+// commentURL returns the link to the comment of a notification, if configured.
+func (w *DigestWorker) commentURL(n model.Notification) string {
+	if w.cfg.CommentURL == "" {
+		return ""
+	}
+
+	return strings.NewReplacer(
+		"{id}", n.CommentID.String(),
+		"{thread}", url.QueryEscape(n.ThreadKey),
+	).Replace(w.cfg.CommentURL)
+}
@@ -0,0 +1,272 @@
+package notification
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aliskhannn/comment-tree/internal/email"
+	"github.com/aliskhannn/comment-tree/internal/model"
+)
+
+// envelope is an email received by the fake SMTP server.
+type envelope struct {
+	From string
+	To   []string
+	Data string
+}
+
+// fakeSMTP accepts SMTP sessions on a local listener and reports every
+// received email on the returned channel.
+func fakeSMTP(t *testing.T) (addr *net.TCPAddr, received <-chan envelope) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	ch := make(chan envelope, 1)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, ch)
+		}
+	}()
+
+	return ln.Addr().(*net.TCPAddr), ch
+}
+
+// serveSMTP speaks just enough SMTP for net/smtp to deliver an email.
+func serveSMTP(conn net.Conn, received chan<- envelope) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	tp := textproto.NewConn(conn)
+	_ = tp.PrintfLine("220 localhost ESMTP")
+
+	var env envelope
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(cmd) {
+		case "EHLO", "HELO":
+			_ = tp.PrintfLine("250 localhost")
+		case "MAIL":
+			env = envelope{From: strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")}
+			_ = tp.PrintfLine("250 OK")
+		case "RCPT":
+			env.To = append(env.To, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			_ = tp.PrintfLine("250 OK")
+		case "DATA":
+			_ = tp.PrintfLine("354 Go ahead")
+			data, err := io.ReadAll(tp.DotReader())
+			if err != nil {
+				return
+			}
+			env.Data = string(data)
+			_ = tp.PrintfLine("250 OK")
+			received <- env
+		case "QUIT":
+			_ = tp.PrintfLine("221 Bye")
+			return
+		default:
+			_ = tp.PrintfLine("502 Not implemented")
+		}
+	}
+}
+
+// digestRepo is a DigestRepository that serves a single digest.
+type digestRepo struct {
+	digest    model.Digest
+	completed chan time.Time
+	retried   chan time.Duration
+}
+
+func (r *digestRepo) ClaimDigests(context.Context, int, time.Duration) ([]model.DigestRecipient, error) {
+	return nil, nil
+}
+
+func (r *digestRepo) GetDigest(context.Context, model.DigestRecipient, int) (model.Digest, error) {
+	return r.digest, nil
+}
+
+func (r *digestRepo) CompleteDigest(_ context.Context, _ model.DigestRecipient, until time.Time) error {
+	r.completed <- until
+	return nil
+}
+
+func (r *digestRepo) RetryDigest(_ context.Context, _ model.DigestRecipient, retryAfter time.Duration) error {
+	r.retried <- retryAfter
+	return nil
+}
+
+func TestDigestWorkerSendsEmail(t *testing.T) {
+	addr, received := fakeSMTP(t)
+
+	sender, err := email.NewSMTPSender(email.SMTPConfig{
+		Host:    addr.IP.String(),
+		Port:    addr.Port,
+		TLS:     email.TLSNone,
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	until := time.Date(2025, 10, 16, 12, 0, 0, 0, time.UTC)
+	repo := &digestRepo{
+		digest: model.Digest{
+			Items: []model.Notification{{
+				ID:        uuid.New(),
+				Type:      model.NotificationReply,
+				CommentID: uuid.New(),
+				ThreadKey: "post-1",
+				Actor:     &model.Author{Name: "Alice"},
+				Excerpt:   "Thanks!",
+				CreatedAt: until,
+			}},
+			Total: 1,
+			Until: until,
+		},
+		completed: make(chan time.Time, 1),
+		retried:   make(chan time.Duration, 1),
+	}
+
+	const secret = "unsubscribe-secret"
+	w := NewDigestWorker(repo, sender, DigestConfig{
+		From:              mail.Address{Name: "Comments", Address: "noreply@example.com"},
+		BaseURL:           "https://api.example.com/",
+		UnsubscribeSecret: secret,
+		Timeout:           5 * time.Second,
+		RetryInterval:     time.Minute,
+	})
+
+	d := model.DigestRecipient{
+		TenantID: "tenant-1",
+		UserID:   "user-1",
+		Email:    "bob@example.com",
+		Name:     "Bob",
+		Delivery: model.DeliveryInstant,
+	}
+	w.deliver(context.Background(), d)
+
+	select {
+	case got := <-repo.completed:
+		if !got.Equal(until) {
+			t.Errorf("completed until %v, want %v", got, until)
+		}
+	case retryAfter := <-repo.retried:
+		t.Fatalf("digest retried after %v, want it completed", retryAfter)
+	}
+
+	var env envelope
+	select {
+	case env = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no email received")
+	}
+
+	if env.From != "noreply@example.com" {
+		t.Errorf("MAIL FROM: got %q, want %q", env.From, "noreply@example.com")
+	}
+	if len(env.To) != 1 || env.To[0] != "bob@example.com" {
+		t.Errorf("RCPT TO: got %q, want [bob@example.com]", env.To)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(env.Data))
+	if err != nil {
+		t.Fatalf("failed to parse email: %v", err)
+	}
+
+	want := map[string]string{
+		"From":                  `"Comments" <noreply@example.com>`,
+		"To":                    `"Bob" <bob@example.com>`,
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		"MIME-Version":          "1.0",
+	}
+	for key, value := range want {
+		if got := msg.Header.Get(key); got != value {
+			t.Errorf("header %s: got %q, want %q", key, got, value)
+		}
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("failed to decode subject: %v", err)
+	}
+	if subject != "Alice replied to your comment" {
+		t.Errorf("Subject: got %q, want %q", subject, "Alice replied to your comment")
+	}
+	if id := msg.Header.Get("Message-ID"); !strings.HasSuffix(id, "@example.com>") {
+		t.Errorf("Message-ID: got %q, want one in the sender's domain", id)
+	}
+
+	// The header and the text body carry the same signed unsubscribe link.
+	link := strings.TrimSuffix(strings.TrimPrefix(msg.Header.Get("List-Unsubscribe"), "<"), ">")
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("List-Unsubscribe: %v", err)
+	}
+	if u.Scheme != "https" || u.Host != "api.example.com" || u.Path != UnsubscribePath {
+		t.Errorf("unsubscribe link: got %q, want https://api.example.com%s", link, UnsubscribePath)
+	}
+	tenantID, userID, err := VerifyUnsubscribe(secret, u.Query().Get("token"))
+	if err != nil {
+		t.Fatalf("unsubscribe token: %v", err)
+	}
+	if tenantID != d.TenantID || userID != d.UserID {
+		t.Errorf("unsubscribe token: got %s/%s, want %s/%s", tenantID, userID, d.TenantID, d.UserID)
+	}
+
+	text := textPart(t, msg)
+	if !strings.Contains(text, "Unsubscribe: "+link) {
+		t.Errorf("text body does not contain the unsubscribe link %q:\n%s", link, text)
+	}
+	if !strings.Contains(text, "Alice replied to your comment") {
+		t.Errorf("text body does not list the notification:\n%s", text)
+	}
+}
+
+// textPart returns the decoded text/plain part of a multipart email.
+func textPart(t *testing.T, msg *mail.Message) string {
+	t.Helper()
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type: got %q, want multipart/alternative", msg.Header.Get("Content-Type"))
+	}
+
+	// NextPart decodes quoted-printable parts.
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			t.Fatalf("no text/plain part: %v", err)
+		}
+		if strings.HasPrefix(p.Header.Get("Content-Type"), "text/plain") {
+			b, err := io.ReadAll(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return string(b)
+		}
+	}
+}
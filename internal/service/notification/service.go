@@ -0,0 +1,176 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/aliskhannn/comment-tree/internal/auth"
+	"github.com/aliskhannn/comment-tree/internal/model"
+)
+
+// maxMentions is the number of distinct users a single comment can notify by mentioning them.
+const maxMentions = 20
+
+var (
+	// ErrUnauthenticated is returned when an operation requires an authenticated user.
+	ErrUnauthenticated = errors.New("authentication required")
+	// ErrInvalidDelivery is returned when an email delivery mode is unknown.
+	ErrInvalidDelivery = errors.New("invalid delivery, must be instant, hourly, daily or off")
+	// ErrNoEmail is returned when emails are turned on for a user whose credentials carry no email address.
+	ErrNoEmail = errors.New("credentials carry no email address")
+)
+
+var (
+	// mentionPattern matches @username mentions that do not follow a word
+	// character, so e-mail addresses are not taken for mentions.
+	mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([A-Za-z0-9_](?:[A-Za-z0-9_.-]{0,62}[A-Za-z0-9_])?)`)
+	// codePattern matches Markdown code blocks and spans, in which mentions are ignored.
+	codePattern = regexp.MustCompile("(?s)```.*?(?:```|$)|`[^`\n]*`")
+)
+
+// Repository provides methods for interacting with the mention and notification tables.
+type Repository interface {
+	SaveMentions(ctx context.Context, tenantID string, c model.Comment, usernames []string) error
+	NotifyReply(ctx context.Context, tenantID string, c model.Comment) error
+	GetNotifications(ctx context.Context, userID string, q model.NotificationQuery) (model.NotificationPage, error)
+	CountUnread(ctx context.Context, userID string) (int, error)
+	MarkRead(ctx context.Context, userID string, ids []uuid.UUID) error
+	GetPreferences(ctx context.Context, userID string) (model.NotificationPreferences, bool, error)
+	SavePreferences(ctx context.Context, user model.User, delivery string) (model.NotificationPreferences, error)
+	Unsubscribe(ctx context.Context, tenantID, userID string) error
+}
+
+// Service records mentions and notifies users about comments that concern them.
+type Service struct {
+	repo              Repository
+	unsubscribeSecret string
+}
+
+// NewService creates a new Service. Unsubscribe links are signed with
+// unsubscribeSecret; an empty secret rejects every unsubscribe token.
+func NewService(repo Repository, unsubscribeSecret string) *Service {
+	return &Service{repo: repo, unsubscribeSecret: unsubscribeSecret}
+}
+
+// Publish records the mentions of a created or updated comment and notifies
+// the mentioned users and, for new replies, the author of the parent.
+//
+// It consumes the outbox, so only approved comments notify anyone, and a
+// comment that is approved later notifies once it is. Publishing the same
+// event again notifies no one twice.
+func (s *Service) Publish(ctx context.Context, e model.Event) error {
+	switch e.Type {
+	case model.EventCommentCreated:
+		if err := s.repo.NotifyReply(ctx, e.TenantID, e.Comment); err != nil {
+			return err
+		}
+	case model.EventCommentUpdated:
+	default:
+		return nil
+	}
+
+	return s.repo.SaveMentions(ctx, e.TenantID, e.Comment, ParseMentions(e.Comment.Content))
+}
+
+// ParseMentions returns the distinct usernames mentioned as @username in
+// content, in order of appearance, ignoring mentions in code.
+func ParseMentions(content string) []string {
+	content = codePattern.ReplaceAllString(content, " ")
+
+	usernames := []string{}
+	seen := make(map[string]struct{})
+	for _, m := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		key := strings.ToLower(m[1])
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		usernames = append(usernames, m[1])
+		if len(usernames) == maxMentions {
+			break
+		}
+	}
+
+	return usernames
+}
+
+// GetNotifications returns a page of the notifications of the user in ctx, newest first.
+func (s *Service) GetNotifications(ctx context.Context, q model.NotificationQuery) (model.NotificationPage, error) {
+	user, ok := auth.UserFromContext(ctx)
+	if !ok {
+		return model.NotificationPage{}, ErrUnauthenticated
+	}
+
+	return s.repo.GetNotifications(ctx, user.ID, q)
+}
+
+// MarkRead marks notifications of the user in ctx as read, all of them if ids
+// is nil, and returns the number of unread ones left.
+func (s *Service) MarkRead(ctx context.Context, ids []uuid.UUID) (int, error) {
+	user, ok := auth.UserFromContext(ctx)
+	if !ok {
+		return 0, ErrUnauthenticated
+	}
+
+	if err := s.repo.MarkRead(ctx, user.ID, ids); err != nil {
+		return 0, err
+	}
+
+	return s.repo.CountUnread(ctx, user.ID)
+}
+
+// GetPreferences returns the email preferences of the user in ctx. Emails are
+// off until the user turns them on.
+func (s *Service) GetPreferences(ctx context.Context) (model.NotificationPreferences, error) {
+	user, ok := auth.UserFromContext(ctx)
+	if !ok {
+		return model.NotificationPreferences{}, ErrUnauthenticated
+	}
+
+	p, ok, err := s.repo.GetPreferences(ctx, user.ID)
+	if err != nil {
+		return model.NotificationPreferences{}, err
+	}
+	if !ok {
+		return model.NotificationPreferences{Delivery: model.DeliveryOff, Email: user.Email}, nil
+	}
+
+	return p, nil
+}
+
+// SetDelivery sets the email delivery mode of the user in ctx. Emails go to
+// the address in the user's credentials at the time.
+func (s *Service) SetDelivery(ctx context.Context, delivery string) (model.NotificationPreferences, error) {
+	user, ok := auth.UserFromContext(ctx)
+	if !ok {
+		return model.NotificationPreferences{}, ErrUnauthenticated
+	}
+
+	switch delivery {
+	case model.DeliveryInstant, model.DeliveryHourly, model.DeliveryDaily:
+		if user.Email == "" {
+			return model.NotificationPreferences{}, ErrNoEmail
+		}
+	case model.DeliveryOff:
+	default:
+		return model.NotificationPreferences{}, ErrInvalidDelivery
+	}
+
+	return s.repo.SavePreferences(ctx, user, delivery)
+}
+
+// Unsubscribe turns off the emails of the user named by an unsubscribe token.
+// It needs no credentials, as the token is signed.
+func (s *Service) Unsubscribe(ctx context.Context, token string) error {
+	tenantID, userID, err := VerifyUnsubscribe(s.unsubscribeSecret, token)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.Unsubscribe(ctx, tenantID, userID)
+}
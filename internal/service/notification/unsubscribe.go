@@ -0,0 +1,56 @@
+package notification
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// ErrInvalidUnsubscribeToken is returned when an unsubscribe token is malformed or not signed with the secret.
+var ErrInvalidUnsubscribeToken = errors.New("invalid unsubscribe token")
+
+// SignUnsubscribe returns the token of the unsubscribe link of a user of a
+// tenant: the base64url-encoded tenant and user IDs and their HMAC-SHA256
+// with secret, separated by dots. Tokens do not expire.
+func SignUnsubscribe(secret, tenantID, userID string) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(tenantID)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(userID))
+
+	return payload + "." + base64.RawURLEncoding.EncodeToString(unsubscribeMAC(secret, payload))
+}
+
+// VerifyUnsubscribe checks a token created by SignUnsubscribe and returns the
+// tenant and user IDs it names.
+func VerifyUnsubscribe(secret, token string) (tenantID, userID string, err error) {
+	parts := strings.Split(token, ".")
+	if secret == "" || len(parts) != 3 {
+		return "", "", ErrInvalidUnsubscribeToken
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(mac, unsubscribeMAC(secret, parts[0]+"."+parts[1])) {
+		return "", "", ErrInvalidUnsubscribeToken
+	}
+
+	tenant, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", "", ErrInvalidUnsubscribeToken
+	}
+	user, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || len(user) == 0 {
+		return "", "", ErrInvalidUnsubscribeToken
+	}
+
+	return string(tenant), string(user), nil
+}
+
+// unsubscribeMAC returns the HMAC-SHA256 of an unsubscribe token payload.
+func unsubscribeMAC(secret, payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("unsubscribe:"))
+	mac.Write([]byte(payload))
+
+	return mac.Sum(nil)
+}
@@ -0,0 +1,177 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/aliskhannn/comment-tree/internal/model"
+)
+
+// Repository provides methods for draining the outbox.
+type Repository interface {
+	ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]model.OutboxEvent, error)
+	DeleteEvents(ctx context.Context, eventIDs []uuid.UUID) error
+	FailEvent(ctx context.Context, eventID uuid.UUID, delivered []string, lastErr string, retryAfter time.Duration) error
+	DeferEvents(ctx context.Context, eventIDs []uuid.UUID, delay time.Duration) error
+}
+
+// Sink receives the events relayed from the outbox.
+//
+// Publish may be called more than once for the same event, for example after
+// the relay crashed.
+type Sink interface {
+	Publish(ctx context.Context, e model.Event) error
+}
+
+// NamedSink is a sink with the name the events it accepted are recorded
+// under, so a retry after another sink failed skips it. Names must stay the
+// same across restarts.
+type NamedSink struct {
+	Name string
+	Sink
+}
+
+// RelayConfig holds the relay settings.
+type RelayConfig struct {
+	BatchSize    int           // events claimed per poll
+	PollInterval time.Duration // pause between polls of an empty outbox
+	Lease        time.Duration // time before events claimed by a stalled relay are claimed again
+	MaxAttempts  int           // attempts before an event is dead
+	BaseBackoff  time.Duration // delay after the first failed attempt, doubled after every further one
+	MaxBackoff   time.Duration // upper bound of the delay
+}
+
+// Relay publishes the events recorded in the outbox to its sinks.
+//
+// An event is removed from the outbox only after every sink accepted it,
+// which makes delivery at-least-once. Failed events are retried with
+// exponential backoff, only with the sinks that did not accept them yet, and
+// are moved to the dead-letter state after MaxAttempts. Several relays, also
+// on different instances, can drain the same outbox.
+type Relay struct {
+	repo  Repository
+	sinks []NamedSink
+	cfg   RelayConfig
+}
+
+// NewRelay creates a new Relay.
+func NewRelay(repo Repository, cfg RelayConfig, sinks ...NamedSink) *Relay {
+	return &Relay{
+		repo:  repo,
+		sinks: sinks,
+		cfg:   cfg,
+	}
+}
+
+// Run relays events until ctx is done.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Keep draining without waiting while full batches are claimed.
+		n, err := r.relayBatch(ctx)
+		if err != nil {
+			zlog.Logger.Error().Err(err).Msg("failed to relay outbox events")
+		}
+		if err == nil && n == r.cfg.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// relayBatch claims a batch of events and publishes them in order. It returns
+// the number of claimed events.
+//
+// The batch stops at the first event a sink rejects. The rest of the batch is
+// deferred along with it, so it is not published ahead of the failed event
+// unless that one is dead.
+func (r *Relay) relayBatch(ctx context.Context) (int, error) {
+	events, err := r.repo.ClaimEvents(ctx, r.cfg.BatchSize, r.cfg.Lease)
+	if err != nil {
+		return 0, err
+	}
+
+	published := make([]uuid.UUID, 0, len(events))
+	for i, e := range events {
+		delivered, err := r.publish(ctx, e)
+		if err == nil {
+			published = append(published, e.EventID)
+			continue
+		}
+		if ctx.Err() != nil {
+			// Shutting down; the lease releases the rest.
+			break
+		}
+
+		var retryAfter time.Duration
+		attempts := e.Attempts + 1
+		if attempts < r.cfg.MaxAttempts {
+			retryAfter = r.backoff(attempts)
+		}
+		zlog.Logger.Error().Err(err).Str("event_id", e.EventID.String()).Int("attempt", attempts).
+			Bool("dead", retryAfter <= 0).Msg("failed to publish outbox event")
+
+		if err := r.repo.FailEvent(ctx, e.EventID, delivered, err.Error(), retryAfter); err != nil {
+			zlog.Logger.Error().Err(err).Str("event_id", e.EventID.String()).Msg("failed to record outbox event failure")
+		}
+
+		rest := make([]uuid.UUID, 0, len(events)-i-1)
+		for _, later := range events[i+1:] {
+			rest = append(rest, later.EventID)
+		}
+		if err := r.repo.DeferEvents(ctx, rest, retryAfter); err != nil {
+			zlog.Logger.Error().Err(err).Msg("failed to defer outbox events")
+		}
+		break
+	}
+
+	if err := r.repo.DeleteEvents(ctx, published); err != nil {
+		return len(events), err
+	}
+
+	return len(events), nil
+}
+
+// publish hands an event to every sink that has not accepted it yet. It
+// returns the names of the sinks that accepted the event, also on failure.
+func (r *Relay) publish(ctx context.Context, e model.OutboxEvent) ([]string, error) {
+	delivered := slices.Clone(e.Delivered)
+
+	var errs []error
+	for _, s := range r.sinks {
+		if slices.Contains(delivered, s.Name) {
+			continue
+		}
+
+		if err := s.Publish(ctx, e.Event); err != nil {
+			errs = append(errs, fmt.Errorf("sink %s: %w", s.Name, err))
+			continue
+		}
+		delivered = append(delivered, s.Name)
+	}
+
+	return delivered, errors.Join(errs...)
+}
+
+// backoff returns the delay after the given number of failed attempts.
+func (r *Relay) backoff(attempts int) time.Duration {
+	delay := r.cfg.BaseBackoff
+	for i := 1; i < attempts && delay < r.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+
+	return min(delay, r.cfg.MaxBackoff)
+}
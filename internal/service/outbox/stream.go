@@ -0,0 +1,56 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/wb-go/wbf/redis"
+
+	"github.com/aliskhannn/comment-tree/internal/model"
+)
+
+// StreamSink appends events to a Redis stream for external consumers, such as
+// consumer groups of other services.
+//
+// Entries carry the fields event_id, type, tenant and payload (the JSON event).
+type StreamSink struct {
+	rdb    *redis.Client
+	stream string
+	maxLen int64
+}
+
+// NewStreamSink creates a new StreamSink keeping about maxLen entries in stream.
+func NewStreamSink(rdb *redis.Client, stream string, maxLen int64) *StreamSink {
+	return &StreamSink{
+		rdb:    rdb,
+		stream: stream,
+		maxLen: maxLen,
+	}
+}
+
+// Publish appends the event to the stream.
+func (s *StreamSink) Publish(ctx context.Context, e model.Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	err = s.rdb.XAdd(ctx, &goredis.XAddArgs{
+		Stream: s.stream,
+		MaxLen: s.maxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"event_id": e.EventID.String(),
+			"type":     e.Type,
+			"tenant":   e.TenantID,
+			"payload":  payload,
+		},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to append event to stream: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package reaction
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/aliskhannn/comment-tree/internal/auth"
+	"github.com/aliskhannn/comment-tree/internal/model"
+)
+
+// Repository provides methods for interacting with the comment_reactions table.
+type Repository interface {
+	AddReaction(ctx context.Context, commentID uuid.UUID, userID, emoji string) error
+	RemoveReaction(ctx context.Context, commentID uuid.UUID, userID, emoji string) error
+	GetReactionCounts(ctx context.Context, commentIDs []uuid.UUID) (map[uuid.UUID]map[string]int, error)
+	GetUserReactions(ctx context.Context, commentIDs []uuid.UUID, userID string) (map[uuid.UUID][]string, error)
+}
+
+var (
+	// ErrUnauthenticated is returned when an operation requires an authenticated user.
+	ErrUnauthenticated = errors.New("authentication required")
+	// ErrUnknownEmoji is returned when an emoji is not in the allowlist.
+	ErrUnknownEmoji = errors.New("emoji is not allowed")
+)
+
+// Service manages emoji reactions on comments.
+type Service struct {
+	repo    Repository
+	allowed []string
+}
+
+// NewService creates a new Service accepting the given emojis.
+func NewService(repo Repository, allowed []string) *Service {
+	return &Service{repo: repo, allowed: allowed}
+}
+
+// React adds the reaction of the user in ctx with an emoji to a comment and
+// returns the reactions of the comment.
+//
+// Each user reacts at most once per emoji; reacting again is a no-op.
+func (s *Service) React(ctx context.Context, commentID uuid.UUID, emoji string) ([]model.Reaction, error) {
+	user, err := s.check(ctx, emoji)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.AddReaction(ctx, commentID, user.ID, emoji); err != nil {
+		return nil, err
+	}
+
+	return s.reactions(ctx, commentID)
+}
+
+// Unreact removes the reaction of the user in ctx with an emoji from a comment
+// and returns the reactions of the comment.
+func (s *Service) Unreact(ctx context.Context, commentID uuid.UUID, emoji string) ([]model.Reaction, error) {
+	user, err := s.check(ctx, emoji)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.RemoveReaction(ctx, commentID, user.ID, emoji); err != nil {
+		return nil, err
+	}
+
+	return s.reactions(ctx, commentID)
+}
+
+// Attach sets the aggregated reactions of the given comments, flagging the
+// ones of the user in ctx, if any.
+func (s *Service) Attach(ctx context.Context, comments ...*model.Comment) error {
+	if len(comments) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, len(comments))
+	for i, c := range comments {
+		ids[i] = c.ID
+	}
+
+	counts, err := s.repo.GetReactionCounts(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	var own map[uuid.UUID][]string
+	if user, ok := auth.UserFromContext(ctx); ok {
+		if own, err = s.repo.GetUserReactions(ctx, ids, user.ID); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range comments {
+		c.Reactions = s.aggregate(counts[c.ID], own[c.ID])
+	}
+
+	return nil
+}
+
+// reactions returns the aggregated reactions of a single comment.
+func (s *Service) reactions(ctx context.Context, commentID uuid.UUID) ([]model.Reaction, error) {
+	c := &model.Comment{ID: commentID}
+	if err := s.Attach(ctx, c); err != nil {
+		return nil, err
+	}
+
+	return c.Reactions, nil
+}
+
+// aggregate converts the counts of a comment into reactions ordered as in
+// the allowlist. Emojis no longer allowed follow in lexical order.
+func (s *Service) aggregate(counts map[string]int, own []string) []model.Reaction {
+	reactions := make([]model.Reaction, 0, len(counts))
+	for emoji, n := range counts {
+		reactions = append(reactions, model.Reaction{
+			Emoji:   emoji,
+			Count:   n,
+			Reacted: slices.Contains(own, emoji),
+		})
+	}
+
+	slices.SortFunc(reactions, func(a, b model.Reaction) int {
+		ia, ib := s.rank(a.Emoji), s.rank(b.Emoji)
+		if ia != ib {
+			return ia - ib
+		}
+		return strings.Compare(a.Emoji, b.Emoji)
+	})
+
+	return reactions
+}
+
+// rank returns the position of an emoji in the allowlist, or its length if absent.
+func (s *Service) rank(emoji string) int {
+	if i := slices.Index(s.allowed, emoji); i >= 0 {
+		return i
+	}
+	return len(s.allowed)
+}
+
+// check returns the user in ctx after checking the emoji against the allowlist.
+func (s *Service) check(ctx context.Context, emoji string) (model.User, error) {
+	user, ok := auth.UserFromContext(ctx)
+	if !ok {
+		return model.User{}, ErrUnauthenticated
+	}
+
+	if !slices.Contains(s.allowed, emoji) {
+		return model.User{}, ErrUnknownEmoji
+	}
+
+	return user, nil
+}
@@ -0,0 +1,178 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aliskhannn/comment-tree/internal/model"
+)
+
+// Repository provides methods for interacting with the webhook tables.
+type Repository interface {
+	CreateWebhook(ctx context.Context, w *model.Webhook) (model.Webhook, error)
+	GetWebhooks(ctx context.Context) ([]model.Webhook, error)
+	GetWebhook(ctx context.Context, id uuid.UUID) (model.Webhook, error)
+	UpdateWebhook(ctx context.Context, w *model.Webhook) (model.Webhook, error)
+	DeleteWebhook(ctx context.Context, id uuid.UUID) error
+	EnqueueDeliveries(ctx context.Context, tenantID string, eventID uuid.UUID, eventType string, payload []byte) (int64, error)
+	GetDeadDeliveries(ctx context.Context, limit int) ([]model.WebhookDelivery, error)
+	RetryDelivery(ctx context.Context, id uuid.UUID) error
+}
+
+var (
+	// ErrInvalidURL is returned when a webhook URL is not an absolute HTTP(S) URL.
+	ErrInvalidURL = errors.New("webhook url must be an absolute http or https url")
+	// ErrUnknownEvent is returned when a webhook subscribes to an unknown event type.
+	ErrUnknownEvent = errors.New("unknown event type")
+)
+
+// eventTypes are the event types webhooks can subscribe to.
+var eventTypes = []string{
+	model.EventCommentCreated,
+	model.EventCommentUpdated,
+	model.EventCommentDeleted,
+}
+
+// Payload is the body POSTed to webhooks.
+type Payload struct {
+	ID        uuid.UUID     `json:"id"` // unique per event, shared by all deliveries and redeliveries of it
+	Type      string        `json:"type"`
+	Tenant    string        `json:"tenant"`
+	CreatedAt time.Time     `json:"created_at"`
+	Data      model.Comment `json:"data"`
+}
+
+// Service manages webhook subscriptions and queues deliveries.
+type Service struct {
+	repo         Repository
+	allowPrivate bool
+}
+
+// NewService creates a new Service. Unless allowPrivate is set, webhook URLs
+// may not name private or reserved addresses.
+func NewService(repo Repository, allowPrivate bool) *Service {
+	return &Service{repo: repo, allowPrivate: allowPrivate}
+}
+
+// CreateWebhook creates a new webhook subscription.
+//
+// A signing secret is generated unless one is given. The returned webhook is
+// the only place the secret is exposed.
+func (s *Service) CreateWebhook(ctx context.Context, w *model.Webhook) (model.Webhook, error) {
+	if err := s.validate(w); err != nil {
+		return model.Webhook{}, err
+	}
+
+	if w.Secret == "" {
+		secret, err := generateSecret()
+		if err != nil {
+			return model.Webhook{}, err
+		}
+		w.Secret = secret
+	}
+
+	res, err := s.repo.CreateWebhook(ctx, w)
+	if err != nil {
+		return model.Webhook{}, err
+	}
+	res.Secret = w.Secret
+
+	return res, nil
+}
+
+// GetWebhooks returns all webhook subscriptions.
+func (s *Service) GetWebhooks(ctx context.Context) ([]model.Webhook, error) {
+	return s.repo.GetWebhooks(ctx)
+}
+
+// GetWebhook returns the webhook subscription with the given ID.
+func (s *Service) GetWebhook(ctx context.Context, id uuid.UUID) (model.Webhook, error) {
+	return s.repo.GetWebhook(ctx, id)
+}
+
+// UpdateWebhook replaces the URL, events and active flag of a webhook
+// subscription. The secret is kept.
+func (s *Service) UpdateWebhook(ctx context.Context, w *model.Webhook) (model.Webhook, error) {
+	if err := s.validate(w); err != nil {
+		return model.Webhook{}, err
+	}
+
+	return s.repo.UpdateWebhook(ctx, w)
+}
+
+// DeleteWebhook deletes a webhook subscription and its pending deliveries.
+func (s *Service) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	return s.repo.DeleteWebhook(ctx, id)
+}
+
+// GetDeadDeliveries returns the most recent deliveries that were given up on.
+func (s *Service) GetDeadDeliveries(ctx context.Context, limit int) ([]model.WebhookDelivery, error) {
+	return s.repo.GetDeadDeliveries(ctx, limit)
+}
+
+// RetryDelivery queues a dead delivery again.
+func (s *Service) RetryDelivery(ctx context.Context, id uuid.UUID) error {
+	return s.repo.RetryDelivery(ctx, id)
+}
+
+// Publish queues deliveries of a comment event to the subscribed webhooks of its tenant.
+//
+// Publishing the same event again queues no further deliveries.
+func (s *Service) Publish(ctx context.Context, e model.Event) error {
+	data, err := json.Marshal(Payload{
+		ID:        e.EventID,
+		Type:      e.Type,
+		Tenant:    e.TenantID,
+		CreatedAt: e.CreatedAt,
+		Data:      e.Comment,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	if _, err := s.repo.EnqueueDeliveries(ctx, e.TenantID, e.EventID, e.Type, data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validate checks the URL and event types of a webhook.
+func (s *Service) validate(w *model.Webhook) error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidURL
+	}
+	if !s.allowPrivate {
+		if err := checkHost(u.Hostname()); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range w.Events {
+		if !slices.Contains(eventTypes, e) {
+			return fmt.Errorf("%w: %s", ErrUnknownEvent, e)
+		}
+	}
+
+	return nil
+}
+
+// generateSecret returns a random signing secret.
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+
+	return "whsec_" + hex.EncodeToString(b), nil
+}
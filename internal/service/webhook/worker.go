@@ -0,0 +1,210 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wb-go/wbf/zlog"
+
+	"github.com/aliskhannn/comment-tree/internal/model"
+)
+
+// Headers of webhook requests.
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// maxErrorBody is the number of response body bytes kept as the error of a failed attempt.
+const maxErrorBody = 512
+
+// pruneInterval is the pause between prunes of old delivered deliveries.
+const pruneInterval = time.Hour
+
+// DeliveryRepository provides methods for processing the webhook delivery queue.
+type DeliveryRepository interface {
+	ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookDelivery, error)
+	CompleteDelivery(ctx context.Context, id uuid.UUID, statusCode int) error
+	FailDelivery(ctx context.Context, id uuid.UUID, statusCode *int, lastErr string, retryAfter time.Duration) error
+	PruneDeliveries(ctx context.Context, retention time.Duration) (int64, error)
+}
+
+// WorkerConfig holds the delivery worker settings.
+type WorkerConfig struct {
+	BatchSize    int           // deliveries claimed per poll
+	PollInterval time.Duration // pause between polls of an empty queue
+	Timeout      time.Duration // timeout of a single request
+	MaxAttempts  int           // attempts before a delivery is dead
+	BaseBackoff  time.Duration // delay after the first failed attempt, doubled after every further one
+	MaxBackoff   time.Duration // upper bound of the delay
+	AllowPrivate bool          // whether endpoints may be on private or reserved addresses
+	Retention    time.Duration // age after which delivered deliveries are deleted; 0 keeps them
+}
+
+// Worker delivers queued webhook events.
+//
+// Several workers, also on different instances, can process the same queue.
+type Worker struct {
+	repo   DeliveryRepository
+	client *http.Client
+	cfg    WorkerConfig
+}
+
+// NewWorker creates a new Worker.
+func NewWorker(repo DeliveryRepository, cfg WorkerConfig) *Worker {
+	return &Worker{
+		repo:   repo,
+		client: newHTTPClient(cfg.Timeout, cfg.AllowPrivate),
+		cfg:    cfg,
+	}
+}
+
+// Run delivers queued events until ctx is done. Delivered deliveries older
+// than the retention are pruned along the way.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.PollInterval)
+	defer ticker.Stop()
+
+	var lastPrune time.Time
+	for {
+		if w.cfg.Retention > 0 && time.Since(lastPrune) >= pruneInterval {
+			lastPrune = time.Now()
+			w.prune(ctx)
+		}
+
+		// Keep draining without waiting while full batches are claimed.
+		n, err := w.processBatch(ctx)
+		if err != nil {
+			zlog.Logger.Error().Err(err).Msg("failed to process webhook deliveries")
+		}
+		if err == nil && n == w.cfg.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// prune deletes delivered deliveries older than the retention.
+func (w *Worker) prune(ctx context.Context) {
+	n, err := w.repo.PruneDeliveries(ctx, w.cfg.Retention)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Msg("failed to prune webhook deliveries")
+		return
+	}
+	if n > 0 {
+		zlog.Logger.Info().Int64("count", n).Msg("pruned webhook deliveries")
+	}
+}
+
+// processBatch claims and attempts a batch of due deliveries. It returns the
+// number of claimed deliveries.
+func (w *Worker) processBatch(ctx context.Context) (int, error) {
+	// Leave enough time to attempt the whole batch before another worker may
+	// claim the same deliveries again.
+	lease := time.Duration(w.cfg.BatchSize)*w.cfg.Timeout + time.Minute
+
+	deliveries, err := w.repo.ClaimDeliveries(ctx, w.cfg.BatchSize, lease)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, d := range deliveries {
+		w.attempt(ctx, d)
+	}
+
+	return len(deliveries), nil
+}
+
+// attempt sends a delivery and records the result.
+func (w *Worker) attempt(ctx context.Context, d model.WebhookDelivery) {
+	statusCode, err := w.send(ctx, d)
+	if err == nil {
+		if err := w.repo.CompleteDelivery(ctx, d.ID, statusCode); err != nil {
+			zlog.Logger.Error().Err(err).Str("id", d.ID.String()).Msg("failed to complete webhook delivery")
+		}
+		return
+	}
+
+	var code *int
+	if statusCode != 0 {
+		code = &statusCode
+	}
+
+	var retryAfter time.Duration
+	if d.Attempts < w.cfg.MaxAttempts {
+		retryAfter = w.backoff(d.Attempts)
+	}
+
+	zlog.Logger.Warn().Err(err).Str("id", d.ID.String()).Int("attempt", d.Attempts).Msg("webhook delivery failed")
+
+	if err := w.repo.FailDelivery(ctx, d.ID, code, err.Error(), retryAfter); err != nil {
+		zlog.Logger.Error().Err(err).Str("id", d.ID.String()).Msg("failed to record webhook delivery failure")
+	}
+}
+
+// send POSTs the signed payload of a delivery. It returns the response status
+// code, if any, and an error unless the endpoint answered with 2xx.
+func (w *Worker) send(ctx context.Context, d model.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, d.EventType)
+	req.Header.Set(DeliveryHeader, d.ID.String())
+	req.Header.Set(SignatureHeader, fmt.Sprintf("t=%d,v1=%s", timestamp, Sign(d.Secret, timestamp, d.Payload)))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return resp.StatusCode, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, body)
+	}
+
+	// Drain the body so the connection can be reused.
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay after the given number of failed attempts.
+func (w *Worker) backoff(attempts int) time.Duration {
+	delay := w.cfg.BaseBackoff
+	for i := 1; i < attempts && delay < w.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+
+	return min(delay, w.cfg.MaxBackoff)
+}
+
+// Sign returns the hex-encoded HMAC-SHA256 of "<timestamp>.<body>" with the
+// webhook secret, as sent in the v1 part of SignatureHeader.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,191 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/aliskhannn/comment-tree/internal/model"
+)
+
+var (
+	// ErrUnknownTenant is returned when the requested tenant is not configured.
+	ErrUnknownTenant = errors.New("unknown tenant")
+	// ErrTenantMismatch is returned when the credentials belong to another tenant
+	// than the one requested.
+	ErrTenantMismatch = errors.New("credentials belong to another tenant")
+	// ErrNoTenant is returned when a tenant-scoped operation runs without a tenant.
+	ErrNoTenant = errors.New("no tenant in context")
+)
+
+// QueryParam is the query param naming the tenant of clients that cannot set headers.
+const QueryParam = "tenant"
+
+// DefaultMaxContentLength is the maximum comment length of tenants that set none.
+const DefaultMaxContentLength = 1000
+
+// DefaultReportThreshold is the report threshold of tenants that set none.
+const DefaultReportThreshold = 5
+
+// tenantKey is the context key of the current tenant.
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx scoped to the tenant.
+func WithTenant(ctx context.Context, t model.Tenant) context.Context {
+	return context.WithValue(ctx, tenantKey{}, t)
+}
+
+// FromContext returns the tenant ctx is scoped to.
+func FromContext(ctx context.Context) (model.Tenant, bool) {
+	t, ok := ctx.Value(tenantKey{}).(model.Tenant)
+	return t, ok
+}
+
+// IDFromContext returns the ID of the tenant ctx is scoped to, or ErrNoTenant.
+func IDFromContext(ctx context.Context) (string, error) {
+	t, ok := FromContext(ctx)
+	if !ok {
+		return "", ErrNoTenant
+	}
+	return t.ID, nil
+}
+
+// Registry holds the configured tenants and resolves them for requests.
+type Registry struct {
+	tenants       map[string]model.Tenant
+	bySubdomain   map[string]string
+	header        string
+	baseDomain    string
+	defaultTenant string
+}
+
+// NewRegistry creates a new Registry.
+//
+// Requests name their tenant in header or through a subdomain of baseDomain;
+// requests that name none belong to defaultTenant.
+func NewRegistry(tenants []model.Tenant, header, baseDomain, defaultTenant string) (*Registry, error) {
+	r := &Registry{
+		tenants:       make(map[string]model.Tenant, len(tenants)),
+		bySubdomain:   make(map[string]string, len(tenants)),
+		header:        header,
+		baseDomain:    strings.ToLower(baseDomain),
+		defaultTenant: defaultTenant,
+	}
+
+	for _, t := range tenants {
+		if t.ID == "" {
+			return nil, errors.New("tenant id is required")
+		}
+
+		if t.MaxContentLength <= 0 {
+			t.MaxContentLength = DefaultMaxContentLength
+		}
+		if t.ReportThreshold <= 0 {
+			t.ReportThreshold = DefaultReportThreshold
+		}
+		switch t.ModerationMode {
+		case "":
+			t.ModerationMode = model.ModerationPost
+		case model.ModerationPost, model.ModerationPre:
+		default:
+			return nil, fmt.Errorf("tenant %s: unknown moderation mode %q", t.ID, t.ModerationMode)
+		}
+		if t.Language == "" {
+			t.Language = model.DefaultLanguage
+		}
+		lang, ok := model.ParseLanguage(t.Language)
+		if !ok {
+			return nil, fmt.Errorf("tenant %s: unsupported language %q", t.ID, t.Language)
+		}
+		t.Language = lang
+
+		r.tenants[t.ID] = t
+
+		if t.Subdomain != "" {
+			r.bySubdomain[strings.ToLower(t.Subdomain)] = t.ID
+		}
+	}
+
+	if _, ok := r.tenants[defaultTenant]; !ok {
+		return nil, errors.New("default tenant is not configured")
+	}
+
+	return r, nil
+}
+
+// Resolve returns the tenant of a request.
+//
+// The tenant is taken from the tenant header, then from the tenant query
+// param (for browser EventSource and WebSocket clients, which cannot set
+// headers), then from the subdomain, and falls back to the default tenant.
+// If boundTenant is set (the caller's credentials belong to a tenant), the
+// request may only name that tenant.
+func (r *Registry) Resolve(req *http.Request, boundTenant string) (model.Tenant, error) {
+	requested := req.Header.Get(r.header)
+	if requested == "" {
+		requested = req.URL.Query().Get(QueryParam)
+	}
+	if requested == "" {
+		requested = r.fromHost(req.Host)
+	}
+
+	id := requested
+	switch {
+	case boundTenant != "":
+		if requested != "" && requested != boundTenant {
+			return model.Tenant{}, ErrTenantMismatch
+		}
+		id = boundTenant
+	case id == "":
+		id = r.defaultTenant
+	}
+
+	t, ok := r.tenants[id]
+	if !ok {
+		return model.Tenant{}, ErrUnknownTenant
+	}
+
+	return t, nil
+}
+
+// DefaultTenant returns the ID of the tenant of requests that name none.
+func (r *Registry) DefaultTenant() string {
+	return r.defaultTenant
+}
+
+// AllowsOrigin reports whether any tenant allows browsers on origin.
+func (r *Registry) AllowsOrigin(origin string) bool {
+	for _, t := range r.tenants {
+		if t.AllowsOrigin(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// fromHost returns the ID of the tenant whose subdomain the host is on, or
+// an empty string if the host is not a subdomain of the base domain.
+func (r *Registry) fromHost(host string) string {
+	if r.baseDomain == "" {
+		return ""
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	label, ok := strings.CutSuffix(strings.ToLower(host), "."+r.baseDomain)
+	if !ok || strings.Contains(label, ".") {
+		return ""
+	}
+
+	if id, ok := r.bySubdomain[label]; ok {
+		return id
+	}
+
+	// Unknown subdomains resolve to no tenant rather than the default one.
+	return label
+}
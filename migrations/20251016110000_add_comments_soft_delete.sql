@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE comments
+    ADD COLUMN deleted_at TIMESTAMP,
+    ADD COLUMN deleted_by TEXT;
+
+CREATE INDEX idx_comments_deleted_at ON comments(deleted_at) WHERE deleted_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX idx_comments_deleted_at;
+
+ALTER TABLE comments
+    DROP COLUMN deleted_by,
+    DROP COLUMN deleted_at;
+-- +goose StatementEnd
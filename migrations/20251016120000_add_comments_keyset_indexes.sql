@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE INDEX idx_comments_created_at_id ON comments(created_at, id);
+CREATE INDEX idx_comments_updated_at_id ON comments(updated_at, id);
+CREATE INDEX idx_comments_parent_created_at_id ON comments(parent_id, created_at, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX idx_comments_parent_created_at_id;
+DROP INDEX idx_comments_updated_at_id;
+DROP INDEX idx_comments_created_at_id;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE comments
+    ADD COLUMN author_id TEXT,
+    ADD COLUMN author_name TEXT;
+
+CREATE INDEX idx_comments_author_id ON comments(author_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX idx_comments_author_id;
+
+ALTER TABLE comments
+    DROP COLUMN author_name,
+    DROP COLUMN author_id;
+-- +goose StatementEnd
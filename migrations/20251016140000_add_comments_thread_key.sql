@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE comments ADD COLUMN thread_key TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX idx_comments_thread_created_at_id ON comments(thread_key, created_at, id);
+CREATE INDEX idx_comments_thread_updated_at_id ON comments(thread_key, updated_at, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX idx_comments_thread_updated_at_id;
+DROP INDEX idx_comments_thread_created_at_id;
+
+ALTER TABLE comments DROP COLUMN thread_key;
+-- +goose StatementEnd
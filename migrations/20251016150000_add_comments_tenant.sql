@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE comments ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+
+DROP INDEX idx_comments_thread_created_at_id;
+DROP INDEX idx_comments_thread_updated_at_id;
+
+CREATE INDEX idx_comments_tenant_thread_created_at_id ON comments(tenant_id, thread_key, created_at, id);
+CREATE INDEX idx_comments_tenant_thread_updated_at_id ON comments(tenant_id, thread_key, updated_at, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX idx_comments_tenant_thread_updated_at_id;
+DROP INDEX idx_comments_tenant_thread_created_at_id;
+
+CREATE INDEX idx_comments_thread_created_at_id ON comments(thread_key, created_at, id);
+CREATE INDEX idx_comments_thread_updated_at_id ON comments(thread_key, updated_at, id);
+
+ALTER TABLE comments DROP COLUMN tenant_id;
+-- +goose StatementEnd
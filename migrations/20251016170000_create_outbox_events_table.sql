@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id BIGSERIAL PRIMARY KEY,
+    event_id UUID NOT NULL UNIQUE DEFAULT gen_random_uuid(),
+    tenant_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    claimed_until TIMESTAMP
+);
+
+ALTER TABLE webhook_deliveries ADD COLUMN event_id UUID;
+
+CREATE UNIQUE INDEX idx_webhook_deliveries_subscription_event ON webhook_deliveries(subscription_id, event_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX idx_webhook_deliveries_subscription_event;
+
+ALTER TABLE webhook_deliveries DROP COLUMN event_id;
+
+DROP TABLE IF EXISTS outbox_events;
+-- +goose StatementEnd
@@ -0,0 +1,64 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS comment_votes (
+    comment_id UUID NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL,
+    value SMALLINT NOT NULL CHECK (value IN (-1, 1)),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (comment_id, user_id)
+);
+
+ALTER TABLE comments
+    ADD COLUMN upvotes INT NOT NULL DEFAULT 0,
+    ADD COLUMN downvotes INT NOT NULL DEFAULT 0;
+
+-- Scores are derived from the vote counters, so a vote only updates the counters.
+ALTER TABLE comments
+    ADD COLUMN score INT GENERATED ALWAYS AS (upvotes - downvotes) STORED,
+    -- Lower bound of the Wilson score interval of the upvote ratio at 95% confidence.
+    ADD COLUMN best DOUBLE PRECISION GENERATED ALWAYS AS (
+        CASE WHEN upvotes + downvotes = 0 THEN 0
+        ELSE ((upvotes + 1.9208) / (upvotes + downvotes)
+              - 1.96 * sqrt(upvotes::float8 * downvotes / (upvotes + downvotes) + 0.9604) / (upvotes + downvotes))
+             / (1 + 3.8416 / (upvotes + downvotes))
+        END
+    ) STORED,
+    -- Many votes that are evenly split rank highest.
+    ADD COLUMN controversial DOUBLE PRECISION GENERATED ALWAYS AS (
+        CASE WHEN upvotes = 0 OR downvotes = 0 THEN 0
+        ELSE power(
+            (upvotes + downvotes)::float8,
+            CASE WHEN upvotes > downvotes THEN downvotes::float8 / upvotes ELSE upvotes::float8 / downvotes END
+        )
+        END
+    ) STORED,
+    -- Every order of magnitude of score is worth 12.5 hours of age.
+    ADD COLUMN hot DOUBLE PRECISION GENERATED ALWAYS AS (
+        sign((upvotes - downvotes)::float8) * log(greatest(abs(upvotes - downvotes), 1)::float8)
+        + (extract(epoch FROM created_at)::float8 - 1735689600) / 45000
+    ) STORED;
+
+CREATE INDEX idx_comments_tenant_thread_score_id ON comments(tenant_id, thread_key, score, id);
+CREATE INDEX idx_comments_tenant_thread_best_id ON comments(tenant_id, thread_key, best, id);
+CREATE INDEX idx_comments_tenant_thread_controversial_id ON comments(tenant_id, thread_key, controversial, id);
+CREATE INDEX idx_comments_tenant_thread_hot_id ON comments(tenant_id, thread_key, hot, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX idx_comments_tenant_thread_hot_id;
+DROP INDEX idx_comments_tenant_thread_controversial_id;
+DROP INDEX idx_comments_tenant_thread_best_id;
+DROP INDEX idx_comments_tenant_thread_score_id;
+
+ALTER TABLE comments
+    DROP COLUMN hot,
+    DROP COLUMN controversial,
+    DROP COLUMN best,
+    DROP COLUMN score,
+    DROP COLUMN downvotes,
+    DROP COLUMN upvotes;
+
+DROP TABLE IF EXISTS comment_votes;
+-- +goose StatementEnd
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE comments
+    ADD COLUMN status TEXT NOT NULL DEFAULT 'approved'
+        CHECK (status IN ('pending', 'approved', 'rejected', 'spam')),
+    ADD COLUMN moderation_reason TEXT,
+    ADD COLUMN moderated_by TEXT,
+    ADD COLUMN moderated_at TIMESTAMP;
+
+-- The moderation queue only ever scans the comments awaiting a decision.
+CREATE INDEX idx_comments_tenant_pending ON comments(tenant_id, created_at, id) WHERE status = 'pending';
+
+-- Per-thread overrides of the tenant's moderation mode.
+CREATE TABLE IF NOT EXISTS thread_settings (
+    tenant_id TEXT NOT NULL,
+    thread_key TEXT NOT NULL,
+    moderation_mode TEXT NOT NULL CHECK (moderation_mode IN ('post', 'pre')),
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (tenant_id, thread_key)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS thread_settings;
+
+DROP INDEX idx_comments_tenant_pending;
+
+ALTER TABLE comments
+    DROP COLUMN moderated_at,
+    DROP COLUMN moderated_by,
+    DROP COLUMN moderation_reason,
+    DROP COLUMN status;
+-- +goose StatementEnd
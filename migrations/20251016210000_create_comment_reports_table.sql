@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS comment_reports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id TEXT NOT NULL,
+    comment_id UUID NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    reporter_id TEXT NOT NULL,
+    reason TEXT NOT NULL CHECK (reason IN ('spam', 'harassment', 'hate', 'misinformation', 'off_topic', 'other')),
+    details TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'resolved')),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    resolved_at TIMESTAMP
+);
+
+-- A reporter has at most one open report per comment.
+CREATE UNIQUE INDEX idx_comment_reports_open_reporter ON comment_reports(comment_id, reporter_id) WHERE status = 'open';
+CREATE INDEX idx_comment_reports_tenant_open ON comment_reports(tenant_id, comment_id) WHERE status = 'open';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS comment_reports;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE comments ADD COLUMN content_html TEXT NOT NULL DEFAULT '';
+
+-- Existing comments are shown as escaped plain text until they are edited.
+UPDATE comments
+SET content_html = '<p>' || replace(replace(replace(replace(content, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), E'\n', '<br>') || '</p>';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE comments DROP COLUMN content_html;
+-- +goose StatementEnd
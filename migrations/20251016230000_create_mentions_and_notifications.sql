@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE comments ADD COLUMN author_username TEXT;
+
+-- Mentions resolve to the latest author with the username in the tenant.
+CREATE INDEX idx_comments_tenant_author_username ON comments(tenant_id, lower(author_username), created_at DESC)
+    WHERE author_username IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS comment_mentions (
+    comment_id UUID NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL,
+    username TEXT NOT NULL,
+    PRIMARY KEY (comment_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    type TEXT NOT NULL CHECK (type IN ('mention', 'reply')),
+    comment_id UUID NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    actor_id TEXT,
+    actor_name TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    read_at TIMESTAMP,
+    -- A user is notified at most once per comment and type, however often the event is relayed.
+    UNIQUE (user_id, comment_id, type)
+);
+
+CREATE INDEX idx_notifications_user_created_at ON notifications(tenant_id, user_id, created_at DESC, id DESC);
+CREATE INDEX idx_notifications_user_unread ON notifications(tenant_id, user_id) WHERE read_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS comment_mentions;
+DROP INDEX IF EXISTS idx_comments_tenant_author_username;
+ALTER TABLE comments DROP COLUMN author_username;
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    tenant_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    email TEXT NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    delivery TEXT NOT NULL CHECK (delivery IN ('instant', 'hourly', 'daily', 'off')),
+    -- Notifications created up to this time were emailed or skipped.
+    notified_until TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_sent_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    -- Lease of a sender working on the next email, or the time of the next attempt after a failure.
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (tenant_id, user_id)
+);
+
+CREATE INDEX idx_notification_preferences_next_attempt_at ON notification_preferences(next_attempt_at)
+    WHERE delivery <> 'off';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS notification_preferences;
+-- +goose StatementEnd
@@ -0,0 +1,49 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The text search configurations comments can be indexed with, by name. Names
+-- are stored as text rather than regconfig, whose OIDs pg_upgrade cannot keep.
+CREATE DOMAIN search_language AS TEXT CHECK (VALUE IN (
+    'simple', 'arabic', 'danish', 'dutch', 'english', 'finnish', 'french', 'german', 'greek', 'hungarian',
+    'indonesian', 'irish', 'italian', 'lithuanian', 'nepali', 'norwegian', 'portuguese', 'romanian', 'russian',
+    'spanish', 'swedish', 'tamil', 'turkish'
+));
+
+-- comment_search_vector indexes content in a language. The cast to regconfig
+-- depends on the catalog, which is fixed for the built-in configurations the
+-- domain allows, so the function may be declared immutable for the generated
+-- column.
+CREATE FUNCTION comment_search_vector(search_language, TEXT) RETURNS TSVECTOR
+    LANGUAGE sql IMMUTABLE STRICT PARALLEL SAFE
+    AS $$ SELECT pg_catalog.to_tsvector($1::pg_catalog.regconfig, $2) $$;
+
+-- The language each comment is indexed with.
+ALTER TABLE comments ADD COLUMN language search_language NOT NULL DEFAULT 'english';
+
+ALTER TABLE comments
+    ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (comment_search_vector(language, content)) STORED;
+
+CREATE INDEX idx_comments_search_vector ON comments USING GIN (search_vector);
+DROP INDEX IF EXISTS idx_comments_content_fts;
+
+-- Threads may set a language for new comments, so the moderation mode becomes optional.
+ALTER TABLE thread_settings
+    ALTER COLUMN moderation_mode DROP NOT NULL,
+    ADD COLUMN language search_language;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM thread_settings WHERE moderation_mode IS NULL;
+
+ALTER TABLE thread_settings
+    DROP COLUMN language,
+    ALTER COLUMN moderation_mode SET NOT NULL;
+
+CREATE INDEX idx_comments_content_fts ON comments USING GIN (to_tsvector('english', content));
+DROP INDEX IF EXISTS idx_comments_search_vector;
+
+ALTER TABLE comments DROP COLUMN search_vector, DROP COLUMN language;
+
+DROP FUNCTION comment_search_vector(search_language, TEXT);
+DROP DOMAIN search_language;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Serves fuzzy (word similarity) and prefix (regular expression) searches
+-- and autocompletion, which only look at live comments.
+CREATE INDEX idx_comments_content_trgm ON comments USING GIN (content gin_trgm_ops) WHERE deleted_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_comments_content_trgm;
+-- +goose StatementEnd
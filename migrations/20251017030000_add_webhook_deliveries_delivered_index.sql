@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Serves pruning delivered deliveries past their retention.
+CREATE INDEX idx_webhook_deliveries_delivered ON webhook_deliveries(delivered_at) WHERE status = 'delivered';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_webhook_deliveries_delivered;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Failed relay attempts, the sinks that already accepted an event and the
+-- dead-letter state of events that kept failing.
+ALTER TABLE outbox_events
+    ADD COLUMN attempts INT NOT NULL DEFAULT 0,
+    ADD COLUMN delivered_sinks TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN last_error TEXT,
+    ADD COLUMN dead_at TIMESTAMP;
+
+CREATE INDEX idx_outbox_events_pending ON outbox_events(id) WHERE dead_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_outbox_events_pending;
+
+ALTER TABLE outbox_events
+    DROP COLUMN dead_at,
+    DROP COLUMN last_error,
+    DROP COLUMN delivered_sinks,
+    DROP COLUMN attempts;
+-- +goose StatementEnd
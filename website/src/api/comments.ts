@@ -1,13 +1,34 @@
 import axios from "axios";
-import type { Comment } from "../types/types";
+import type { Comment, CommentEvent, Reaction, SearchMode } from "../types/types";
 import { buildCommentTree } from "../utils/buildTree";
 
 const API_URL = "http://localhost:8080/api/comments/";
 
+// Writes require authentication; the demo UI uses a static API key.
+const API_KEY = import.meta.env.VITE_API_KEY as string | undefined;
+if (API_KEY) {
+  axios.defaults.headers.common["X-API-Key"] = API_KEY;
+}
+
+// Tenant the UI belongs to; the server falls back to its default tenant.
+const TENANT = import.meta.env.VITE_TENANT_ID as string | undefined;
+if (TENANT) {
+  axios.defaults.headers.common["X-Tenant-ID"] = TENANT;
+}
+
+// Thread (page or resource) the UI shows comments for; empty is the default thread.
+const THREAD = (import.meta.env.VITE_THREAD_KEY as string | undefined) ?? "";
+
 interface CreateCommentResponse {
   result: Comment;
 }
 
+interface CommentPage {
+  items: Comment[];
+  next_cursor?: string;
+  prev_cursor?: string;
+}
+
 export const createComment = async (
   content: string,
   parentId: string | null
@@ -16,6 +37,7 @@ export const createComment = async (
   const response = await axios.post<CreateCommentResponse>(API_URL, {
     content,
     parent_id: parentId,
+    thread: THREAD,
   });
   return response.data.result;
 };
@@ -23,18 +45,76 @@ export const createComment = async (
 export const getComments = async (params: {
   parent?: string;
   search?: string;
+  mode?: SearchMode;
+  children?: number; // replies loaded with every search result
   limit?: number;
-  offset?: number;
+  cursor?: string;
 }) => {
-  const response = await axios.get<Comment[]>(API_URL, { params });
-  return buildCommentTree(response.data || []);
+  const response = await axios.get<CommentPage>(API_URL, {
+    params: { thread: THREAD, ...params },
+  });
+  return {
+    comments: buildCommentTree(response.data.items || []),
+    nextCursor: response.data.next_cursor,
+    prevCursor: response.data.prev_cursor,
+  };
+};
+
+// Suggests searches completing the last word of q with words used in the thread.
+export const autocomplete = async (q: string, signal?: AbortSignal) => {
+  const response = await axios.get<string[]>(`${API_URL}autocomplete`, {
+    params: { q, thread: THREAD },
+    signal,
+  });
+  return response.data || [];
 };
 
 export const getComment = async (id: string) => {
-  const response = await axios.get<Comment>(`${API_URL}${id}`);
+  // The API assembles the subtree, so no client-side tree building is needed.
+  const response = await axios.get<Comment>(`${API_URL}${id}`, {
+    params: { format: "nested" },
+  });
   return response.data;
 };
 
 export const deleteComment = async (id: string) => {
   await axios.delete(`${API_URL}${id}`);
 };
+
+// Sets the current user's vote; "none" withdraws it. Returns the updated comment.
+export const voteComment = async (id: string, vote: "up" | "down" | "none") => {
+  const response =
+    vote === "none"
+      ? await axios.delete<Comment>(`${API_URL}${id}/vote`)
+      : await axios.post<Comment>(`${API_URL}${id}/${vote}vote`);
+  return response.data;
+};
+
+// Adds or removes the current user's reaction. Returns the comment's reactions.
+export const toggleReaction = async (id: string, emoji: string, reacted: boolean) => {
+  const url = `${API_URL}${id}/reactions/${encodeURIComponent(emoji)}`;
+  const response = reacted
+    ? await axios.delete<Reaction[]>(url)
+    : await axios.post<Reaction[]>(url);
+  return response.data;
+};
+
+// Subscribes to the created, updated and deleted events of a comment's subtree.
+// EventSource reconnects on its own and resumes after the last received event.
+export const subscribeToComment = (
+  id: string,
+  onEvent: (event: CommentEvent) => void
+) => {
+  const url = new URL(`${API_URL}${id}/stream`);
+  if (TENANT) {
+    url.searchParams.set("tenant", TENANT); // EventSource cannot set headers
+  }
+
+  const source = new EventSource(url);
+  const handle = (e: MessageEvent<string>) => onEvent(JSON.parse(e.data));
+  for (const type of ["comment.created", "comment.updated", "comment.deleted"]) {
+    source.addEventListener(type, handle);
+  }
+
+  return () => source.close();
+};
@@ -1,6 +1,6 @@
 import { useState } from "react";
 import { Link } from "react-router-dom";
-import { deleteComment } from "../api/comments";
+import { deleteComment, toggleReaction, voteComment } from "../api/comments";
 import type { Comment as CommentType } from "../types/types";
 import CommentForm from "./CommentForm";
 
@@ -10,6 +10,12 @@ interface CommentProps {
   onCommentAdded?: (newComment: CommentType) => void;
 }
 
+// Length of the quoted parent content of search results.
+const EXCERPT_LENGTH = 80;
+
+const excerpt = (content: string) =>
+  content.length > EXCERPT_LENGTH ? `${content.slice(0, EXCERPT_LENGTH)}…` : content;
+
 const Comment: React.FC<CommentProps> = ({
   comment,
   level = 0,
@@ -17,21 +23,46 @@ const Comment: React.FC<CommentProps> = ({
 }) => {
   const [showReplyForm, setShowReplyForm] = useState(false);
   const [showChildren, setShowChildren] = useState(false);
-  const [isDeleted, setIsDeleted] = useState(false);
   const [localComment, setLocalComment] = useState<CommentType>({
     ...comment,
-    children: comment.children || [],
+    // Search results carry their first replies in their context.
+    children: comment.children?.length ? comment.children : comment.context?.children || [],
   });
 
   const handleDelete = async () => {
     try {
       await deleteComment(comment.id);
-      setIsDeleted(true);
+      // Replies survive a delete, so keep the node as a placeholder.
+      setLocalComment({
+        ...localComment,
+        content: "[deleted]",
+        content_html: "<p>[deleted]</p>",
+        author: null,
+        deleted_at: new Date().toISOString(),
+      });
     } catch (error) {
       console.error("Failed to delete comment:", error);
     }
   };
 
+  const handleVote = async (vote: "up" | "down") => {
+    try {
+      const updated = await voteComment(localComment.id, vote);
+      setLocalComment({ ...localComment, ...updated, children: localComment.children });
+    } catch (error) {
+      console.error("Failed to vote on comment:", error);
+    }
+  };
+
+  const handleReaction = async (emoji: string, reacted: boolean) => {
+    try {
+      const reactions = await toggleReaction(localComment.id, emoji, reacted);
+      setLocalComment({ ...localComment, reactions });
+    } catch (error) {
+      console.error("Failed to react to comment:", error);
+    }
+  };
+
   const handleCommentAdded = (newComment: CommentType) => {
     if (newComment.parent_id === localComment.id) {
       setLocalComment({
@@ -43,8 +74,8 @@ const Comment: React.FC<CommentProps> = ({
     onCommentAdded?.(newComment);
   };
 
-  if (isDeleted) return null;
-
+  const ancestors = localComment.context?.ancestors ?? [];
+  const parent = ancestors[ancestors.length - 1];
   const hasChildren = localComment.children && localComment.children.length > 0;
   const hasManyChildren = hasChildren && localComment.children!.length > 4;
 
@@ -52,20 +83,76 @@ const Comment: React.FC<CommentProps> = ({
     <div className={`ml-${level * 4} p-4 border-l-2 border-gray-200`}>
       <div className="flex justify-between items-start mb-2">
         <div className="flex-1">
-          <p className="text-gray-800">{localComment.content}</p>
+          {parent && (
+            <p className="comment-context text-sm text-gray-500">
+              {ancestors.length > 1 &&
+                ancestors
+                  .slice(0, -1)
+                  .map((a) => a.author?.name ?? "[deleted]")
+                  .join(" › ") + " › "}
+              In reply to {parent.author?.name ?? "[deleted]"}: “{excerpt(parent.content)}”
+            </p>
+          )}
+          {/* content_html is sanitized by the server against an allowlist. */}
+          <div
+            className={
+              localComment.deleted_at ? "comment-body text-gray-400 italic" : "comment-body text-gray-800"
+            }
+            dangerouslySetInnerHTML={{ __html: localComment.content_html }}
+          />
+          {/* highlight is escaped by the server except for <mark>. */}
+          {localComment.highlight && (
+            <p
+              className="comment-highlight text-sm text-gray-600"
+              dangerouslySetInnerHTML={{ __html: localComment.highlight }}
+            />
+          )}
           <p className="text-sm text-gray-500">
+            {localComment.author && `${localComment.author.name} · `}
             {new Date(localComment.created_at).toLocaleString()}
+            {localComment.status !== "approved" &&
+              ` · ${localComment.status === "pending" ? "awaiting review" : localComment.status}`}
           </p>
         </div>
-        <button
-          onClick={handleDelete}
-          className="text-red-500 hover:text-red-700 ml-2"
-        >
-          Delete
-        </button>
+        {!localComment.deleted_at && (
+          <button
+            onClick={handleDelete}
+            className="text-red-500 hover:text-red-700 ml-2"
+          >
+            Delete
+          </button>
+        )}
       </div>
 
       <div className="flex gap-2 flex-wrap">
+        {!localComment.deleted_at && (
+          <span className="flex items-center gap-1 text-sm">
+            <button
+              onClick={() => handleVote("up")}
+              className="text-gray-500 hover:text-orange-500"
+            >
+              ▲
+            </button>
+            <span className="text-gray-700">{localComment.score}</span>
+            <button
+              onClick={() => handleVote("down")}
+              className="text-gray-500 hover:text-indigo-500"
+            >
+              ▼
+            </button>
+          </span>
+        )}
+
+        {localComment.reactions?.map((r) => (
+          <button
+            key={r.emoji}
+            onClick={() => handleReaction(r.emoji, r.reacted)}
+            className={`text-sm px-1 rounded ${r.reacted ? "bg-blue-100" : "bg-gray-100"}`}
+          >
+            {r.emoji} {r.count}
+          </button>
+        ))}
+
         <button
           onClick={() => setShowReplyForm(!showReplyForm)}
           className="text-blue-500 hover:text-blue-700 text-sm"
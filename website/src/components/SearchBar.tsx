@@ -1,15 +1,45 @@
-import { useState } from 'react';
+import { useEffect, useState } from 'react';
+import { autocomplete } from '../api/comments';
+import type { SearchMode } from '../types/types';
 
 interface SearchBarProps {
-  onSearch: (searchTerm: string) => void;
+  onSearch: (searchTerm: string, mode: SearchMode) => void;
 }
 
+// Delay after the last keystroke before suggestions are fetched.
+const SUGGEST_DELAY_MS = 200;
+
 const SearchBar: React.FC<SearchBarProps> = ({ onSearch }) => {
   const [searchTerm, setSearchTerm] = useState('');
+  const [mode, setMode] = useState<SearchMode>('fts');
+  const [suggestions, setSuggestions] = useState<string[]>([]);
+
+  useEffect(() => {
+    if (searchTerm.trim() === '') {
+      setSuggestions([]);
+      return;
+    }
+
+    const controller = new AbortController();
+    const timer = setTimeout(() => {
+      autocomplete(searchTerm, controller.signal)
+        .then(setSuggestions)
+        .catch((error) => {
+          if (!controller.signal.aborted) {
+            console.error('Failed to fetch suggestions:', error);
+          }
+        });
+    }, SUGGEST_DELAY_MS);
+
+    return () => {
+      clearTimeout(timer);
+      controller.abort();
+    };
+  }, [searchTerm]);
 
   const handleSubmit = (e: React.FormEvent) => {
     e.preventDefault();
-    onSearch(searchTerm);
+    onSearch(searchTerm, mode);
   };
 
   return (
@@ -21,7 +51,24 @@ const SearchBar: React.FC<SearchBarProps> = ({ onSearch }) => {
           onChange={(e) => setSearchTerm(e.target.value)}
           className="flex-1 p-2 border rounded-md"
           placeholder="Search comments..."
+          list="search-suggestions"
+          autoComplete="off"
         />
+        <datalist id="search-suggestions">
+          {suggestions.map((s) => (
+            <option key={s} value={s} />
+          ))}
+        </datalist>
+        <select
+          value={mode}
+          onChange={(e) => setMode(e.target.value as SearchMode)}
+          className="p-2 border rounded-md"
+          title="Search mode"
+        >
+          <option value="fts">Words</option>
+          <option value="fuzzy">Fuzzy</option>
+          <option value="prefix">Prefix</option>
+        </select>
         <button
           type="submit"
           className="bg-blue-500 text-white px-4 py-2 rounded-md hover:bg-blue-600"
@@ -33,4 +80,4 @@ const SearchBar: React.FC<SearchBarProps> = ({ onSearch }) => {
   );
 };
 
-export default SearchBar;
\ No newline at end of file
+export default SearchBar;
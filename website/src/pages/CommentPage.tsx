@@ -3,12 +3,15 @@ import Comment from '../components/Comment';
 import CommentForm from '../components/CommentForm';
 import SearchBar from '../components/SearchBar';
 import { getComments } from '../api/comments';
-import type { Comment as CommentType } from '../types/types';
+import type { Comment as CommentType, SearchMode } from '../types/types';
 
 const CommentPage = () => {
   const [comments, setComments] = useState<CommentType[]>([]);
   const [searchTerm, setSearchTerm] = useState('');
-  const [page, setPage] = useState(1);
+  const [searchMode, setSearchMode] = useState<SearchMode>('fts');
+  const [cursor, setCursor] = useState<string | undefined>(undefined);
+  const [nextCursor, setNextCursor] = useState<string | undefined>(undefined);
+  const [prevCursor, setPrevCursor] = useState<string | undefined>(undefined);
   const limit = 10;
 
   const fetchComments = async () => {
@@ -16,10 +19,14 @@ const CommentPage = () => {
       const data = await getComments({
         parent: undefined,
         search: searchTerm || undefined,
+        mode: searchTerm ? searchMode : undefined,
+        children: searchTerm ? 3 : undefined,
         limit,
-        offset: (page - 1) * limit,
+        cursor,
       });
-      setComments(data || []);
+      setComments(data.comments);
+      setNextCursor(data.nextCursor);
+      setPrevCursor(data.prevCursor);
     } catch (error) {
       console.error('Failed to fetch comments:', error);
     }
@@ -34,15 +41,21 @@ const CommentPage = () => {
     }
   };
 
+  const handleSearch = (term: string, mode: SearchMode) => {
+    setCursor(undefined);
+    setSearchTerm(term);
+    setSearchMode(mode);
+  };
+
   useEffect(() => {
     fetchComments();
-  }, [searchTerm, page]);
+  }, [searchTerm, searchMode, cursor]);
 
   return (
     <div className="max-w-4xl mx-auto p-4">
       <h1 className="text-2xl font-bold mb-6">Comments</h1>
       
-      <SearchBar onSearch={setSearchTerm} />
+      <SearchBar onSearch={handleSearch} />
       <CommentForm parentId={null} onSuccess={handleCommentAdded} />
 
       <div className="mt-6">
@@ -62,15 +75,15 @@ const CommentPage = () => {
 
       <div className="mt-4 flex justify-between">
         <button
-          onClick={() => setPage((p) => Math.max(1, p - 1))}
-          disabled={page === 1}
+          onClick={() => setCursor(prevCursor)}
+          disabled={!prevCursor}
           className="px-4 py-2 bg-gray-200 rounded-md disabled:bg-gray-100"
         >
           Previous
         </button>
         <button
-          onClick={() => setPage((p) => p + 1)}
-          disabled={comments.length < limit}
+          onClick={() => setCursor(nextCursor)}
+          disabled={!nextCursor}
           className="px-4 py-2 bg-gray-200 rounded-md disabled:bg-gray-100"
         >
           Next
@@ -1,7 +1,7 @@
 import { useEffect, useState } from 'react';
 import { useParams, Link } from 'react-router-dom';
 import Comment from '../components/Comment';
-import { getComment } from '../api/comments';
+import { getComment, subscribeToComment } from '../api/comments';
 import type { Comment as CommentType } from '../types/types';
 
 const CommentThreadPage = () => {
@@ -19,6 +19,10 @@ const CommentThreadPage = () => {
       }
     };
     fetchComment();
+
+    // Reload the thread whenever a comment in it changes.
+    if (!id) return;
+    return subscribeToComment(id, fetchComment);
   }, [id]);
 
   if (!comment) {
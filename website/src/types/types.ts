@@ -1,8 +1,52 @@
+export interface Author {
+  id: string;
+  name: string;
+  username?: string;
+}
+
+export interface Reaction {
+  emoji: string;
+  count: number;
+  reacted: boolean; // whether the current user reacted with the emoji
+}
+
 export interface Comment {
   id: string;
   parent_id: string | null;
-  content: string;
+  thread: string;
+  content: string; // Markdown source
+  content_html: string; // sanitized HTML rendered by the server
+  author: Author | null; // null for anonymous legacy and deleted comments
   created_at: string;
   updated_at: string;
-  children?: Comment[]; // This will be added by our tree builder
-}
\ No newline at end of file
+  deleted_at?: string; // Set for soft-deleted comments, content is "[deleted]"
+  upvotes: number;
+  downvotes: number;
+  score: number; // upvotes minus downvotes
+  reactions: Reaction[];
+  status: "pending" | "approved" | "rejected" | "spam"; // only approved ones are public
+  moderation_reason?: string;
+  language: string; // text search configuration, e.g. "english"
+  highlight?: string; // HTML snippets matching a search, matches wrapped in <mark>
+  context?: CommentContext; // Set on search results
+  depth?: number; // Set in nested tree responses
+  reply_count?: number; // Set in nested tree responses
+  children?: Comment[]; // Set in nested tree responses or by our tree builder
+}
+
+// Where a search result sits in its thread.
+export interface CommentContext {
+  ancestors: Comment[]; // from the root down to the parent
+  children?: Comment[]; // first replies, when requested
+}
+
+export interface CommentEvent {
+  id: string;
+  type: "comment.created" | "comment.updated" | "comment.deleted";
+  path: string[]; // IDs from the root comment down to the changed comment
+  comment: Comment;
+  created_at: string;
+}
+
+// How searches match: full-text, similar words or word prefixes.
+export type SearchMode = "fts" | "fuzzy" | "prefix";